@@ -5,6 +5,13 @@ import "github.com/dbrun3/nexus-vector/model"
 type NexusRequest struct {
 	UserId  string        `json:"userId"`
 	Trigger model.Trigger `json:"trigger"`
+
+	// EmbeddingModel optionally selects which configured embedding model's vector space is searched
+	EmbeddingModel string `json:"embeddingModel,omitempty"`
+
+	// Locale is the user's preferred locale, FallbackLocales are accepted in order when it has no relevant pages
+	Locale          string   `json:"locale,omitempty"`
+	FallbackLocales []string `json:"fallbackLocales,omitempty"`
 }
 
 type NexusResponse struct {
@@ -2,26 +2,176 @@ package application
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
 	"log"
 	"net/http"
 	"os"
+	"strconv"
+	"strings"
+	"time"
 
+	"github.com/dbrun3/nexus-vector/dao"
 	"github.com/dbrun3/nexus-vector/handler"
 	"github.com/dbrun3/nexus-vector/nexus"
+	"github.com/dbrun3/nexus-vector/torchserve"
+	"github.com/dbrun3/nexus-vector/util"
 )
 
 func Run() {
+	embeddingModels, err := parseEmbeddingModels(os.Getenv("EMBEDDING_MODELS"))
+	if err != nil {
+		log.Fatalf("Invalid EMBEDDING_MODELS: %v", err)
+	}
+
+	// Tenants and their overrides as JSON, e.g. {"acme": {"min_score": 0.85, "daily_generation_limit": 1000}}
+	var tenants map[string]nexus.TenantConfig
+	if tenantsJSON := os.Getenv("TENANTS"); tenantsJSON != "" {
+		if err := json.Unmarshal([]byte(tenantsJSON), &tenants); err != nil {
+			log.Fatalf("Invalid TENANTS: %v", err)
+		}
+	}
+
+	// Generation providers, USER_LLM_*, TRIGGER_LLM_*, CONTEXT_LLM_* and JUDGE_LLM_* overriding the shared LLM_* settings per role
+	llm, err := parseProvider("LLM_")
+	if err != nil {
+		log.Fatalf("Invalid LLM configuration: %v", err)
+	}
+	providers := make(map[nexus.GenerationRole]nexus.ProviderConfig)
+	for role, prefix := range map[nexus.GenerationRole]string{nexus.UserRole: "USER_LLM_", nexus.TriggerRole: "TRIGGER_LLM_", nexus.ContextRole: "CONTEXT_LLM_", nexus.JudgeRole: "JUDGE_LLM_"} {
+		providers[role], err = parseProvider(prefix)
+		if err != nil {
+			log.Fatalf("Invalid %s LLM configuration: %v", role, err)
+		}
+	}
+
+	limits, err := parseLimits()
+	if err != nil {
+		log.Fatalf("Invalid generation limits: %v", err)
+	}
+
+	retry, breaker, err := parseResilience()
+	if err != nil {
+		log.Fatalf("Invalid LLM retry configuration: %v", err)
+	}
+
+	triggerCache, err := parseTriggerCache()
+	if err != nil {
+		log.Fatalf("Invalid trigger cache configuration: %v", err)
+	}
+
+	drift, err := parseDrift()
+	if err != nil {
+		log.Fatalf("Invalid embedding drift configuration: %v", err)
+	}
+
+	batch, err := parseBatch()
+	if err != nil {
+		log.Fatalf("Invalid TorchServe batching configuration: %v", err)
+	}
+
+	modelVersion, err := parseModelVersion()
+	if err != nil {
+		log.Fatalf("Invalid model version configuration: %v", err)
+	}
+
+	embeddingEncoding, err := dao.ParseEmbeddingEncoding(os.Getenv("EMBEDDING_ENCODING"))
+	if err != nil {
+		log.Fatalf("Invalid EMBEDDING_ENCODING: %v", err)
+	}
+
+	var normalizeEmbeddings bool
+	if value := os.Getenv("NORMALIZE_EMBEDDINGS"); value != "" {
+		if normalizeEmbeddings, err = strconv.ParseBool(value); err != nil {
+			log.Fatalf("Invalid NORMALIZE_EMBEDDINGS: %v", err)
+		}
+	}
+
+	var generationWindow time.Duration
+	if window := os.Getenv("GENERATION_CACHE_WINDOW"); window != "" {
+		if generationWindow, err = time.ParseDuration(window); err != nil {
+			log.Fatalf("Invalid GENERATION_CACHE_WINDOW: %v", err)
+		}
+	}
+
+	candidates, err := envInt("GENERATION_CANDIDATES")
+	if err != nil {
+		log.Fatalf("Invalid generation candidates: %v", err)
+	}
+	keepCandidates, err := envInt("GENERATION_KEEP_CANDIDATES")
+	if err != nil {
+		log.Fatalf("Invalid generation candidates: %v", err)
+	}
+
+	judge, err := parseJudge()
+	if err != nil {
+		log.Fatalf("Invalid judge configuration: %v", err)
+	}
+
+	contextual, err := parseContext()
+	if err != nil {
+		log.Fatalf("Invalid context configuration: %v", err)
+	}
+
+	userVectors, err := parseUserVectors()
+	if err != nil {
+		log.Fatalf("Invalid user vector configuration: %v", err)
+	}
+
+	safety, err := parseSafety()
+	if err != nil {
+		log.Fatalf("Invalid safety configuration: %v", err)
+	}
+
+	// Prompt template versions per generation role, e.g. "user=v1,trigger=v2"
+	promptVersions := make(map[nexus.GenerationRole]string)
+	for _, entry := range splitList(os.Getenv("PROMPT_VERSIONS")) {
+		role, version, ok := strings.Cut(entry, "=")
+		if !ok || version == "" {
+			log.Fatalf("Invalid PROMPT_VERSIONS: expected role=version entries, got %q", entry)
+		}
+		promptVersions[nexus.GenerationRole(strings.TrimSpace(role))] = strings.TrimSpace(version)
+	}
+
 	config := &nexus.Config{
-		OpenAIKey:      os.Getenv("OPENAI_API_KEY"),
-		QdrantHost:     os.Getenv("QDRANT_HOST"),
-		RedisHost:      os.Getenv("REDIS_HOST"),
-		MongoHost:      os.Getenv("MONGODB_HOST"),
-		MongoUser:      os.Getenv("MONGODB_USER"),
-		MongoPass:      os.Getenv("MONGODB_PASS"),
-		TorchServeHost: os.Getenv("TORCHSERVE_HOST"),
-		ModelName:      os.Getenv("MODEL"),
-		Env:            nexus.Prod,
+		OpenAIKey:                os.Getenv("OPENAI_API_KEY"),
+		OutputMode:               nexus.OutputMode(os.Getenv("OUTPUT_MODE")),
+		LLM:                      llm,
+		Providers:                providers,
+		Limits:                   limits,
+		Retry:                    retry,
+		Breaker:                  breaker,
+		GenerationCacheWindow:    generationWindow,
+		Candidates:               candidates,
+		KeepCandidates:           keepCandidates,
+		Judge:                    judge,
+		Context:                  contextual,
+		UserVectors:              userVectors,
+		Safety:                   safety,
+		PromptDir:                os.Getenv("PROMPT_DIR"),
+		PromptVersions:           promptVersions,
+		FallbackPages:            os.Getenv("FALLBACK_PAGES"),
+		QdrantHost:               os.Getenv("QDRANT_HOST"),
+		RedisHost:                os.Getenv("REDIS_HOST"),
+		MongoHost:                os.Getenv("MONGODB_HOST"),
+		MongoUser:                os.Getenv("MONGODB_USER"),
+		MongoPass:                os.Getenv("MONGODB_PASS"),
+		TorchServeHost:           os.Getenv("TORCHSERVE_HOST"),
+		TorchServeProtocol:       os.Getenv("TORCHSERVE_PROTOCOL"),
+		TorchServeManagementHost: os.Getenv("TORCHSERVE_MANAGEMENT_HOST"),
+		ModelName:                os.Getenv("MODEL"),
+		ModelVersion:             modelVersion,
+		Batch:                    batch,
+		EmbeddingModels:          embeddingModels,
+		TextFormat:               util.TextFormat(os.Getenv("TEXT_FORMAT")),
+		NormalizeEmbeddings:      normalizeEmbeddings,
+		EmbeddingEncoding:        embeddingEncoding,
+		Drift:                    drift,
+		TriggerCache:             triggerCache,
+		Locales:                  splitList(os.Getenv("LOCALES")),
+		TenantIsolation:          nexus.TenantIsolation(os.Getenv("TENANT_ISOLATION")),
+		Tenants:                  tenants,
+		Env:                      nexus.Prod,
 	}
 
 	n, err := nexus.InitializeNexus(context.Background(), config)
@@ -29,7 +179,7 @@ func Run() {
 		log.Fatalf("Failed to initialize Nexus: %v", err)
 	}
 
-	h := handler.NewHandler(*n)
+	h := handler.NewHandler(n)
 	mux := h.SetupRoutes()
 
 	port := os.Getenv("PORT")
@@ -40,3 +190,354 @@ func Run() {
 	fmt.Printf("Server starting on port %s\n", port)
 	log.Fatal(http.ListenAndServe(":"+port, mux))
 }
+
+// MigrateEmbeddings re-encodes every embedding stored in REDIS_HOST with EMBEDDING_ENCODING and exits, only counting
+// the embeddings to re-encode on a dry run
+func MigrateEmbeddings(dryRun bool) {
+	encoding, err := dao.ParseEmbeddingEncoding(os.Getenv("EMBEDDING_ENCODING"))
+	if err != nil {
+		log.Fatalf("Invalid EMBEDDING_ENCODING: %v", err)
+	}
+
+	rdClient := nexus.NewRedisClient(os.Getenv("REDIS_HOST"))
+	defer rdClient.Close()
+
+	migration, err := nexus.MigrateEmbeddings(context.Background(), rdClient, encoding, dryRun)
+	verb := "migrated"
+	if migration.DryRun {
+		verb = "to migrate"
+	}
+	fmt.Printf("Scanned %d keys: %d embeddings %s to %s, %d already %s, %d keys without embeddings\n",
+		migration.Scanned, migration.Migrated, verb, migration.Encoding, migration.Current, migration.Encoding, migration.Skipped)
+	if err != nil {
+		log.Fatalf("Failed to migrate embeddings: %v", err)
+	}
+}
+
+// parseProvider reads an OpenAI-compatible provider from environment variables starting with prefix,
+// e.g. LLM_BASE_URL, LLM_MODEL, LLM_ORGANIZATION, LLM_TIMEOUT=30s and LLM_HEADERS="X-Api-Version=2,X-Team=growth"
+func parseProvider(prefix string) (nexus.ProviderConfig, error) {
+	provider := nexus.ProviderConfig{
+		BaseURL:      os.Getenv(prefix + "BASE_URL"),
+		APIKey:       os.Getenv(prefix + "API_KEY"),
+		Model:        os.Getenv(prefix + "MODEL"),
+		Organization: os.Getenv(prefix + "ORGANIZATION"),
+		OutputMode:   nexus.OutputMode(os.Getenv(prefix + "OUTPUT_MODE")),
+	}
+
+	if timeout := os.Getenv(prefix + "TIMEOUT"); timeout != "" {
+		d, err := time.ParseDuration(timeout)
+		if err != nil {
+			return provider, fmt.Errorf("invalid %sTIMEOUT: %w", prefix, err)
+		}
+		provider.Timeout = d
+	}
+
+	for name, cost := range map[string]*float64{
+		"INPUT_COST_PER_MILLION":  &provider.InputCostPerMillion,
+		"OUTPUT_COST_PER_MILLION": &provider.OutputCostPerMillion,
+	} {
+		if value := os.Getenv(prefix + name); value != "" {
+			parsed, err := strconv.ParseFloat(value, 64)
+			if err != nil {
+				return provider, fmt.Errorf("invalid %s%s: %w", prefix, name, err)
+			}
+			*cost = parsed
+		}
+	}
+
+	for _, header := range splitList(os.Getenv(prefix + "HEADERS")) {
+		key, value, ok := strings.Cut(header, "=")
+		if !ok || key == "" {
+			return provider, fmt.Errorf("expected %sHEADERS entries as key=value, got %q", prefix, header)
+		}
+		if provider.Headers == nil {
+			provider.Headers = make(map[string]string)
+		}
+		provider.Headers[strings.TrimSpace(key)] = strings.TrimSpace(value)
+	}
+
+	return provider, nil
+}
+
+// parseLimits reads the generation rate limits and daily budget, unset limits being unlimited
+func parseLimits() (nexus.GenerationLimits, error) {
+	var limits nexus.GenerationLimits
+	var err error
+
+	if limits.GlobalRPM, err = envInt("LLM_GLOBAL_RPM"); err != nil {
+		return limits, err
+	}
+	if limits.UserRPM, err = envInt("LLM_USER_RPM"); err != nil {
+		return limits, err
+	}
+	tokens, err := envInt("LLM_DAILY_TOKEN_BUDGET")
+	if err != nil {
+		return limits, err
+	}
+	limits.DailyTokenBudget = int64(tokens)
+	if value := os.Getenv("LLM_DAILY_COST_BUDGET"); value != "" {
+		if limits.DailyCostBudget, err = strconv.ParseFloat(value, 64); err != nil {
+			return limits, fmt.Errorf("invalid LLM_DAILY_COST_BUDGET: %w", err)
+		}
+	}
+
+	return limits, nil
+}
+
+// parseResilience reads how chat completion requests are retried and when the circuit breaker stops them,
+// e.g. LLM_MAX_RETRIES=3, LLM_RETRY_BASE_DELAY=500ms, LLM_BREAKER_THRESHOLD=5 and LLM_BREAKER_COOLDOWN=30s
+func parseResilience() (nexus.RetryConfig, nexus.BreakerConfig, error) {
+	var retry nexus.RetryConfig
+	var breaker nexus.BreakerConfig
+	var err error
+
+	if retry.MaxRetries, err = envInt("LLM_MAX_RETRIES"); err != nil {
+		return retry, breaker, err
+	}
+	if breaker.Threshold, err = envInt("LLM_BREAKER_THRESHOLD"); err != nil {
+		return retry, breaker, err
+	}
+	for name, duration := range map[string]*time.Duration{
+		"LLM_RETRY_BASE_DELAY": &retry.BaseDelay,
+		"LLM_RETRY_MAX_DELAY":  &retry.MaxDelay,
+		"LLM_BREAKER_COOLDOWN": &breaker.Cooldown,
+	} {
+		if value := os.Getenv(name); value != "" {
+			if *duration, err = time.ParseDuration(value); err != nil {
+				return retry, breaker, fmt.Errorf("invalid %s: %w", name, err)
+			}
+		}
+	}
+
+	return retry, breaker, nil
+}
+
+// parseTriggerCache reads the trigger embedding cache size and Redis TTL, e.g. TRIGGER_CACHE_SIZE=10000 and
+// TRIGGER_CACHE_TTL=24h, negative values disabling a tier
+func parseTriggerCache() (nexus.TriggerCacheConfig, error) {
+	var cache nexus.TriggerCacheConfig
+	var err error
+
+	if cache.Size, err = envInt("TRIGGER_CACHE_SIZE"); err != nil {
+		return cache, err
+	}
+	if value := os.Getenv("TRIGGER_CACHE_TTL"); value != "" {
+		if cache.TTL, err = time.ParseDuration(value); err != nil {
+			return cache, fmt.Errorf("invalid TRIGGER_CACHE_TTL: %w", err)
+		}
+	}
+
+	return cache, nil
+}
+
+// parseDrift reads whether embedding drift is monitored and how, e.g. EMBEDDING_DRIFT=true, EMBEDDING_DRIFT_INTERVAL=1m,
+// EMBEDDING_DRIFT_SAMPLE_RATE=0.1 and EMBEDDING_DRIFT_WINDOW=500
+func parseDrift() (nexus.DriftConfig, error) {
+	var drift nexus.DriftConfig
+	var err error
+
+	if value := os.Getenv("EMBEDDING_DRIFT"); value != "" {
+		if drift.Enabled, err = strconv.ParseBool(value); err != nil {
+			return drift, fmt.Errorf("invalid EMBEDDING_DRIFT: %w", err)
+		}
+	}
+	if value := os.Getenv("EMBEDDING_DRIFT_INTERVAL"); value != "" {
+		if drift.Interval, err = time.ParseDuration(value); err != nil {
+			return drift, fmt.Errorf("invalid EMBEDDING_DRIFT_INTERVAL: %w", err)
+		}
+	}
+	if value := os.Getenv("EMBEDDING_DRIFT_SAMPLE_RATE"); value != "" {
+		if drift.SampleRate, err = strconv.ParseFloat(value, 64); err != nil {
+			return drift, fmt.Errorf("invalid EMBEDDING_DRIFT_SAMPLE_RATE: %w", err)
+		}
+	}
+	if drift.Window, err = envInt("EMBEDDING_DRIFT_WINDOW"); err != nil {
+		return drift, err
+	}
+
+	return drift, nil
+}
+
+// parseBatch reads the TorchServe micro-batching window and size, e.g. TORCHSERVE_BATCH_WINDOW=2ms and
+// TORCHSERVE_BATCH_SIZE=32, batching being disabled without a window
+func parseBatch() (torchserve.BatchConfig, error) {
+	var batch torchserve.BatchConfig
+	var err error
+
+	if value := os.Getenv("TORCHSERVE_BATCH_WINDOW"); value != "" {
+		if batch.Window, err = time.ParseDuration(value); err != nil {
+			return batch, fmt.Errorf("invalid TORCHSERVE_BATCH_WINDOW: %w", err)
+		}
+	}
+	if batch.MaxSize, err = envInt("TORCHSERVE_BATCH_SIZE"); err != nil {
+		return batch, err
+	}
+
+	return batch, nil
+}
+
+// parseModelVersion reads the version of MODEL predictions run on and an optional canary, e.g. MODEL_VERSION=1.0,
+// MODEL_CANARY_VERSION=2.0 and MODEL_CANARY_FRACTION=0.05
+func parseModelVersion() (torchserve.ModelVersion, error) {
+	version := torchserve.ModelVersion{
+		Version: os.Getenv("MODEL_VERSION"),
+		Canary:  os.Getenv("MODEL_CANARY_VERSION"),
+	}
+
+	if value := os.Getenv("MODEL_CANARY_FRACTION"); value != "" {
+		fraction, err := strconv.ParseFloat(value, 64)
+		if err != nil || fraction < 0 || fraction > 1 {
+			return version, fmt.Errorf("invalid MODEL_CANARY_FRACTION, expected a number from 0 to 1: %s", value)
+		}
+		version.CanaryFraction = fraction
+	}
+
+	return version, nil
+}
+
+// parseJudge reads the LLM judge configuration, the rubric being a JSON list of criteria,
+// e.g. [{"name": "relevance", "description": "...", "weight": 2}]
+func parseJudge() (nexus.JudgeConfig, error) {
+	var judge nexus.JudgeConfig
+	var err error
+
+	if value := os.Getenv("JUDGE_ENABLED"); value != "" {
+		if judge.Enabled, err = strconv.ParseBool(value); err != nil {
+			return judge, fmt.Errorf("invalid JUDGE_ENABLED: %w", err)
+		}
+	}
+	if value := os.Getenv("JUDGE_THRESHOLD"); value != "" {
+		if judge.Threshold, err = strconv.ParseFloat(value, 64); err != nil {
+			return judge, fmt.Errorf("invalid JUDGE_THRESHOLD: %w", err)
+		}
+	}
+	if value := os.Getenv("JUDGE_FAIL_OPEN"); value != "" {
+		if judge.FailOpen, err = strconv.ParseBool(value); err != nil {
+			return judge, fmt.Errorf("invalid JUDGE_FAIL_OPEN: %w", err)
+		}
+	}
+	if value := os.Getenv("JUDGE_RUBRIC"); value != "" {
+		if err := json.Unmarshal([]byte(value), &judge.Rubric); err != nil {
+			return judge, fmt.Errorf("invalid JUDGE_RUBRIC: %w", err)
+		}
+	}
+
+	return judge, nil
+}
+
+// parseContext reads the contextual page configuration
+func parseContext() (nexus.ContextConfig, error) {
+	var contextual nexus.ContextConfig
+	var err error
+
+	if value := os.Getenv("CONTEXT_PAGES"); value != "" {
+		if contextual.Enabled, err = strconv.ParseBool(value); err != nil {
+			return contextual, fmt.Errorf("invalid CONTEXT_PAGES: %w", err)
+		}
+	}
+	if value := os.Getenv("CONTEXT_TRIGGER_WEIGHT"); value != "" {
+		weight, err := strconv.ParseFloat(value, 32)
+		if err != nil {
+			return contextual, fmt.Errorf("invalid CONTEXT_TRIGGER_WEIGHT: %w", err)
+		}
+		contextual.TriggerWeight = float32(weight)
+	}
+
+	return contextual, nil
+}
+
+// parseUserVectors reads whether users are represented by a vector per interest facet
+func parseUserVectors() (nexus.UserVectorConfig, error) {
+	var userVectors nexus.UserVectorConfig
+	var err error
+
+	if value := os.Getenv("USER_MULTI_VECTOR"); value != "" {
+		if userVectors.MultiVector, err = strconv.ParseBool(value); err != nil {
+			return userVectors, fmt.Errorf("invalid USER_MULTI_VECTOR: %w", err)
+		}
+	}
+	if userVectors.MaxFacets, err = envInt("USER_MAX_FACETS"); err != nil {
+		return userVectors, err
+	}
+
+	return userVectors, nil
+}
+
+// parseSafety reads the content safety rules as a JSON list, e.g. [{"name": "competitor", "terms": ["Acme"]}], and the
+// moderation API provider from MODERATION_* when MODERATION_ENABLED is set
+func parseSafety() (nexus.SafetyConfig, error) {
+	var safety nexus.SafetyConfig
+
+	if value := os.Getenv("SAFETY_RULES"); value != "" {
+		if err := json.Unmarshal([]byte(value), &safety.Rules); err != nil {
+			return safety, fmt.Errorf("invalid SAFETY_RULES: %w", err)
+		}
+	}
+	if value := os.Getenv("MODERATION_ENABLED"); value != "" {
+		enabled, err := strconv.ParseBool(value)
+		if err != nil {
+			return safety, fmt.Errorf("invalid MODERATION_ENABLED: %w", err)
+		}
+		if enabled {
+			moderation, err := parseProvider("MODERATION_")
+			if err != nil {
+				return safety, err
+			}
+			safety.Moderation = &moderation
+		}
+	}
+
+	return safety, nil
+}
+
+// envInt reads an integer environment variable, 0 when unset
+func envInt(name string) (int, error) {
+	value := os.Getenv(name)
+	if value == "" {
+		return 0, nil
+	}
+	i, err := strconv.Atoi(value)
+	if err != nil {
+		return 0, fmt.Errorf("invalid %s: %w", name, err)
+	}
+	return i, nil
+}
+
+// splitList splits a comma separated environment variable, e.g. "en,es,fr"
+func splitList(s string) []string {
+	if s == "" {
+		return nil
+	}
+	var values []string
+	for _, value := range strings.Split(s, ",") {
+		if value = strings.TrimSpace(value); value != "" {
+			values = append(values, value)
+		}
+	}
+	return values
+}
+
+// parseEmbeddingModels parses a comma separated list of TorchServe model names and dimensions, optionally pinned to a
+// model version, e.g. "my_model:384,mpnet:768@2.0"
+func parseEmbeddingModels(s string) ([]nexus.EmbeddingModel, error) {
+	if s == "" {
+		return nil, nil
+	}
+
+	var models []nexus.EmbeddingModel
+	for _, entry := range strings.Split(s, ",") {
+		name, dimension, ok := strings.Cut(strings.TrimSpace(entry), ":")
+		if !ok || name == "" {
+			return nil, fmt.Errorf("expected name:dimension, got %q", entry)
+		}
+		dimension, version, _ := strings.Cut(dimension, "@")
+		size, err := strconv.ParseUint(dimension, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid dimension for %s: %w", name, err)
+		}
+		models = append(models, nexus.EmbeddingModel{Name: name, Dimension: size, Version: torchserve.ModelVersion{Version: version}})
+	}
+
+	return models, nil
+}
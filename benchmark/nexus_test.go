@@ -9,22 +9,44 @@ import (
 	"time"
 
 	"github.com/dbrun3/nexus-vector/api"
+	"github.com/dbrun3/nexus-vector/dao"
 	"github.com/dbrun3/nexus-vector/model"
 	"github.com/dbrun3/nexus-vector/nexus"
+	"github.com/dbrun3/nexus-vector/util"
 )
 
 const Seed = 2
 const SampleSize = 50
+const Tenant = nexus.DefaultTenant
 
-func setupNexusBench() (*nexus.Nexus, []api.NexusRequest, error) {
+// benchTenant is the tenant pages are stored for with a text format, so pages stored with other formats aren't matched
+func benchTenant(textFormat util.TextFormat) string {
+	if textFormat == util.DefaultTextFormat {
+		return Tenant
+	}
+	return "bench_" + string(textFormat)
+}
+
+func setupNexusBench(triggerCache nexus.TriggerCacheConfig, textFormat util.TextFormat, userVectors nexus.UserVectorConfig) (*nexus.Nexus, []api.NexusRequest, error) {
 
 	config := &nexus.Config{
 		QdrantHost:     os.Getenv("QDRANT_HOST"),
 		RedisHost:      os.Getenv("REDIS_HOST"),
 		TorchServeHost: os.Getenv("TORCHSERVE_HOST"),
 		ModelName:      os.Getenv("MODEL"),
+		TriggerCache:   triggerCache,
+		TextFormat:     textFormat,
+		UserVectors:    userVectors,
+		Tenants:        map[string]nexus.TenantConfig{benchTenant(textFormat): {}},
 		Env:            nexus.Test,
 	}
+	tenant := benchTenant(textFormat)
+
+	// Stored pages' source texts use the same text format as the embeddings
+	serializer, err := util.NewSerializer(textFormat)
+	if err != nil {
+		return nil, nil, err
+	}
 
 	nexus, err := nexus.InitializeNexus(context.Background(), config)
 	if err != nil {
@@ -49,7 +71,7 @@ func setupNexusBench() (*nexus.Nexus, []api.NexusRequest, error) {
 			UserId:  userSnap.ID,
 			Trigger: trigger,
 		}
-		_, err := nexus.InjestUser(context.Background(), userSnap)
+		_, err := nexus.InjestUser(context.Background(), tenant, userSnap)
 		if err != nil {
 			return nil, nil, err
 		}
@@ -59,7 +81,11 @@ func setupNexusBench() (*nexus.Nexus, []api.NexusRequest, error) {
 		if err != nil {
 			return nil, nil, err
 		}
-		err = nexus.StorePageInQdrant(context.Background(), userPage, userEmbedding)
+		userText, err := serializer.UserText(userSimilar)
+		if err != nil {
+			return nil, nil, err
+		}
+		err = nexus.StorePageInQdrant(context.Background(), tenant, userPage, userEmbedding, dao.PageSource{Kind: dao.UserSource, Text: userText})
 		if err != nil {
 			return nil, nil, err
 		}
@@ -67,7 +93,11 @@ func setupNexusBench() (*nexus.Nexus, []api.NexusRequest, error) {
 		if err != nil {
 			return nil, nil, err
 		}
-		err = nexus.StorePageInQdrant(context.Background(), triggerPage, triggerEmbedding)
+		triggerText, err := serializer.TriggerText(triggerSimilar)
+		if err != nil {
+			return nil, nil, err
+		}
+		err = nexus.StorePageInQdrant(context.Background(), tenant, triggerPage, triggerEmbedding, dao.PageSource{Kind: dao.TriggerSource, Text: triggerText})
 		if err != nil {
 			return nil, nil, err
 		}
@@ -78,7 +108,7 @@ func setupNexusBench() (*nexus.Nexus, []api.NexusRequest, error) {
 
 func BenchmarkGetNexus(b *testing.B) {
 	start := time.Now()
-	nexus, requests, err := setupNexusBench()
+	nexus, requests, err := setupNexusBench(nexus.TriggerCacheConfig{}, util.DefaultTextFormat, nexus.UserVectorConfig{})
 	setupDuration := time.Since(start)
 
 	if err != nil {
@@ -88,6 +118,47 @@ func BenchmarkGetNexus(b *testing.B) {
 	b.Logf("Setup completed in %v", setupDuration)
 	b.Logf("Setup rate: %.2f items/second", float64(SampleSize)/setupDuration.Seconds())
 
+	benchGetNexus(b, nexus, Tenant, requests)
+}
+
+// BenchmarkGetNexusTextFormats compares how often GetNexus finds the page stored for a similar user or trigger with each
+// text format users and triggers are serialized in, reported as %matched
+func BenchmarkGetNexusTextFormats(b *testing.B) {
+	for _, format := range []util.TextFormat{util.CleanedJSONFormat, util.KeyValueFormat, util.SentenceFormat} {
+		b.Run(string(format), func(b *testing.B) {
+			n, requests, err := setupNexusBench(nexus.TriggerCacheConfig{}, format, nexus.UserVectorConfig{})
+			if err != nil {
+				b.Fatalf("Setup failed: %v", err)
+			}
+			b.ReportMetric(benchGetNexus(b, n, benchTenant(format), requests), "%matched")
+		})
+	}
+}
+
+// BenchmarkGetNexusUserVectors compares GetNexus latency and how often it finds the page stored for a similar user or
+// trigger with users represented by their profile vector only and by a vector per interest facet, reported as %matched
+func BenchmarkGetNexusUserVectors(b *testing.B) {
+	benchmarks := []struct {
+		name        string
+		userVectors nexus.UserVectorConfig
+	}{
+		{name: "single", userVectors: nexus.UserVectorConfig{}},
+		{name: "multi", userVectors: nexus.UserVectorConfig{MultiVector: true}},
+	}
+
+	for _, bench := range benchmarks {
+		b.Run(bench.name, func(b *testing.B) {
+			n, requests, err := setupNexusBench(nexus.TriggerCacheConfig{}, util.DefaultTextFormat, bench.userVectors)
+			if err != nil {
+				b.Fatalf("Setup failed: %v", err)
+			}
+			b.ReportMetric(benchGetNexus(b, n, Tenant, requests), "%matched")
+		})
+	}
+}
+
+// benchGetNexus cycles GetNexus through a tenant's requests, logging and returning the percentage of requests whose page was found
+func benchGetNexus(b *testing.B, nexus *nexus.Nexus, tenant string, requests []api.NexusRequest) float64 {
 	var totalRequests int
 	var matchedRequests int
 
@@ -96,7 +167,7 @@ func BenchmarkGetNexus(b *testing.B) {
 		n := i % len(requests)
 		request := requests[n]
 
-		pages, err := nexus.GetNexus(context.Background(), request)
+		pages, err := nexus.GetNexus(context.Background(), tenant, request)
 		if err != nil {
 			b.Fatalf("GetNexus failed: %v", err)
 		}
@@ -127,4 +198,5 @@ func BenchmarkGetNexus(b *testing.B) {
 	matchPercentage := float64(matchedRequests) / float64(totalRequests) * 100
 	b.Logf("Page matching results: %d/%d requests found expected page (%.1f%%)",
 		matchedRequests, totalRequests, matchPercentage)
+	return matchPercentage
 }
@@ -58,7 +58,7 @@ func setupQdrantBench() (*qdrant.Client, [][]float32, error) {
 
 		// Store test page in Qdrant
 		page := model.CreateRandomPage(uint64(Seed + i*2))
-		payload := dao.NewQdrantPagePayload(page, 0, 0)
+		payload := dao.NewQdrantPagePayload(page, dao.PageSource{Kind: dao.UserSource, Text: cleanText}, "", 0, 0)
 
 		point := &qdrant.PointStruct{
 			Id:      qdrant.NewIDNum(uint64(i)),
@@ -145,7 +145,7 @@ func BenchmarkQdrantUpsert(b *testing.B) {
 	for i := 0; b.Loop(); i++ {
 		// Generate test data
 		page := model.CreateRandomPage(uint64(Seed + i))
-		payload := dao.NewQdrantPagePayload(page, 0, 0)
+		payload := dao.NewQdrantPagePayload(page, dao.PageSource{}, "", 0, 0)
 
 		// Use a real embedding from our precomputed cache
 		embedding := precomputedEmbeddings[i%len(precomputedEmbeddings)]
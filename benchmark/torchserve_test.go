@@ -3,6 +3,7 @@ package benchmark
 import (
 	"context"
 	"os"
+	"sync/atomic"
 	"testing"
 	"time"
 
@@ -97,3 +98,38 @@ func BenchmarkTorchServeBatch(b *testing.B) {
 		_ = embeddings
 	}
 }
+
+// BenchmarkTorchServeStreaming compares concurrent single-text embeddings over unary Predictions calls against
+// predictions multiplexed over StreamPredictions2 streams
+func BenchmarkTorchServeStreaming(b *testing.B) {
+	_, texts, err := setupTorchServeBench()
+	if err != nil {
+		b.Fatalf("Setup failed: %v", err)
+	}
+
+	for _, protocol := range []string{torchserve.GRPCProtocol, torchserve.StreamProtocol} {
+		b.Run(protocol, func(b *testing.B) {
+			client, err := torchserve.NewProtocolClient(protocol, os.Getenv("TORCHSERVE_HOST"), os.Getenv("MODEL"))
+			if err != nil {
+				b.Fatalf("Setup failed: %v", err)
+			}
+			defer client.Close()
+
+			var next atomic.Int64
+			b.RunParallel(func(pb *testing.PB) {
+				for pb.Next() {
+					text := texts[int(next.Add(1))%len(texts)]
+					embeddings, err := client.TextToEmbeddings(context.Background(), text)
+					if err != nil {
+						b.Errorf("TorchServe embedding failed: %v", err)
+						return
+					}
+					if len(embeddings) != 1 {
+						b.Errorf("Expected 1 embedding, got %d", len(embeddings))
+						return
+					}
+				}
+			})
+		})
+	}
+}
@@ -0,0 +1,42 @@
+package benchmark
+
+import (
+	"context"
+	"testing"
+
+	"github.com/dbrun3/nexus-vector/nexus"
+	"github.com/dbrun3/nexus-vector/util"
+)
+
+// BenchmarkGetNexusTriggerCache compares GetNexus latency with trigger embeddings computed by TorchServe on every
+// request against the in-process and Redis trigger embedding caches, cycling through recurring triggers
+func BenchmarkGetNexusTriggerCache(b *testing.B) {
+	for _, bench := range []struct {
+		name  string
+		cache nexus.TriggerCacheConfig
+	}{
+		{name: "uncached", cache: nexus.TriggerCacheConfig{Size: -1, TTL: -1}},
+		{name: "redis", cache: nexus.TriggerCacheConfig{Size: -1}},
+		{name: "memory", cache: nexus.TriggerCacheConfig{}},
+	} {
+		b.Run(bench.name, func(b *testing.B) {
+			n, requests, err := setupNexusBench(bench.cache, util.DefaultTextFormat, nexus.UserVectorConfig{})
+			if err != nil {
+				b.Fatalf("Setup failed: %v", err)
+			}
+
+			// Warm the caches with every trigger once
+			for _, request := range requests {
+				if _, err := n.GetNexus(context.Background(), Tenant, request); err != nil {
+					b.Fatalf("GetNexus failed: %v", err)
+				}
+			}
+
+			for i := 0; b.Loop(); i++ {
+				if _, err := n.GetNexus(context.Background(), Tenant, requests[i%len(requests)]); err != nil {
+					b.Fatalf("GetNexus failed: %v", err)
+				}
+			}
+		})
+	}
+}
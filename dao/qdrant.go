@@ -1,23 +1,61 @@
 package dao
 
 import (
+	"encoding/json"
+	"fmt"
 	"time"
 
 	"github.com/dbrun3/nexus-vector/model"
+	"github.com/qdrant/go-client/qdrant"
 )
 
+type SourceKind string
+
+const (
+	UserSource    SourceKind = "user"
+	TriggerSource SourceKind = "trigger"
+	// ContextSource pages are embedded with a blend of their trigger's and user's embeddings
+	ContextSource SourceKind = "context"
+)
+
+// PageSource is the text a page's embedding was derived from, kept so the page can be re-embedded by another model
+type PageSource struct {
+	Kind SourceKind `json:"kind"`
+	Text string     `json:"text"`
+
+	// Contextual pages blend the embeddings of the trigger Text and UserText, TriggerWeight being the trigger's share
+	UserText      string  `json:"user_text,omitempty"`
+	TriggerWeight float32 `json:"trigger_weight,omitempty"`
+}
+
+// Generation describes how a generated page was made, so pages can be compared by how they were generated
+type Generation struct {
+	PromptVersion string `json:"prompt_version,omitempty"`
+
+	// CandidateScore ranked the page among the candidates of its generation, 0 when they were not ranked
+	CandidateScore float32 `json:"candidate_score,omitempty"`
+
+	// QualityScore is the LLM judge's score from 0 to 1, 0 when the page was not judged
+	QualityScore float32 `json:"quality_score,omitempty"`
+}
+
 // QdrantPagePayload represents the structure stored in Qdrant for page documents
 type QdrantPagePayload struct {
-	Page      model.Page `json:"page"`
-	CreatedAt int64      `json:"created_at"`
-	From      int64      `json:"from"`
-	Until     int64      `json:"until"`
+	Page       model.Page `json:"page"`
+	Source     PageSource `json:"source"`
+	Generation Generation `json:"generation"`
+	Tenant     string     `json:"tenant"`
+	CreatedAt  int64      `json:"created_at"`
+	From       int64      `json:"from"`
+	Until      int64      `json:"until"`
 }
 
 // NewQdrantPagePayload creates a new payload with the current timestamp
-func NewQdrantPagePayload(page model.Page, from, until int64) QdrantPagePayload {
+func NewQdrantPagePayload(page model.Page, source PageSource, tenant string, from, until int64) QdrantPagePayload {
 	return QdrantPagePayload{
 		Page:      page,
+		Source:    source,
+		Tenant:    tenant,
 		CreatedAt: time.Now().Unix(),
 		From:      from,
 		Until:     until,
@@ -37,17 +75,154 @@ func (q QdrantPagePayload) ToMap() map[string]any {
 		subTitleSlice[i] = subTitle
 	}
 
+	page := map[string]any{
+		"id":            q.Page.Id,
+		"layout":        q.Page.Layout,
+		"type":          q.Page.Type,
+		"category":      q.Page.Category,
+		"title":         titleSlice,
+		"subTitle":      subTitleSlice,
+		"locale":        q.Page.Locale,
+		"schemaVersion": q.Page.SchemaVersion,
+	}
+	if q.Page.Content != nil {
+		page["content"] = contentToMap(q.Page.Content)
+	}
+
 	return map[string]any{
-		"page": map[string]any{
-			"id":       q.Page.Id,
-			"layout":   q.Page.Layout,
-			"type":     q.Page.Type,
-			"category": q.Page.Category,
-			"title":    titleSlice,
-			"subTitle": subTitleSlice,
+		"page":   page,
+		"source": sourceToMap(q.Source),
+		"generation": map[string]any{
+			"prompt_version":  q.Generation.PromptVersion,
+			"candidate_score": q.Generation.CandidateScore,
+			"quality_score":   q.Generation.QualityScore,
 		},
+		"tenant":     q.Tenant,
+		"locale":     q.Page.Locale, // top level so it can be indexed for filtering
 		"created_at": q.CreatedAt,
 		"from":       q.From,
 		"until":      q.Until,
 	}
 }
+
+// sourceToMap converts a page source to map[string]any for Qdrant storage, only contextual pages having a user text and weight
+func sourceToMap(source PageSource) map[string]any {
+	fields := map[string]any{
+		"kind": string(source.Kind),
+		"text": source.Text,
+	}
+	if source.Kind == ContextSource {
+		fields["user_text"] = source.UserText
+		fields["trigger_weight"] = source.TriggerWeight
+	}
+	return fields
+}
+
+// contentToMap converts page content to map[string]any for Qdrant storage, using the content's JSON field names
+func contentToMap(c *model.PageContent) map[string]any {
+	content := map[string]any{}
+	if c.CallToAction != nil {
+		content["callToAction"] = map[string]any{
+			"text":     c.CallToAction.Text,
+			"deepLink": c.CallToAction.DeepLink,
+		}
+	}
+	if c.ImageRef != "" {
+		content["imageRef"] = c.ImageRef
+	}
+	if c.Offer != nil {
+		content["offer"] = map[string]any{
+			"value":     c.Offer.Value,
+			"unit":      c.Offer.Unit,
+			"expiresAt": c.Offer.ExpiresAt,
+		}
+	}
+	if c.PointsCost != 0 {
+		content["pointsCost"] = c.PointsCost
+	}
+	if len(c.Items) > 0 {
+		items := make([]any, len(c.Items))
+		for i, item := range c.Items {
+			items[i] = map[string]any{
+				"title":    item.Title,
+				"subTitle": item.SubTitle,
+				"imageRef": item.ImageRef,
+				"deepLink": item.DeepLink,
+			}
+		}
+		content["items"] = items
+	}
+	if len(c.Questions) > 0 {
+		questions := make([]any, len(c.Questions))
+		for i, q := range c.Questions {
+			options := make([]any, len(q.Options))
+			for j, option := range q.Options {
+				options[j] = option
+			}
+			questions[i] = map[string]any{
+				"prompt":  q.Prompt,
+				"kind":    q.Kind,
+				"options": options,
+			}
+		}
+		content["questions"] = questions
+	}
+	return content
+}
+
+// ContentFromPayload reads a page's content back out of the page struct of a stored Qdrant payload, nil for pages without content
+func ContentFromPayload(fields map[string]*qdrant.Value) (*model.PageContent, error) {
+	value, ok := fields["content"]
+	if !ok || value.GetStructValue() == nil {
+		return nil, nil
+	}
+
+	data, err := json.Marshal(fromValue(value))
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal page content: %w", err)
+	}
+	var content model.PageContent
+	if err := json.Unmarshal(data, &content); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal page content: %w", err)
+	}
+	return &content, nil
+}
+
+// fromValue converts a Qdrant payload value back to its generic Go form
+func fromValue(value *qdrant.Value) any {
+	switch kind := value.GetKind().(type) {
+	case *qdrant.Value_BoolValue:
+		return kind.BoolValue
+	case *qdrant.Value_IntegerValue:
+		return kind.IntegerValue
+	case *qdrant.Value_DoubleValue:
+		return kind.DoubleValue
+	case *qdrant.Value_StringValue:
+		return kind.StringValue
+	case *qdrant.Value_StructValue:
+		fields := make(map[string]any, len(kind.StructValue.GetFields()))
+		for key, field := range kind.StructValue.GetFields() {
+			fields[key] = fromValue(field)
+		}
+		return fields
+	case *qdrant.Value_ListValue:
+		values := make([]any, len(kind.ListValue.GetValues()))
+		for i, v := range kind.ListValue.GetValues() {
+			values[i] = fromValue(v)
+		}
+		return values
+	default:
+		return nil
+	}
+}
+
+// SourceFromPayload reads the embedding source back out of a stored Qdrant payload
+func SourceFromPayload(payload map[string]*qdrant.Value) PageSource {
+	fields := payload["source"].GetStructValue().GetFields()
+	return PageSource{
+		Kind:          SourceKind(fields["kind"].GetStringValue()),
+		Text:          fields["text"].GetStringValue(),
+		UserText:      fields["user_text"].GetStringValue(),
+		TriggerWeight: float32(fields["trigger_weight"].GetDoubleValue()),
+	}
+}
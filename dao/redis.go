@@ -1,37 +1,135 @@
 package dao
 
 import (
+	"encoding/binary"
 	"encoding/json"
 	"fmt"
+	"math"
 )
 
-// EmbeddingFromRedis converts a JSON array string to []float32
+// EmbeddingEncoding is how embeddings are stored in Redis
+type EmbeddingEncoding string
+
+const (
+	JSONEncoding    EmbeddingEncoding = "json"    // JSON array text, the legacy encoding
+	Float32Encoding EmbeddingEncoding = "float32" // little-endian float32 values
+	Int8Encoding    EmbeddingEncoding = "int8"    // int8 values with a float32 scale, about a quarter of Float32Encoding's size
+
+	DefaultEmbeddingEncoding = Float32Encoding
+)
+
+// Version bytes prefixing binary encodings, which JSON values never start with
+const (
+	float32Version byte = 1
+	int8Version    byte = 2
+)
+
+// ParseEmbeddingEncoding returns a known encoding, DefaultEmbeddingEncoding when empty
+func ParseEmbeddingEncoding(s string) (EmbeddingEncoding, error) {
+	switch encoding := EmbeddingEncoding(s); encoding {
+	case "":
+		return DefaultEmbeddingEncoding, nil
+	case JSONEncoding, Float32Encoding, Int8Encoding:
+		return encoding, nil
+	}
+	return "", fmt.Errorf("unknown embedding encoding: %s", s)
+}
+
+// EmbeddingFromRedis decodes an embedding stored in any encoding
 // Example: "[1.5,2.3,0.8]" -> [1.5, 2.3, 0.8]
 func EmbeddingFromRedis(s string) ([]float32, error) {
+	embedding, _, err := ParseEmbedding(s)
+	return embedding, err
+}
+
+// ParseEmbedding decodes an embedding stored in any encoding, also returning the encoding
+func ParseEmbedding(s string) ([]float32, EmbeddingEncoding, error) {
 	if s == "" {
-		return []float32{}, nil
+		return []float32{}, JSONEncoding, nil
+	}
+
+	switch s[0] {
+	case float32Version:
+		data := []byte(s[1:])
+		if len(data)%4 != 0 {
+			return nil, Float32Encoding, fmt.Errorf("invalid float32 embedding length %d", len(data))
+		}
+		result := make([]float32, len(data)/4)
+		for i := range result {
+			result[i] = math.Float32frombits(binary.LittleEndian.Uint32(data[i*4:]))
+		}
+		return result, Float32Encoding, nil
+
+	case int8Version:
+		if len(s) < 5 {
+			return nil, Int8Encoding, fmt.Errorf("invalid int8 embedding length %d", len(s))
+		}
+		scale := math.Float32frombits(binary.LittleEndian.Uint32([]byte(s[1:5])))
+		data := s[5:]
+		result := make([]float32, len(data))
+		for i := range result {
+			result[i] = float32(int8(data[i])) * scale
+		}
+		return result, Int8Encoding, nil
 	}
 
 	var result []float32
 	err := json.Unmarshal([]byte(s), &result)
 	if err != nil {
-		return nil, fmt.Errorf("failed to unmarshal JSON: %w", err)
+		return nil, JSONEncoding, fmt.Errorf("failed to unmarshal JSON: %w", err)
 	}
 
-	return result, nil
+	return result, JSONEncoding, nil
 }
 
-// EmbeddingToRedis converts []float32 to a JSON array string
-// Example: [1.5, 2.3, 0.8] -> "[1.5,2.3,0.8]"
-func EmbeddingToRedis(arr []float32) (string, error) {
-	if len(arr) == 0 {
-		return "[]", nil
+// EmbeddingToRedis encodes an embedding, with DefaultEmbeddingEncoding when encoding is empty
+// Example: [1.5, 2.3, 0.8] -> "[1.5,2.3,0.8]" with JSONEncoding
+func EmbeddingToRedis(arr []float32, encoding EmbeddingEncoding) (string, error) {
+	if encoding == "" {
+		encoding = DefaultEmbeddingEncoding
 	}
 
-	data, err := json.Marshal(arr)
-	if err != nil {
-		return "", fmt.Errorf("failed to marshal JSON: %w", err)
+	switch encoding {
+	case Float32Encoding:
+		data := make([]byte, 1, 1+4*len(arr))
+		data[0] = float32Version
+		for _, v := range arr {
+			data = binary.LittleEndian.AppendUint32(data, math.Float32bits(v))
+		}
+		return string(data), nil
+
+	case Int8Encoding:
+		// Symmetric scalar quantisation, the largest magnitude mapping to 127
+		var maxAbs float32
+		for _, v := range arr {
+			maxAbs = max(maxAbs, float32(math.Abs(float64(v))))
+		}
+		scale := maxAbs / 127
+
+		data := make([]byte, 5, 5+len(arr))
+		data[0] = int8Version
+		binary.LittleEndian.PutUint32(data[1:], math.Float32bits(scale))
+		for _, v := range arr {
+			var q float64
+			if scale > 0 {
+				q = math.Round(float64(v / scale))
+			}
+			data = append(data, byte(int8(max(-127, min(127, q)))))
+		}
+		return string(data), nil
+
+	case JSONEncoding:
+		if len(arr) == 0 {
+			return "[]", nil
+		}
+
+		data, err := json.Marshal(arr)
+		if err != nil {
+			return "", fmt.Errorf("failed to marshal JSON: %w", err)
+		}
+
+		return string(data), nil
 	}
 
-	return string(data), nil
+	return "", fmt.Errorf("unknown embedding encoding: %s", encoding)
 }
@@ -0,0 +1,125 @@
+package dao
+
+import (
+	"math"
+	"math/rand/v2"
+	"testing"
+)
+
+// testEmbedding is a random unit-scale embedding like the ones TorchServe returns
+func testEmbedding(dimension int) []float32 {
+	r := rand.New(rand.NewPCG(1, 2))
+	embedding := make([]float32, dimension)
+	for i := range embedding {
+		embedding[i] = float32(r.NormFloat64() * 0.05)
+	}
+	return embedding
+}
+
+func TestEmbeddingRedisEncodings(t *testing.T) {
+	embedding := testEmbedding(384)
+
+	tests := []struct {
+		encoding  EmbeddingEncoding
+		tolerance float64
+	}{
+		{encoding: JSONEncoding},
+		{encoding: Float32Encoding},
+		{encoding: Int8Encoding, tolerance: 0.5 / 127}, // half a quantisation step of the largest magnitude
+	}
+
+	for _, tt := range tests {
+		t.Run(string(tt.encoding), func(t *testing.T) {
+			value, err := EmbeddingToRedis(embedding, tt.encoding)
+			if err != nil {
+				t.Fatalf("EmbeddingToRedis() error = %v", err)
+			}
+
+			decoded, encoding, err := ParseEmbedding(value)
+			if err != nil {
+				t.Fatalf("ParseEmbedding() error = %v", err)
+			}
+			if encoding != tt.encoding {
+				t.Errorf("ParseEmbedding() encoding = %s, expected %s", encoding, tt.encoding)
+			}
+			if len(decoded) != len(embedding) {
+				t.Fatalf("Expected %d dimensions, got %d", len(embedding), len(decoded))
+			}
+
+			var maxAbs float64
+			for _, v := range embedding {
+				maxAbs = max(maxAbs, math.Abs(float64(v)))
+			}
+			for i := range embedding {
+				if diff := math.Abs(float64(decoded[i] - embedding[i])); diff > tt.tolerance*maxAbs {
+					t.Fatalf("Value %d decoded as %v, expected %v", i, decoded[i], embedding[i])
+				}
+			}
+		})
+	}
+
+	// Binary encodings are far smaller than JSON
+	jsonValue, _ := EmbeddingToRedis(embedding, JSONEncoding)
+	float32Value, _ := EmbeddingToRedis(embedding, Float32Encoding)
+	int8Value, _ := EmbeddingToRedis(embedding, Int8Encoding)
+	if len(float32Value) != 1+4*384 || len(int8Value) != 5+384 || len(jsonValue) < 2*len(float32Value) {
+		t.Errorf("Unexpected sizes: json %d, float32 %d, int8 %d", len(jsonValue), len(float32Value), len(int8Value))
+	}
+}
+
+func TestEmbeddingFromRedis(t *testing.T) {
+	tests := []struct {
+		name     string
+		value    string
+		expected []float32
+		wantErr  bool
+	}{
+		{name: "legacy JSON", value: "[1.5,2.3,0.8]", expected: []float32{1.5, 2.3, 0.8}},
+		{name: "empty", value: "", expected: []float32{}},
+		{name: "zero int8 scale", value: "\x02\x00\x00\x00\x00\x05\xfb", expected: []float32{0, 0}},
+		{name: "truncated float32", value: "\x01\x00\x00\x80", wantErr: true},
+		{name: "truncated int8", value: "\x02\x00\x00", wantErr: true},
+		{name: "not an embedding", value: `[{"title": "page"}]`, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			embedding, err := EmbeddingFromRedis(tt.value)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("EmbeddingFromRedis() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if len(embedding) != len(tt.expected) {
+				t.Fatalf("EmbeddingFromRedis() = %v, expected %v", embedding, tt.expected)
+			}
+			for i := range embedding {
+				if embedding[i] != tt.expected[i] {
+					t.Errorf("EmbeddingFromRedis() = %v, expected %v", embedding, tt.expected)
+					break
+				}
+			}
+		})
+	}
+}
+
+// BenchmarkEmbeddingFromRedis compares decoding a 384 dimension embedding in each encoding
+func BenchmarkEmbeddingFromRedis(b *testing.B) {
+	embedding := testEmbedding(384)
+	for _, encoding := range []EmbeddingEncoding{JSONEncoding, Float32Encoding, Int8Encoding} {
+		b.Run(string(encoding), func(b *testing.B) {
+			value, err := EmbeddingToRedis(embedding, encoding)
+			if err != nil {
+				b.Fatalf("EmbeddingToRedis() error = %v", err)
+			}
+
+			for b.Loop() {
+				if _, err := EmbeddingFromRedis(value); err != nil {
+					b.Fatalf("EmbeddingFromRedis() error = %v", err)
+				}
+			}
+			b.ReportMetric(float64(len(value)), "bytes/value")
+		})
+	}
+}
@@ -0,0 +1,107 @@
+package handler
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+)
+
+// Reindex starts re-embedding all pages and user embeddings with the configured models in the background, after which
+// the page collection alias is swapped
+func (h *handler) Reindex(w http.ResponseWriter, r *http.Request) {
+	job, err := h.Nexus.StartReindex()
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to start reindex: %v", err), errorStatus(err, http.StatusInternalServerError))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	if err := json.NewEncoder(w).Encode(job); err != nil {
+		http.Error(w, fmt.Sprintf("Failed to encode response: %v", err), http.StatusInternalServerError)
+	}
+}
+
+// ReindexStatus reports the last reindex started, with its result once finished
+func (h *handler) ReindexStatus(w http.ResponseWriter, r *http.Request) {
+	job, ok := h.Nexus.ReindexStatus()
+	if !ok {
+		http.Error(w, "No reindex was started", http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	if err := json.NewEncoder(w).Encode(job); err != nil {
+		http.Error(w, fmt.Sprintf("Failed to encode response: %v", err), http.StatusInternalServerError)
+	}
+}
+
+// Status reports the day's LLM usage per tenant and generation role and whether generation is paused
+func (h *handler) Status(w http.ResponseWriter, r *http.Request) {
+	status, err := h.Nexus.GenerationStatus(r.Context(), r.URL.Query().Get("day"))
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to get status: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	if err := json.NewEncoder(w).Encode(status); err != nil {
+		http.Error(w, fmt.Sprintf("Failed to encode response: %v", err), http.StatusInternalServerError)
+	}
+}
+
+// ReloadPrompts reloads the prompt templates and reports the versions of every generation role
+func (h *handler) ReloadPrompts(w http.ResponseWriter, r *http.Request) {
+	versions, err := h.Nexus.ReloadPrompts()
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to reload prompts: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	if err := json.NewEncoder(w).Encode(versions); err != nil {
+		http.Error(w, fmt.Sprintf("Failed to encode response: %v", err), http.StatusInternalServerError)
+	}
+}
+
+// EmbeddingModels describes the configured embedding models and the versions TorchServe has registered
+func (h *handler) EmbeddingModels(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	if err := json.NewEncoder(w).Encode(h.Nexus.EmbeddingModels(r.Context())); err != nil {
+		http.Error(w, fmt.Sprintf("Failed to encode response: %v", err), http.StatusInternalServerError)
+	}
+}
+
+// EmbeddingDrift compares the statistics of recently sampled embeddings to their baselines
+func (h *handler) EmbeddingDrift(w http.ResponseWriter, r *http.Request) {
+	drifts, err := h.Nexus.EmbeddingDrift(r.Context())
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to compare embedding statistics: %v", err), errorStatus(err, http.StatusInternalServerError))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	if err := json.NewEncoder(w).Encode(drifts); err != nil {
+		http.Error(w, fmt.Sprintf("Failed to encode response: %v", err), http.StatusInternalServerError)
+	}
+}
+
+// ResetDriftBaselines makes the statistics of recently sampled embeddings the baselines drift is measured from
+func (h *handler) ResetDriftBaselines(w http.ResponseWriter, r *http.Request) {
+	drifts, err := h.Nexus.ResetDriftBaselines(r.Context())
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to reset drift baselines: %v", err), errorStatus(err, http.StatusInternalServerError))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	if err := json.NewEncoder(w).Encode(drifts); err != nil {
+		http.Error(w, fmt.Sprintf("Failed to encode response: %v", err), http.StatusInternalServerError)
+	}
+}
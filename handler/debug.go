@@ -32,9 +32,9 @@ func (h *handler) DebugBootstrap(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Generate users
-	userIds, err := h.Nexus.DebugBootstrap(r.Context(), count, seed)
+	userIds, err := h.Nexus.DebugBootstrap(r.Context(), tenantFromRequest(r), count, seed)
 	if err != nil {
-		http.Error(w, fmt.Sprintf("Failed to bootstrap users: %v", err), http.StatusInternalServerError)
+		http.Error(w, fmt.Sprintf("Failed to bootstrap users: %v", err), errorStatus(err, http.StatusInternalServerError))
 		return
 	}
 
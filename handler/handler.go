@@ -1,16 +1,21 @@
 package handler
 
 import (
+	"errors"
 	"net/http"
 
+	"github.com/dbrun3/nexus-vector/metrics"
 	"github.com/dbrun3/nexus-vector/nexus"
 )
 
+// TenantHeader names the tenant of requests that don't carry it in their path
+const TenantHeader = "X-Tenant-ID"
+
 type handler struct {
-	Nexus nexus.Nexus
+	Nexus *nexus.Nexus
 }
 
-func NewHandler(n nexus.Nexus) *handler {
+func NewHandler(n *nexus.Nexus) *handler {
 	return &handler{Nexus: n}
 }
 
@@ -20,8 +25,56 @@ func (h *handler) SetupRoutes() *http.ServeMux {
 	mux.HandleFunc("PUT /injest-user", h.InjestUser)
 	mux.HandleFunc("GET /user/{userId}", h.GetUserSnapshot)
 
+	// Tenant scoped endpoints
+	mux.HandleFunc("POST /tenants/{tenantId}/get-nexus", h.GetNexus)
+	mux.HandleFunc("PUT /tenants/{tenantId}/injest-user", h.InjestUser)
+	mux.HandleFunc("GET /tenants/{tenantId}/user/{userId}", h.GetUserSnapshot)
+
+	// Admin endpoints
+	mux.HandleFunc("POST /admin/reindex", h.Reindex)
+	mux.HandleFunc("GET /admin/reindex", h.ReindexStatus)
+	mux.HandleFunc("GET /admin/status", h.Status)
+	mux.HandleFunc("POST /admin/prompts/reload", h.ReloadPrompts)
+	mux.HandleFunc("GET /admin/models", h.EmbeddingModels)
+	mux.HandleFunc("GET /admin/drift", h.EmbeddingDrift)
+	mux.HandleFunc("POST /admin/drift/baseline", h.ResetDriftBaselines)
+	mux.Handle("GET /metrics", metrics.Handler())
+
 	// Debug endpoints
 	mux.HandleFunc("POST /debug/bootstrap", h.DebugBootstrap)
 
 	return mux
 }
+
+// tenantFromRequest returns the tenant a request is made for, taken from its path or header and otherwise the default tenant
+func tenantFromRequest(r *http.Request) string {
+	if tenant := r.PathValue("tenantId"); tenant != "" {
+		return tenant
+	}
+	if tenant := r.Header.Get(TenantHeader); tenant != "" {
+		return tenant
+	}
+	return nexus.DefaultTenant
+}
+
+// errorStatus returns the status for an error from Nexus, using fallback unless the error has a more specific one
+func errorStatus(err error, fallback int) int {
+	if errors.Is(err, nexus.ErrUnknownTenant) {
+		return http.StatusForbidden
+	}
+	if errors.Is(err, nexus.ErrInvalidUserId) || errors.Is(err, nexus.ErrUnknownEmbeddingModel) ||
+		errors.Is(err, nexus.ErrModelNotIndexed) {
+		return http.StatusBadRequest
+	}
+	if errors.Is(err, nexus.ErrReindexRunning) {
+		return http.StatusConflict
+	}
+	if errors.Is(err, nexus.ErrDriftDisabled) {
+		return http.StatusNotFound
+	}
+	// A model returned, or Redis holds, an embedding that would poison Qdrant
+	if errors.Is(err, nexus.ErrInvalidEmbedding) {
+		return http.StatusBadGateway
+	}
+	return fallback
+}
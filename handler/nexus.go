@@ -17,9 +17,9 @@ func (h *handler) GetNexus(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	pages, err := h.Nexus.GetNexus(r.Context(), request)
+	pages, err := h.Nexus.GetNexus(r.Context(), tenantFromRequest(r), request)
 	if err != nil {
-		http.Error(w, fmt.Sprintf("Failed to get pages: %v", err), http.StatusInternalServerError)
+		http.Error(w, fmt.Sprintf("Failed to get pages: %v", err), errorStatus(err, http.StatusInternalServerError))
 		return
 	}
 
@@ -48,13 +48,13 @@ func (h *handler) GetUserSnapshot(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Get user snapshot
-	userSnapshot, err := h.Nexus.GetUserSnapshot(r.Context(), userId)
+	userSnapshot, err := h.Nexus.GetUserSnapshot(r.Context(), tenantFromRequest(r), userId)
 	if err != nil {
 		if err.Error() == "MongoDB client not available (test environment)" {
 			http.Error(w, "User snapshots not available in test environment", http.StatusServiceUnavailable)
 			return
 		}
-		http.Error(w, fmt.Sprintf("Failed to get user snapshot: %v", err), http.StatusNotFound)
+		http.Error(w, fmt.Sprintf("Failed to get user snapshot: %v", err), errorStatus(err, http.StatusNotFound))
 		return
 	}
 
@@ -74,9 +74,9 @@ func (h *handler) InjestUser(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	_, err := h.Nexus.InjestUser(r.Context(), userSnapshot)
+	_, err := h.Nexus.InjestUser(r.Context(), tenantFromRequest(r), userSnapshot)
 	if err != nil {
-		http.Error(w, fmt.Sprintf("Failed to inject user: %v", err), http.StatusInternalServerError)
+		http.Error(w, fmt.Sprintf("Failed to inject user: %v", err), errorStatus(err, http.StatusInternalServerError))
 		return
 	}
 
@@ -38,13 +38,13 @@ func Test_MongoDB_Integration(t *testing.T) {
 	testSnapshot.ID = uuid.New().String() // Ensure unique ID for test
 
 	// Test store
-	err = client.StoreUserSnapshot(ctx, testSnapshot)
+	err = client.StoreUserSnapshot(ctx, "", testSnapshot)
 	if err != nil {
 		t.Fatalf("Failed to store user snapshot: %v", err)
 	}
 
 	// Test get
-	retrievedSnapshot, err := client.GetUserSnapshot(ctx, testSnapshot.ID)
+	retrievedSnapshot, err := client.GetUserSnapshot(ctx, "", testSnapshot.ID)
 	if err != nil {
 		t.Fatalf("Failed to get user snapshot: %v", err)
 	}
@@ -66,13 +66,13 @@ func Test_MongoDB_Integration(t *testing.T) {
 	}
 
 	// Clean up - delete the test snapshot
-	err = client.DeleteUserSnapshot(ctx, testSnapshot.ID)
+	err = client.DeleteUserSnapshot(ctx, "", testSnapshot.ID)
 	if err != nil {
 		t.Fatalf("Failed to delete user snapshot: %v", err)
 	}
 
 	// Verify deletion
-	deletedSnapshot, err := client.GetUserSnapshot(ctx, testSnapshot.ID)
+	deletedSnapshot, err := client.GetUserSnapshot(ctx, "", testSnapshot.ID)
 	if err != nil {
 		t.Fatalf("Error checking deleted snapshot: %v", err)
 	}
@@ -7,8 +7,10 @@ import (
 	"time"
 
 	"github.com/dbrun3/nexus-vector/api"
+	"github.com/dbrun3/nexus-vector/dao"
 	"github.com/dbrun3/nexus-vector/model"
 	"github.com/dbrun3/nexus-vector/nexus"
+	"github.com/dbrun3/nexus-vector/util"
 	"github.com/qdrant/go-client/qdrant"
 )
 
@@ -29,6 +31,7 @@ func Test_Nexus_Integration(t *testing.T) {
 		RedisHost:      os.Getenv("REDIS_HOST"),
 		TorchServeHost: os.Getenv("TORCHSERVE_HOST"),
 		ModelName:      os.Getenv("MODEL"),
+		LLM:            nexus.ProviderConfig{BaseURL: os.Getenv("LLM_BASE_URL")}, // e.g. a local stub server
 		Env:            nexus.Test,
 	}
 
@@ -41,7 +44,7 @@ func Test_Nexus_Integration(t *testing.T) {
 	testUser := model.CreateRandomSnapshot(12345)
 	testUser.ID = "test-user-integration"
 
-	embedding, err := n.InjestUser(ctx, testUser)
+	embedding, err := n.InjestUser(ctx, nexus.DefaultTenant, testUser)
 	if err != nil {
 		t.Fatalf("Failed to inject user: %v", err)
 	}
@@ -56,7 +59,14 @@ func Test_Nexus_Integration(t *testing.T) {
 	testPage := model.CreateRandomPage(67890)
 	testPage.Id = "test-page-integration"
 
-	err = n.StorePageInQdrant(ctx, testPage, embedding)
+	// InjestUser embeds the snapshot anonymously
+	anonymousUser := testUser
+	anonymousUser.ID = ""
+	userText, err := util.CleanUserSnapshotForEmbedding(anonymousUser)
+	if err != nil {
+		t.Fatalf("Failed to clean user snapshot: %v", err)
+	}
+	err = n.StorePageInQdrant(ctx, nexus.DefaultTenant, testPage, embedding, dao.PageSource{Kind: dao.UserSource, Text: userText})
 	if err != nil {
 		t.Fatalf("Failed to store page in Qdrant: %v", err)
 	}
@@ -71,7 +81,7 @@ func Test_Nexus_Integration(t *testing.T) {
 		Trigger: testTrigger,
 	}
 
-	pages, err := n.GetNexus(ctx, request)
+	pages, err := n.GetNexus(ctx, nexus.DefaultTenant, request)
 	if err != nil {
 		t.Fatalf("GetNexus failed: %v", err)
 	}
@@ -126,6 +136,7 @@ func Test_Nexus_Integration(t *testing.T) {
 	directResult, err := n.DebugQd().Query(ctx, &qdrant.QueryPoints{
 		CollectionName: "page_collection",
 		Query:          qdrant.NewQuery(embedding...),
+		Using:          qdrant.PtrOf(config.ModelName),
 		Limit:          qdrant.PtrOf(uint64(10)),
 		WithPayload:    qdrant.NewWithPayload(true),
 		// NO FILTERS - just see if the page exists at all
@@ -144,6 +155,7 @@ func Test_Nexus_Integration(t *testing.T) {
 	filteredResult, err := n.DebugQd().Query(ctx, &qdrant.QueryPoints{
 		CollectionName: "page_collection",
 		Query:          qdrant.NewQuery(embedding...),
+		Using:          qdrant.PtrOf(config.ModelName),
 		WithPayload:    qdrant.NewWithPayload(true),
 		Filter: &qdrant.Filter{
 			Must: []*qdrant.Condition{
@@ -165,4 +177,30 @@ func Test_Nexus_Integration(t *testing.T) {
 	if len(filteredResult) > 0 {
 		t.Logf("First filtered result score: %.4f", filteredResult[0].Score)
 	}
+
+	// Test 8: Reindex with the same model and verify the page survives the alias swap
+	reindexResult, err := n.Reindex(ctx)
+	if err != nil {
+		t.Fatalf("Reindex failed: %v", err)
+	}
+	if reindexResult.PagesReindexed == 0 {
+		t.Fatal("Expected Reindex to copy at least the test page")
+	}
+
+	reindexedResult, err := n.DebugQd().Query(ctx, &qdrant.QueryPoints{
+		CollectionName: "page_collection",
+		Query:          qdrant.NewQuery(embedding...),
+		Using:          qdrant.PtrOf(config.ModelName),
+		Limit:          qdrant.PtrOf(uint64(1)),
+	})
+	if err != nil {
+		t.Fatalf("Query after reindex failed: %v", err)
+	}
+	if len(reindexedResult) == 0 || reindexedResult[0].Score < 0.99 {
+		t.Fatal("Expected the test page to be found with the same embedding after reindex")
+	}
+
+	for _, collection := range reindexResult.Collections {
+		t.Logf("Reindexed %s into %s (previously %s)", collection.Alias, collection.Collection, collection.PreviousCollection)
+	}
 }
@@ -3,7 +3,6 @@ package integration
 import (
 	"context"
 	"encoding/json"
-	"fmt"
 	"os"
 	"strings"
 	"testing"
@@ -27,6 +26,12 @@ func Test_OpenAI_Prompt_Integration(t *testing.T) {
 		option.WithAPIKey(os.Getenv("OPENAI_API_KEY")),
 	)
 
+	// Embedded prompt templates at their default version
+	prompts, err := nexus.LoadPrompts("")
+	if err != nil {
+		t.Fatalf("Failed to load prompts: %v", err)
+	}
+
 	// Test data
 	testUser := model.CreateRandomSnapshot(12345)
 	testTrigger := model.CreateRandomTrigger(67890)
@@ -38,10 +43,15 @@ func Test_OpenAI_Prompt_Integration(t *testing.T) {
 			t.Fatalf("Failed to marshal trigger: %v", err)
 		}
 
+		prompt, err := prompts.Render(nexus.TriggerRole, nexus.DefaultPromptVersion, nexus.PromptData{Input: string(triggerJSON), Locale: "en", Language: "English"})
+		if err != nil {
+			t.Fatalf("Failed to render trigger prompt: %v", err)
+		}
+
 		// Call OpenAI with sync prompt
 		chatCompletion, err := oaClient.Chat.Completions.New(ctx, openai.ChatCompletionNewParams{
 			Messages: []openai.ChatCompletionMessageParamUnion{
-				openai.UserMessage(fmt.Sprintf("%s\n\nTrigger Context: %s", nexus.SyncPrompt, string(triggerJSON))),
+				openai.UserMessage(prompt),
 			},
 			Model: openai.ChatModelGPT4o,
 		})
@@ -76,6 +86,11 @@ func Test_OpenAI_Prompt_Integration(t *testing.T) {
 			t.Error("SyncPrompt response missing 'subTitle' field")
 		}
 
+		page.SchemaVersion = model.PageSchemaVersion
+		if err := page.Validate(); err != nil {
+			t.Errorf("SyncPrompt response does not match the page schema: %v", err)
+		}
+
 		t.Logf("SyncPrompt successfully generated valid Page: Layout=%s, Type=%s, Category=%s",
 			page.Layout, page.Type, page.Category)
 	})
@@ -87,10 +102,15 @@ func Test_OpenAI_Prompt_Integration(t *testing.T) {
 			t.Fatalf("Failed to marshal user snapshot: %v", err)
 		}
 
+		prompt, err := prompts.Render(nexus.UserRole, nexus.DefaultPromptVersion, nexus.PromptData{Input: string(userJSON), Locale: "en", Language: "English"})
+		if err != nil {
+			t.Fatalf("Failed to render user prompt: %v", err)
+		}
+
 		// Call OpenAI with async prompt
 		chatCompletion, err := oaClient.Chat.Completions.New(ctx, openai.ChatCompletionNewParams{
 			Messages: []openai.ChatCompletionMessageParamUnion{
-				openai.UserMessage(fmt.Sprintf("%s\n\nUser Profile: %s", nexus.AsyncPrompt, string(userJSON))),
+				openai.UserMessage(prompt),
 			},
 			Model: openai.ChatModelGPT4o,
 		})
@@ -125,6 +145,11 @@ func Test_OpenAI_Prompt_Integration(t *testing.T) {
 			t.Error("AsyncPrompt response missing 'subTitle' field")
 		}
 
+		page.SchemaVersion = model.PageSchemaVersion
+		if err := page.Validate(); err != nil {
+			t.Errorf("AsyncPrompt response does not match the page schema: %v", err)
+		}
+
 		t.Logf("AsyncPrompt successfully generated valid Page: Layout=%s, Type=%s, Category=%s",
 			page.Layout, page.Type, page.Category)
 	})
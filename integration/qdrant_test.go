@@ -119,3 +119,74 @@ func Test_Qdrant_Integration(t *testing.T) {
 
 	t.Logf("Qdrant search successful, score: %f, verified correct payload returned", searchResult[0].Score)
 }
+
+func Test_Qdrant_LegacyAliasMigration(t *testing.T) {
+	qdrantHost := os.Getenv("QDRANT_HOST")
+	if qdrantHost == "" {
+		t.Skip("QDRANT_HOST not set, skipping integration test")
+	}
+
+	ctx := context.Background()
+
+	// A collection stored under the alias name before aliases existed
+	alias := "test_legacy_page_collection"
+	client, err := qdrant_util.NewClient(ctx, qdrantHost, alias, 3)
+	if err != nil {
+		t.Fatalf("Failed to create Qdrant client: %v", err)
+	}
+	legacyVector := []float32{1.0, 2.0, 3.0}
+	_, err = client.Upsert(ctx, &qdrant.UpsertPoints{
+		CollectionName: alias,
+		Points: []*qdrant.PointStruct{{
+			Id:      qdrant.NewID(uuid.New().String()),
+			Vectors: qdrant.NewVectors(legacyVector...),
+			Payload: qdrant.NewValueMap(map[string]any{"test_field": "legacy"}),
+		}},
+		Wait: qdrant.PtrOf(true),
+	})
+	if err != nil {
+		t.Fatalf("Failed to upsert legacy point: %v", err)
+	}
+
+	collection := qdrant_util.VersionedName(alias)
+	if err := qdrant_util.CreateNamedCollection(ctx, client, collection, map[string]uint64{"model": 3}); err != nil {
+		t.Fatalf("Failed to create collection: %v", err)
+	}
+
+	previous, err := qdrant_util.SwapAlias(ctx, client, alias, collection)
+	defer func() {
+		client.DeleteAlias(ctx, alias)
+		client.DeleteCollection(ctx, alias)
+		client.DeleteCollection(ctx, collection)
+		if previous != "" {
+			client.DeleteCollection(ctx, previous)
+		}
+	}()
+	if err != nil {
+		t.Fatalf("SwapAlias failed: %v", err)
+	}
+
+	current, err := qdrant_util.ResolveAlias(ctx, client, alias)
+	if err != nil || current != collection {
+		t.Fatalf("Expected %s to alias %s, got %q (%v)", alias, collection, current, err)
+	}
+
+	// The legacy pages are kept with their vectors in the previous collection
+	if previous == "" || previous == alias {
+		t.Fatalf("Expected the legacy collection to be copied, previous is %q", previous)
+	}
+	points, err := client.Scroll(ctx, &qdrant.ScrollPoints{
+		CollectionName: previous,
+		WithPayload:    qdrant.NewWithPayload(true),
+		WithVectors:    qdrant.NewWithVectors(true),
+	})
+	if err != nil {
+		t.Fatalf("Failed to scroll %s: %v", previous, err)
+	}
+	if len(points) != 1 || points[0].Payload["test_field"].GetStringValue() != "legacy" {
+		t.Fatalf("Expected the legacy point in %s, got %v", previous, points)
+	}
+	if data := qdrant_util.DenseData(points[0].GetVectors().GetVector()); len(data) != 3 || data[2] != legacyVector[2] {
+		t.Fatalf("Expected the legacy vector %v, got %v", legacyVector, data)
+	}
+}
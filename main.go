@@ -1,7 +1,17 @@
 package main
 
-import "github.com/dbrun3/nexus-vector/application"
+import (
+	"os"
+	"slices"
+
+	"github.com/dbrun3/nexus-vector/application"
+)
 
 func main() {
+	// `nexus-vector migrate-embeddings [--dry-run]` re-encodes stored embeddings instead of serving
+	if len(os.Args) > 1 && os.Args[1] == "migrate-embeddings" {
+		application.MigrateEmbeddings(slices.Contains(os.Args[2:], "--dry-run"))
+		return
+	}
 	application.Run()
 }
@@ -0,0 +1,177 @@
+package metrics
+
+import (
+	"net/http"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const namespace = "nexus"
+
+// LLM usage and generation control
+var (
+	LLMRequests = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "llm_requests_total",
+		Help:      "Chat completion and moderation requests by tenant and generation role.",
+	}, []string{"tenant", "role"})
+
+	LLMTokens = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "llm_tokens_total",
+		Help:      "Chat completion tokens by tenant, generation role and kind (prompt or completion).",
+	}, []string{"tenant", "role", "kind"})
+
+	LLMCost = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "llm_cost_usd_total",
+		Help:      "Estimated chat completion cost in USD by tenant and generation role.",
+	}, []string{"tenant", "role"})
+
+	GenerationsSkipped = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "generations_skipped_total",
+		Help:      "Background generations skipped by reason (tenant_limit, global_rate_limit, user_rate_limit, budget, circuit_open).",
+	}, []string{"reason"})
+
+	LLMRetries = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "llm_retries_total",
+		Help:      "Retried chat completion requests by generation role and reason (rate_limited, server_error, network).",
+	}, []string{"role", "reason"})
+
+	LLMCircuitState = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "llm_circuit_state",
+		Help:      "State of each generation role's LLM circuit breaker (0 closed, 1 open, 2 half open).",
+	}, []string{"role"})
+
+	FallbackPages = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "fallback_pages_served_total",
+		Help:      "Requests served curated template pages while page generation was unavailable, by tenant.",
+	}, []string{"tenant"})
+
+	GenerationsShared = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "generations_shared_total",
+		Help:      "Generations not repeated because identical input was generated recently (cached) or is being generated (in_flight).",
+	}, []string{"role", "reason"})
+
+	GenerationCandidates = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "generation_candidates_total",
+		Help:      "Generated candidate pages by generation role and outcome (kept, dropped, duplicate, invalid).",
+	}, []string{"role", "outcome"})
+
+	JudgeScores = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "judge_quality_score",
+		Help:      "Quality scores from 0 to 1 the LLM judge gave generated pages by generation role.",
+		Buckets:   prometheus.LinearBuckets(0.1, 0.1, 10),
+	}, []string{"role"})
+
+	JudgeVerdicts = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "judge_verdicts_total",
+		Help:      "LLM judge verdicts on generated pages by generation role and verdict (passed, rejected, error).",
+	}, []string{"role", "verdict"})
+
+	SafetyDecisions = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "safety_decisions_total",
+		Help:      "Content safety decisions on generated pages by generation role, rule and action (reject, redact, error).",
+	}, []string{"role", "rule", "action"})
+
+	GenerationPaused = promauto.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "generation_paused",
+		Help:      "1 while generation is paused because the daily LLM budget is spent.",
+	})
+)
+
+// Embeddings
+var (
+	TriggerEmbeddingCache = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "trigger_embedding_cache_total",
+		Help:      "Trigger embedding cache lookups by embedding model and result (memory_hit, redis_hit, miss).",
+	}, []string{"model", "result"})
+
+	InvalidEmbeddings = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "invalid_embeddings_total",
+		Help:      "Embeddings rejected by validation, by embedding model, origin (torchserve, redis) and kind (dimension, nan, inf, zero).",
+	}, []string{"model", "origin", "kind"})
+
+	UserVectors = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "user_vectors",
+		Help:      "User vectors pages are queried with per request, by embedding model.",
+		Buckets:   prometheus.LinearBuckets(1, 1, 8),
+	}, []string{"model"})
+
+	EmbeddingDriftScore = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "embedding_drift_score",
+		Help:      "Largest shift of recently sampled embedding statistics from their baseline, by embedding model and group (user or trigger type).",
+	}, []string{"model", "group"})
+
+	EmbeddingCentroidShift = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "embedding_centroid_shift",
+		Help:      "Cosine distance between the centroid of recently sampled embeddings and their baseline's, by embedding model and group.",
+	}, []string{"model", "group"})
+
+	EmbeddingMeanNorm = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "embedding_mean_norm",
+		Help:      "Mean norm of recently sampled embeddings, by embedding model and group.",
+	}, []string{"model", "group"})
+
+	EmbeddingPairwiseSimilarity = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "embedding_pairwise_similarity",
+		Help:      "Mean cosine similarity between recently sampled embeddings, by embedding model and group.",
+	}, []string{"model", "group"})
+
+	TorchServeBatchTexts = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "torchserve_batch_texts",
+		Help:      "Texts per TorchServe prediction sent by the micro-batcher, by embedding model.",
+		Buckets:   prometheus.ExponentialBuckets(1, 2, 8),
+	}, []string{"model"})
+
+	TorchServeBatchCalls = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "torchserve_batch_calls",
+		Help:      "TextToEmbeddings calls coalesced into each TorchServe prediction, by embedding model.",
+		Buckets:   prometheus.ExponentialBuckets(1, 2, 8),
+	}, []string{"model"})
+
+	TorchServeStreamReconnects = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "torchserve_stream_reconnects_total",
+		Help:      "StreamPredictions2 streams reopened after breaking.",
+	})
+
+	TorchServeCanarySimilarity = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "torchserve_canary_similarity",
+		Help:      "Cosine similarity of shadowed canary embeddings to the served ones, by embedding model and canary version.",
+		Buckets:   []float64{0.5, 0.8, 0.9, 0.95, 0.98, 0.99, 0.995, 0.999, 1},
+	}, []string{"model", "canary"})
+
+	TorchServeCanaryErrors = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "torchserve_canary_errors_total",
+		Help:      "Failed shadow predictions on canary versions, by embedding model and canary version.",
+	}, []string{"model", "canary"})
+)
+
+// Handler serves every registered metric in the Prometheus exposition format
+func Handler() http.Handler {
+	return promhttp.Handler()
+}
@@ -0,0 +1,185 @@
+package model
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"slices"
+	"time"
+)
+
+// PageSchemaVersion is the version of the page schema pages are generated with. Pages without a version predate
+// PageContent and only carry their titles
+const PageSchemaVersion = 2
+
+var (
+	Layouts    = []string{"card", "banner", "list", "grid", "carousel", "modal"}
+	PageTypes  = []string{"offer", "reward", "recommendation", "notification", "promotion", "survey"}
+	Categories = []string{"groceries", "electronics", "clothing", "restaurants", "beauty", "home", "automotive", "health", "books", "sports"}
+	OfferUnits = []string{"percent", "currency", "points"}
+	// QuestionKinds are the survey question kinds, single and multiple choice questions offer Options
+	QuestionKinds = []string{"single", "multiple", "text", "rating"}
+)
+
+var ErrInvalidPage = errors.New("invalid page")
+
+// PageContent is the typed content a client renders a page with, which fields are required depends on the page's Layout and Type
+type PageContent struct {
+	CallToAction *CallToAction    `json:"callToAction,omitempty"`
+	ImageRef     string           `json:"imageRef,omitempty"` // asset key or URL of the page's image
+	Offer        *Offer           `json:"offer,omitempty"`
+	PointsCost   int              `json:"pointsCost,omitempty"`
+	Items        []CarouselItem   `json:"items,omitempty"`     // carousel layout only
+	Questions    []SurveyQuestion `json:"questions,omitempty"` // survey type only
+}
+
+type CallToAction struct {
+	Text     string `json:"text"`
+	DeepLink string `json:"deepLink"` // app deep link or URL opened by the call to action
+}
+
+type Offer struct {
+	Value     float64 `json:"value"`
+	Unit      string  `json:"unit"`                // percent, currency, points
+	ExpiresAt string  `json:"expiresAt,omitempty"` // RFC 3339 date or timestamp
+}
+
+type CarouselItem struct {
+	Title    string `json:"title"`
+	SubTitle string `json:"subTitle,omitempty"`
+	ImageRef string `json:"imageRef,omitempty"`
+	DeepLink string `json:"deepLink,omitempty"`
+}
+
+type SurveyQuestion struct {
+	Prompt  string   `json:"prompt"`
+	Kind    string   `json:"kind"` // single, multiple, text, rating
+	Options []string `json:"options,omitempty"`
+}
+
+// Validate checks a page against the schema of its Layout and Type. Pages predating PageContent only need a known
+// layout and type
+func (p Page) Validate() error {
+	if !slices.Contains(Layouts, p.Layout) {
+		return fmt.Errorf("%w: unknown layout %q", ErrInvalidPage, p.Layout)
+	}
+	if !slices.Contains(PageTypes, p.Type) {
+		return fmt.Errorf("%w: unknown type %q", ErrInvalidPage, p.Type)
+	}
+	if p.SchemaVersion < PageSchemaVersion {
+		return nil
+	}
+	if len(p.Title) == 0 {
+		return fmt.Errorf("%w: no title", ErrInvalidPage)
+	}
+	if p.Content == nil {
+		return fmt.Errorf("%w: no content", ErrInvalidPage)
+	}
+	c := p.Content
+
+	if c.CallToAction != nil {
+		if c.CallToAction.Text == "" {
+			return fmt.Errorf("%w: call to action has no text", ErrInvalidPage)
+		}
+		if err := validateLink(c.CallToAction.DeepLink); err != nil {
+			return fmt.Errorf("%w: call to action %v", ErrInvalidPage, err)
+		}
+	}
+
+	switch p.Type {
+	case "offer", "promotion":
+		if c.CallToAction == nil {
+			return fmt.Errorf("%w: %s has no call to action", ErrInvalidPage, p.Type)
+		}
+		if c.Offer == nil {
+			return fmt.Errorf("%w: %s has no offer", ErrInvalidPage, p.Type)
+		}
+	case "reward":
+		if c.PointsCost <= 0 {
+			return fmt.Errorf("%w: reward has no points cost", ErrInvalidPage)
+		}
+	case "survey":
+		if len(c.Questions) == 0 {
+			return fmt.Errorf("%w: survey has no questions", ErrInvalidPage)
+		}
+	}
+	if p.Type != "survey" && len(c.Questions) > 0 {
+		return fmt.Errorf("%w: questions on a %s page", ErrInvalidPage, p.Type)
+	}
+	if c.PointsCost < 0 {
+		return fmt.Errorf("%w: negative points cost", ErrInvalidPage)
+	}
+
+	if c.Offer != nil {
+		if err := c.Offer.validate(); err != nil {
+			return fmt.Errorf("%w: offer %v", ErrInvalidPage, err)
+		}
+	}
+	for i, q := range c.Questions {
+		if err := q.validate(); err != nil {
+			return fmt.Errorf("%w: question %d %v", ErrInvalidPage, i, err)
+		}
+	}
+
+	if p.Layout == "carousel" {
+		if len(c.Items) < 2 {
+			return fmt.Errorf("%w: carousel needs at least 2 items", ErrInvalidPage)
+		}
+	} else if len(c.Items) > 0 {
+		return fmt.Errorf("%w: items on a %s layout", ErrInvalidPage, p.Layout)
+	}
+	for i, item := range c.Items {
+		if item.Title == "" {
+			return fmt.Errorf("%w: item %d has no title", ErrInvalidPage, i)
+		}
+		if item.DeepLink != "" {
+			if err := validateLink(item.DeepLink); err != nil {
+				return fmt.Errorf("%w: item %d %v", ErrInvalidPage, i, err)
+			}
+		}
+	}
+
+	return nil
+}
+
+func (o Offer) validate() error {
+	if o.Value <= 0 {
+		return errors.New("has no value")
+	}
+	if !slices.Contains(OfferUnits, o.Unit) {
+		return fmt.Errorf("has unknown unit %q", o.Unit)
+	}
+	if o.Unit == "percent" && o.Value > 100 {
+		return errors.New("is more than 100 percent")
+	}
+	if o.ExpiresAt != "" {
+		if _, err := time.Parse(time.RFC3339, o.ExpiresAt); err != nil {
+			if _, err := time.Parse(time.DateOnly, o.ExpiresAt); err != nil {
+				return fmt.Errorf("has invalid expiry %q", o.ExpiresAt)
+			}
+		}
+	}
+	return nil
+}
+
+func (q SurveyQuestion) validate() error {
+	if q.Prompt == "" {
+		return errors.New("has no prompt")
+	}
+	if !slices.Contains(QuestionKinds, q.Kind) {
+		return fmt.Errorf("has unknown kind %q", q.Kind)
+	}
+	if (q.Kind == "single" || q.Kind == "multiple") && len(q.Options) < 2 {
+		return errors.New("needs at least 2 options")
+	}
+	return nil
+}
+
+// validateLink checks a deep link or URL has a scheme, e.g. "app://offers/123" or "https://example.com"
+func validateLink(link string) error {
+	u, err := url.Parse(link)
+	if err != nil || u.Scheme == "" {
+		return fmt.Errorf("has invalid deep link %q", link)
+	}
+	return nil
+}
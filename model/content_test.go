@@ -0,0 +1,95 @@
+package model
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestPageValidate(t *testing.T) {
+	cta := &CallToAction{Text: "Shop now", DeepLink: "app://offers/123"}
+
+	tests := []struct {
+		name  string
+		page  Page
+		valid bool
+	}{
+		{
+			name:  "legacy page without content",
+			page:  Page{Layout: "card", Type: "offer", Title: []string{"Deal"}},
+			valid: true,
+		},
+		{
+			name:  "unknown layout",
+			page:  Page{Layout: "popup", Type: "offer"},
+			valid: false,
+		},
+		{
+			name: "offer with call to action",
+			page: Page{Layout: "card", Type: "offer", Title: []string{"Deal"}, SchemaVersion: PageSchemaVersion, Content: &PageContent{
+				CallToAction: cta,
+				Offer:        &Offer{Value: 20, Unit: "percent", ExpiresAt: "2026-12-31"},
+			}},
+			valid: true,
+		},
+		{
+			name: "offer without offer value",
+			page: Page{Layout: "card", Type: "offer", Title: []string{"Deal"}, SchemaVersion: PageSchemaVersion, Content: &PageContent{
+				CallToAction: cta,
+			}},
+			valid: false,
+		},
+		{
+			name: "offer with invalid deep link",
+			page: Page{Layout: "card", Type: "offer", Title: []string{"Deal"}, SchemaVersion: PageSchemaVersion, Content: &PageContent{
+				CallToAction: &CallToAction{Text: "Shop now", DeepLink: "offers/123"},
+				Offer:        &Offer{Value: 5, Unit: "currency"},
+			}},
+			valid: false,
+		},
+		{
+			name:  "reward without points cost",
+			page:  Page{Layout: "banner", Type: "reward", Title: []string{"Reward"}, SchemaVersion: PageSchemaVersion, Content: &PageContent{}},
+			valid: false,
+		},
+		{
+			name: "carousel with one item",
+			page: Page{Layout: "carousel", Type: "recommendation", Title: []string{"Picks"}, SchemaVersion: PageSchemaVersion, Content: &PageContent{
+				Items: []CarouselItem{{Title: "Coffee"}},
+			}},
+			valid: false,
+		},
+		{
+			name: "carousel with items",
+			page: Page{Layout: "carousel", Type: "recommendation", Title: []string{"Picks"}, SchemaVersion: PageSchemaVersion, Content: &PageContent{
+				Items: []CarouselItem{{Title: "Coffee"}, {Title: "Tea", DeepLink: "app://items/tea"}},
+			}},
+			valid: true,
+		},
+		{
+			name: "survey with choice question missing options",
+			page: Page{Layout: "modal", Type: "survey", Title: []string{"Tell us"}, SchemaVersion: PageSchemaVersion, Content: &PageContent{
+				Questions: []SurveyQuestion{{Prompt: "Favorite store?", Kind: "single", Options: []string{"Target"}}},
+			}},
+			valid: false,
+		},
+		{
+			name: "survey",
+			page: Page{Layout: "modal", Type: "survey", Title: []string{"Tell us"}, SchemaVersion: PageSchemaVersion, Content: &PageContent{
+				Questions: []SurveyQuestion{{Prompt: "How was your trip?", Kind: "rating"}},
+			}},
+			valid: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.page.Validate()
+			if tt.valid && err != nil {
+				t.Errorf("Expected valid page, got %v", err)
+			}
+			if !tt.valid && !errors.Is(err, ErrInvalidPage) {
+				t.Errorf("Expected ErrInvalidPage, got %v", err)
+			}
+		})
+	}
+}
@@ -9,6 +9,10 @@ type Page struct {
 	Category string   `json:"category"`
 	Title    []string `json:"title"`
 	SubTitle []string `json:"subTitle"`
+	Locale   string   `json:"locale,omitempty"` // language of Title and SubTitle, e.g. "en" or "es-mx"
+
+	SchemaVersion int          `json:"schemaVersion,omitempty"`
+	Content       *PageContent `json:"content,omitempty"`
 }
 
 // CreateRandomPage generates a randomized Page with predefined values
@@ -57,8 +57,8 @@ func NewClient(host, user, pass string) (*Client, error) {
 		db:     db,
 	}
 
-	// Ensure UserSnapshot collection exists
-	if err := mongoClient.ensureUserSnapshotCollection(ctx); err != nil {
+	// Ensure the default tenant's UserSnapshot collection exists
+	if err := mongoClient.EnsureTenant(ctx, ""); err != nil {
 		client.Disconnect(ctx)
 		return nil, fmt.Errorf("failed to ensure UserSnapshot collection: %w", err)
 	}
@@ -71,10 +71,23 @@ func (c *Client) Close(ctx context.Context) error {
 	return c.client.Disconnect(ctx)
 }
 
-// ensureUserSnapshotCollection creates the UserSnapshot collection if it doesn't exist
-func (c *Client) ensureUserSnapshotCollection(ctx context.Context) error {
+// userSnapshotCollection returns the name of a tenant's UserSnapshot collection, the default tenant being ""
+func userSnapshotCollection(tenant string) string {
+	if tenant == "" {
+		return UserSnapshotCollection
+	}
+	return tenant + "_" + UserSnapshotCollection
+}
+
+// EnsureTenant creates a tenant's UserSnapshot collection if it doesn't exist
+func (c *Client) EnsureTenant(ctx context.Context, tenant string) error {
+	return c.ensureUserSnapshotCollection(ctx, userSnapshotCollection(tenant))
+}
+
+// ensureUserSnapshotCollection creates a UserSnapshot collection if it doesn't exist
+func (c *Client) ensureUserSnapshotCollection(ctx context.Context, name string) error {
 	// Check if collection already exists
-	collections, err := c.db.ListCollectionNames(ctx, bson.M{"name": UserSnapshotCollection})
+	collections, err := c.db.ListCollectionNames(ctx, bson.M{"name": name})
 	if err != nil {
 		return fmt.Errorf("failed to list collections: %w", err)
 	}
@@ -111,13 +124,13 @@ func (c *Client) ensureUserSnapshotCollection(ctx context.Context) error {
 		},
 	})
 
-	err = c.db.CreateCollection(ctx, UserSnapshotCollection, collectionOptions)
+	err = c.db.CreateCollection(ctx, name, collectionOptions)
 	if err != nil {
 		return fmt.Errorf("failed to create UserSnapshot collection: %w", err)
 	}
 
 	// Create index on ID field for faster queries
-	collection := c.db.Collection(UserSnapshotCollection)
+	collection := c.db.Collection(name)
 	indexModel := mongo.IndexModel{
 		Keys:    bson.D{{Key: "id", Value: 1}},
 		Options: options.Index().SetUnique(true),
@@ -131,9 +144,9 @@ func (c *Client) ensureUserSnapshotCollection(ctx context.Context) error {
 	return nil
 }
 
-// StoreUserSnapshot stores a new UserSnapshot document
-func (c *Client) StoreUserSnapshot(ctx context.Context, snapshot model.UserSnapshot) error {
-	collection := c.db.Collection(UserSnapshotCollection)
+// StoreUserSnapshot stores a new UserSnapshot document for a tenant
+func (c *Client) StoreUserSnapshot(ctx context.Context, tenant string, snapshot model.UserSnapshot) error {
+	collection := c.db.Collection(userSnapshotCollection(tenant))
 
 	_, err := collection.InsertOne(ctx, snapshot)
 	if err != nil {
@@ -143,9 +156,9 @@ func (c *Client) StoreUserSnapshot(ctx context.Context, snapshot model.UserSnaps
 	return nil
 }
 
-// GetUserSnapshot retrieves a UserSnapshot by ID
-func (c *Client) GetUserSnapshot(ctx context.Context, id string) (*model.UserSnapshot, error) {
-	collection := c.db.Collection(UserSnapshotCollection)
+// GetUserSnapshot retrieves a tenant's UserSnapshot by ID
+func (c *Client) GetUserSnapshot(ctx context.Context, tenant string, id string) (*model.UserSnapshot, error) {
+	collection := c.db.Collection(userSnapshotCollection(tenant))
 
 	var snapshot model.UserSnapshot
 	err := collection.FindOne(ctx, bson.M{"id": id}).Decode(&snapshot)
@@ -159,9 +172,9 @@ func (c *Client) GetUserSnapshot(ctx context.Context, id string) (*model.UserSna
 	return &snapshot, nil
 }
 
-// UpdateUserSnapshot updates an existing UserSnapshot
-func (c *Client) UpdateUserSnapshot(ctx context.Context, snapshot model.UserSnapshot) error {
-	collection := c.db.Collection(UserSnapshotCollection)
+// UpdateUserSnapshot updates an existing UserSnapshot of a tenant
+func (c *Client) UpdateUserSnapshot(ctx context.Context, tenant string, snapshot model.UserSnapshot) error {
+	collection := c.db.Collection(userSnapshotCollection(tenant))
 
 	filter := bson.M{"id": snapshot.ID}
 	update := bson.M{"$set": snapshot}
@@ -178,9 +191,9 @@ func (c *Client) UpdateUserSnapshot(ctx context.Context, snapshot model.UserSnap
 	return nil
 }
 
-// DeleteUserSnapshot deletes a UserSnapshot by ID
-func (c *Client) DeleteUserSnapshot(ctx context.Context, id string) error {
-	collection := c.db.Collection(UserSnapshotCollection)
+// DeleteUserSnapshot deletes a tenant's UserSnapshot by ID
+func (c *Client) DeleteUserSnapshot(ctx context.Context, tenant string, id string) error {
+	collection := c.db.Collection(userSnapshotCollection(tenant))
 
 	result, err := collection.DeleteOne(ctx, bson.M{"id": id})
 	if err != nil {
@@ -193,3 +206,30 @@ func (c *Client) DeleteUserSnapshot(ctx context.Context, id string) error {
 
 	return nil
 }
+
+// ForEachUserSnapshot calls fn for every UserSnapshot stored for a tenant, stopping at the first error
+func (c *Client) ForEachUserSnapshot(ctx context.Context, tenant string, fn func(model.UserSnapshot) error) error {
+	collection := c.db.Collection(userSnapshotCollection(tenant))
+
+	cursor, err := collection.Find(ctx, bson.M{})
+	if err != nil {
+		return fmt.Errorf("failed to list UserSnapshots: %w", err)
+	}
+	defer cursor.Close(ctx)
+
+	for cursor.Next(ctx) {
+		var snapshot model.UserSnapshot
+		if err := cursor.Decode(&snapshot); err != nil {
+			return fmt.Errorf("failed to decode UserSnapshot: %w", err)
+		}
+		if err := fn(snapshot); err != nil {
+			return err
+		}
+	}
+
+	if err := cursor.Err(); err != nil {
+		return fmt.Errorf("failed to iterate UserSnapshots: %w", err)
+	}
+
+	return nil
+}
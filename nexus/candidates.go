@@ -0,0 +1,122 @@
+package nexus
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+
+	"github.com/dbrun3/nexus-vector/dao"
+	"github.com/dbrun3/nexus-vector/metrics"
+	"github.com/dbrun3/nexus-vector/model"
+)
+
+// Outcomes of a generated candidate page
+const (
+	CandidateKept      = "kept"
+	CandidateDropped   = "dropped"
+	CandidateDuplicate = "duplicate"
+	CandidateInvalid   = "invalid"
+)
+
+// generatedPage is a page ready to be stored with how it was generated
+type generatedPage struct {
+	page       model.Page
+	generation dao.Generation
+}
+
+// candidates returns how many candidate pages each generation produces and how many of the best are kept, both
+// defaulting to 1 and at most every candidate being kept
+func (c *Config) candidates() (int, int) {
+	count := max(c.Candidates, 1)
+	keep := max(c.KeepCandidates, 1)
+	return count, min(keep, count)
+}
+
+// bestCandidates picks the pages to store from a generation's candidates. Duplicates of a better candidate's copy are
+// dropped, and when there are more candidates than are kept, they are ranked by how close an embedding of their copy is
+// to the embedding the pages are stored with
+func (n *Nexus) bestCandidates(ctx context.Context, role GenerationRole, embeddingModel string, embedding []float32, pages []model.Page, generation dao.Generation) ([]generatedPage, error) {
+	var scores []float32
+	if len(pages) > n.keepCandidates {
+		texts := make([]string, len(pages))
+		for i, page := range pages {
+			texts[i] = pageCopy(page)
+		}
+		embeddings, err := n.embedTexts(ctx, embeddingModel, texts...)
+		if err != nil {
+			return nil, fmt.Errorf("failed to embed candidate pages: %w", err)
+		}
+		scores = make([]float32, len(pages))
+		for i := range pages {
+			scores[i] = cosineSimilarity(embeddings[i], embedding)
+		}
+	}
+
+	kept, duplicates := rankCandidates(pages, scores, n.keepCandidates)
+	metrics.GenerationCandidates.WithLabelValues(string(role), CandidateKept).Add(float64(len(kept)))
+	metrics.GenerationCandidates.WithLabelValues(string(role), CandidateDuplicate).Add(float64(duplicates))
+	metrics.GenerationCandidates.WithLabelValues(string(role), CandidateDropped).Add(float64(len(pages) - len(kept) - duplicates))
+
+	best := make([]generatedPage, len(kept))
+	for i, index := range kept {
+		best[i] = generatedPage{page: pages[index], generation: generation}
+		if scores != nil {
+			best[i].generation.CandidateScore = scores[index]
+		}
+	}
+	return best, nil
+}
+
+// rankCandidates returns the indexes of the best keep pages by descending score (in order when scores is nil),
+// skipping pages whose copy repeats a better page's, and how many were skipped as duplicates
+func rankCandidates(pages []model.Page, scores []float32, keep int) ([]int, int) {
+	order := make([]int, len(pages))
+	for i := range order {
+		order[i] = i
+	}
+	if scores != nil {
+		sort.SliceStable(order, func(i, j int) bool {
+			return scores[order[i]] > scores[order[j]]
+		})
+	}
+
+	kept := make([]int, 0, keep)
+	seen := make(map[string]bool, len(pages))
+	duplicates := 0
+	for _, index := range order {
+		text := strings.ToLower(pageCopy(pages[index]))
+		if seen[text] {
+			duplicates++
+			continue
+		}
+		seen[text] = true
+		if len(kept) < keep {
+			kept = append(kept, index)
+		}
+	}
+	return kept, duplicates
+}
+
+// pageCopy is the text a page shows its user
+func pageCopy(page model.Page) string {
+	return strings.Join(append(append([]string{}, page.Title...), page.SubTitle...), ". ")
+}
+
+// cosineSimilarity returns the cosine similarity of two vectors, 0 when either is empty or zero
+func cosineSimilarity(a, b []float32) float32 {
+	if len(a) != len(b) {
+		return 0
+	}
+	var dot, normA, normB float64
+	for i := range a {
+		dot += float64(a[i]) * float64(b[i])
+		normA += float64(a[i]) * float64(a[i])
+		normB += float64(b[i]) * float64(b[i])
+	}
+	if normA == 0 || normB == 0 {
+		return 0
+	}
+	return float32(dot / (math.Sqrt(normA) * math.Sqrt(normB)))
+}
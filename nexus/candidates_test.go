@@ -0,0 +1,72 @@
+package nexus
+
+import (
+	"slices"
+	"testing"
+
+	"github.com/dbrun3/nexus-vector/model"
+)
+
+func TestRankCandidates(t *testing.T) {
+	pages := []model.Page{
+		{Title: []string{"Fresh Picks"}},
+		{Title: []string{"Weekend Deals"}},
+		{Title: []string{"fresh picks"}},
+		{Title: []string{"Coffee Rewards"}},
+	}
+
+	tests := []struct {
+		name       string
+		scores     []float32
+		keep       int
+		expected   []int
+		duplicates int
+	}{
+		{
+			name:       "unscored keeps generation order",
+			keep:       4,
+			expected:   []int{0, 1, 3},
+			duplicates: 1,
+		},
+		{
+			name:       "best scores are kept",
+			scores:     []float32{0.5, 0.7, 0.9, 0.8},
+			keep:       2,
+			expected:   []int{2, 3},
+			duplicates: 1,
+		},
+		{
+			name:       "duplicates of a better candidate are skipped",
+			scores:     []float32{0.9, 0.1, 0.8, 0.7},
+			keep:       3,
+			expected:   []int{0, 3, 1},
+			duplicates: 1,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			kept, duplicates := rankCandidates(pages, tt.scores, tt.keep)
+			if !slices.Equal(kept, tt.expected) || duplicates != tt.duplicates {
+				t.Errorf("rankCandidates() = %v, %d duplicates, expected %v, %d", kept, duplicates, tt.expected, tt.duplicates)
+			}
+		})
+	}
+}
+
+func TestConfigCandidates(t *testing.T) {
+	tests := []struct {
+		config      Config
+		count, keep int
+	}{
+		{Config{}, 1, 1},
+		{Config{Candidates: 4}, 4, 1},
+		{Config{Candidates: 4, KeepCandidates: 2}, 4, 2},
+		{Config{Candidates: 2, KeepCandidates: 5}, 2, 2},
+	}
+	for _, tt := range tests {
+		if count, keep := tt.config.candidates(); count != tt.count || keep != tt.keep {
+			t.Errorf("candidates() of %+v = %d, %d, expected %d, %d", tt.config, count, keep, tt.count, tt.keep)
+		}
+	}
+}
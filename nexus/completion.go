@@ -0,0 +1,221 @@
+package nexus
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/dbrun3/nexus-vector/metrics"
+	"github.com/dbrun3/nexus-vector/model"
+	"github.com/dbrun3/nexus-vector/util"
+	"github.com/openai/openai-go/v2"
+	"github.com/openai/openai-go/v2/shared"
+)
+
+// OutputMode is how page generation asks the LLM for JSON, from most to least constrained
+type OutputMode string
+
+const (
+	// SchemaOutput constrains output to the page JSON schema (structured outputs)
+	SchemaOutput OutputMode = "json_schema"
+	// JSONObjectOutput constrains output to any JSON object, for servers without schema support
+	JSONObjectOutput OutputMode = "json_object"
+	// PromptOutput relies on the prompt alone, for servers without any response format support
+	PromptOutput OutputMode = "prompt"
+)
+
+var outputModes = []OutputMode{SchemaOutput, JSONObjectOutput, PromptOutput}
+
+// OutputModeRetry is how long a provider that rejected an output mode is asked for less constrained output before the
+// configured mode is tried again, e.g. once the server was upgraded
+const OutputModeRetry = 10 * time.Minute
+
+var (
+	ErrRefused   = errors.New("model refused to generate a page")
+	ErrTruncated = errors.New("model output was truncated")
+)
+
+// pageSchema is the structured output schema of a generated page, leaving out the fields Nexus sets itself
+var pageSchema = util.JSONSchema(model.Page{}, util.SchemaOptions{
+	Enums: map[string][]string{
+		"layout":                 model.Layouts,
+		"type":                   model.PageTypes,
+		"category":               model.Categories,
+		"content.offer.unit":     model.OfferUnits,
+		"content.questions.kind": model.QuestionKinds,
+	},
+	Omit: []string{"id", "locale", "schemaVersion"},
+})
+
+// outputModeIndex returns the index of a configured output mode in outputModes, defaulting to SchemaOutput
+func outputModeIndex(mode OutputMode) (int32, error) {
+	if mode == "" {
+		return 0, nil
+	}
+	for i, m := range outputModes {
+		if m == mode {
+			return int32(i), nil
+		}
+	}
+	return 0, fmt.Errorf("unknown output mode: %s", mode)
+}
+
+// complete asks the role's provider for count choices of a prompt, constraining the output to a JSON schema as far as
+// the provider allows, and records the usage. Every request, retries included, counts against the rate limits of
+// userId (none when empty). When the provider doesn't support the current output mode's response format, it falls
+// back to the next less constrained mode for OutputModeRetry
+func (n *Nexus) complete(ctx context.Context, tenant, userId string, role GenerationRole, prompt string, count int, name string, schema map[string]any) (*openai.ChatCompletion, error) {
+	g := n.generators[role]
+	for {
+		index := g.currentOutputMode(role)
+		mode := outputModes[index]
+
+		params := openai.ChatCompletionNewParams{
+			Messages: []openai.ChatCompletionMessageParamUnion{
+				openai.UserMessage(prompt),
+			},
+			Model: g.model,
+		}
+		if count > 1 {
+			params.N = openai.Int(int64(count))
+		}
+		switch mode {
+		case SchemaOutput:
+			params.ResponseFormat.OfJSONSchema = &shared.ResponseFormatJSONSchemaParam{
+				JSONSchema: shared.ResponseFormatJSONSchemaJSONSchemaParam{
+					Name:   name,
+					Strict: openai.Bool(true),
+					Schema: schema,
+				},
+			}
+		case JSONObjectOutput:
+			params.ResponseFormat.OfJSONObject = &shared.ResponseFormatJSONObjectParam{}
+		}
+
+		chatCompletion, err := g.chatCompletion(ctx, role, params, func(ctx context.Context) error {
+			return n.reserveRequest(ctx, tenant, userId)
+		})
+		if err != nil {
+			if mode != PromptOutput && unsupportedResponseFormat(err) {
+				if g.outputMode.CompareAndSwap(index, index+1) {
+					g.downgradedAt.Store(time.Now().UnixNano())
+					log.Printf("Background: %s LLM server rejected %s output, falling back to %s: %v", role, mode, outputModes[index+1], err)
+				}
+				continue
+			}
+			return nil, fmt.Errorf("%s LLM API error: %w", role, err)
+		}
+
+		if err := n.recordUsage(ctx, tenant, role, g, chatCompletion.Usage); err != nil {
+			log.Printf("Background: %v", err)
+		}
+		return chatCompletion, nil
+	}
+}
+
+// currentOutputMode returns the index in outputModes of the output mode to request, going back to the configured mode
+// once OutputModeRetry passed since the provider rejected a more constrained one
+func (g *generator) currentOutputMode(role GenerationRole) int32 {
+	index := g.outputMode.Load()
+	if index == g.configuredMode || time.Since(time.Unix(0, g.downgradedAt.Load())) < OutputModeRetry {
+		return index
+	}
+	if g.outputMode.CompareAndSwap(index, g.configuredMode) {
+		log.Printf("Background: %s LLM retrying %s output", role, outputModes[g.configuredMode])
+	}
+	return g.outputMode.Load()
+}
+
+// completePages generates up to count of a tenant's candidate pages from a prompt with the role's provider, decoding
+// every choice into a model.Page. Choices that fail to decode are dropped, the first error being returned when none
+// decode. Servers that ignore the n parameter are asked again for the missing candidates
+func (n *Nexus) completePages(ctx context.Context, tenant, userId string, role GenerationRole, prompt string, count int) ([]model.Page, error) {
+	pages := make([]model.Page, 0, count)
+	var firstErr error
+
+	for requests, choices := 0, 0; choices < count && requests < count; requests++ {
+		chatCompletion, err := n.complete(ctx, tenant, userId, role, prompt, count-choices, "page", pageSchema)
+		if err != nil {
+			return nil, err
+		}
+
+		if len(chatCompletion.Choices) == 0 {
+			if firstErr == nil {
+				firstErr = fmt.Errorf("OpenAI API returned no choices")
+			}
+			continue
+		}
+		for _, choice := range chatCompletion.Choices {
+			choices++
+			page, err := decodePage(choice)
+			if err != nil {
+				metrics.GenerationCandidates.WithLabelValues(string(role), CandidateInvalid).Inc()
+				if firstErr == nil {
+					firstErr = err
+				}
+				if count > 1 {
+					log.Printf("Background: Dropped %s candidate: %v", role, err)
+				}
+				continue
+			}
+			pages = append(pages, page)
+		}
+	}
+
+	if len(pages) == 0 {
+		return nil, firstErr
+	}
+	return pages, nil
+}
+
+// decodePage decodes the page of a chat completion choice, reporting refusals and truncated output
+func decodePage(choice openai.ChatCompletionChoice) (model.Page, error) {
+	content, err := choiceContent(choice)
+	if err != nil {
+		return model.Page{}, err
+	}
+	return parsePage(content)
+}
+
+// choiceContent returns the content of a chat completion choice, reporting refusals and truncated output
+func choiceContent(choice openai.ChatCompletionChoice) (string, error) {
+	if choice.Message.Refusal != "" {
+		return "", fmt.Errorf("%w: %s", ErrRefused, choice.Message.Refusal)
+	}
+	switch choice.FinishReason {
+	case "length":
+		return "", ErrTruncated
+	case "content_filter":
+		return "", fmt.Errorf("%w: content filtered", ErrRefused)
+	}
+	return choice.Message.Content, nil
+}
+
+// unsupportedPhrases are how servers say they lack a capability, unlike errors in a supported response format such as
+// an invalid schema
+var unsupportedPhrases = []string{"not supported", "unsupported", "does not support", "not available", "unknown", "unrecognized", "not implemented"}
+
+// unsupportedResponseFormat reports whether an API error rejected the request's response format as unsupported
+func unsupportedResponseFormat(err error) bool {
+	var apiErr *openai.Error
+	if !errors.As(err, &apiErr) {
+		return false
+	}
+	if apiErr.StatusCode != http.StatusBadRequest && apiErr.StatusCode != http.StatusUnprocessableEntity {
+		return false
+	}
+	message := strings.ToLower(apiErr.RawJSON())
+	if apiErr.Param != "response_format" && !strings.Contains(message, "response_format") && !strings.Contains(message, "json_schema") {
+		return false
+	}
+	for _, phrase := range unsupportedPhrases {
+		if strings.Contains(message, phrase) {
+			return true
+		}
+	}
+	return false
+}
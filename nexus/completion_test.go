@@ -0,0 +1,271 @@
+package nexus
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+const testPageJSON = `{"layout":"card","type":"recommendation","category":"groceries","title":["Fresh Picks"],"subTitle":["For you"],"content":{"callToAction":null,"imageRef":"","offer":null,"pointsCost":0,"items":[],"questions":[]}}`
+
+// stubCompletion answers chat completion requests with content and finishReason, rejecting response formats in rejected
+func stubCompletion(t *testing.T, content, finishReason, refusal string, rejected ...string) (*Nexus, *[]string) {
+	t.Helper()
+	var formats []string
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var request struct {
+			ResponseFormat struct {
+				Type string `json:"type"`
+			} `json:"response_format"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+			t.Errorf("Failed to decode request: %v", err)
+		}
+		format := request.ResponseFormat.Type
+		formats = append(formats, format)
+
+		w.Header().Set("Content-Type", "application/json")
+		for _, f := range rejected {
+			if f == format {
+				w.WriteHeader(http.StatusBadRequest)
+				json.NewEncoder(w).Encode(map[string]any{
+					"error": map[string]any{"message": "response_format " + format + " is not supported", "type": "invalid_request_error"},
+				})
+				return
+			}
+		}
+
+		json.NewEncoder(w).Encode(map[string]any{
+			"id":      "chatcmpl-test",
+			"object":  "chat.completion",
+			"created": 0,
+			"model":   "gpt-4o",
+			"choices": []any{map[string]any{
+				"index":         0,
+				"finish_reason": finishReason,
+				"message":       map[string]any{"role": "assistant", "content": content, "refusal": refusal},
+			}},
+		})
+	}))
+	t.Cleanup(server.Close)
+
+	generators, err := newGenerators(&Config{LLM: ProviderConfig{BaseURL: server.URL, APIKey: "test"}})
+	if err != nil {
+		t.Fatalf("newGenerators() error = %v", err)
+	}
+	return &Nexus{generators: generators, rdClient: unreachableRedis()}, &formats
+}
+
+// unreachableRedis returns a Redis client that fails fast, usage recording errors only being logged
+func unreachableRedis() *redis.Client {
+	return redis.NewClient(&redis.Options{Addr: "127.0.0.1:1", MaxRetries: -1})
+}
+
+func TestCompletePage(t *testing.T) {
+	n, formats := stubCompletion(t, testPageJSON, "stop", "")
+
+	pages, err := n.completePages(context.Background(), DefaultTenant, "", UserRole, "prompt", 1)
+	if err != nil {
+		t.Fatalf("completePages() error = %v", err)
+	}
+	if page := pages[0]; page.Layout != "card" || page.Title[0] != "Fresh Picks" || page.Content == nil {
+		t.Errorf("Unexpected page %+v", page)
+	}
+	if (*formats)[0] != string(SchemaOutput) {
+		t.Errorf("Expected a %s request, got %q", SchemaOutput, (*formats)[0])
+	}
+}
+
+func TestCompletePage_FallsBackWithoutSchemaSupport(t *testing.T) {
+	n, formats := stubCompletion(t, "```json\n"+testPageJSON+"\n```", "stop", "", string(SchemaOutput), string(JSONObjectOutput))
+
+	if _, err := n.completePages(context.Background(), DefaultTenant, "", UserRole, "prompt", 1); err != nil {
+		t.Fatalf("completePages() error = %v", err)
+	}
+	if _, err := n.completePages(context.Background(), DefaultTenant, "", UserRole, "prompt", 1); err != nil {
+		t.Fatalf("completePages() error = %v", err)
+	}
+
+	// The second page goes straight to the mode that worked
+	expected := []string{string(SchemaOutput), string(JSONObjectOutput), "", ""}
+	if len(*formats) != len(expected) {
+		t.Fatalf("Expected requests %v, got %v", expected, *formats)
+	}
+	for i := range expected {
+		if (*formats)[i] != expected[i] {
+			t.Errorf("Expected requests %v, got %v", expected, *formats)
+			break
+		}
+	}
+}
+
+func TestCompletePage_RetriesSchemaOutput(t *testing.T) {
+	n, formats := stubCompletion(t, "```json\n"+testPageJSON+"\n```", "stop", "", string(SchemaOutput))
+
+	if _, err := n.completePages(context.Background(), DefaultTenant, "", UserRole, "prompt", 1); err != nil {
+		t.Fatalf("completePages() error = %v", err)
+	}
+
+	// The rejected mode is tried again once OutputModeRetry passed
+	n.generators[UserRole].downgradedAt.Store(time.Now().Add(-OutputModeRetry).UnixNano())
+	if _, err := n.completePages(context.Background(), DefaultTenant, "", UserRole, "prompt", 1); err != nil {
+		t.Fatalf("completePages() error = %v", err)
+	}
+	expected := []string{string(SchemaOutput), string(JSONObjectOutput), string(SchemaOutput), string(JSONObjectOutput)}
+	if !slices.Equal(*formats, expected) {
+		t.Errorf("Expected requests %v, got %v", expected, *formats)
+	}
+}
+
+func TestCompletePage_InvalidSchema(t *testing.T) {
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]any{"error": map[string]any{
+			"message": "Invalid schema for response_format 'page': 'title' is required",
+			"type":    "invalid_request_error",
+			"param":   "response_format",
+		}})
+	}))
+	defer server.Close()
+
+	generators, err := newGenerators(&Config{LLM: ProviderConfig{BaseURL: server.URL, APIKey: "test"}})
+	if err != nil {
+		t.Fatalf("newGenerators() error = %v", err)
+	}
+	n := &Nexus{generators: generators, rdClient: unreachableRedis()}
+
+	// A supported response format with a bad schema fails instead of downgrading the provider
+	if _, err := n.completePages(context.Background(), DefaultTenant, "", UserRole, "prompt", 1); err == nil {
+		t.Fatal("Expected an error")
+	}
+	if requests != 1 || generators[UserRole].outputMode.Load() != 0 {
+		t.Errorf("Expected a single request in %s mode, got %d requests and mode %s", SchemaOutput, requests, outputModes[generators[UserRole].outputMode.Load()])
+	}
+}
+
+func TestCompletePage_Refused(t *testing.T) {
+	n, _ := stubCompletion(t, "", "stop", "I can't help with that")
+
+	if _, err := n.completePages(context.Background(), DefaultTenant, "", UserRole, "prompt", 1); !errors.Is(err, ErrRefused) {
+		t.Errorf("Expected ErrRefused, got %v", err)
+	}
+}
+
+func TestCompletePage_Truncated(t *testing.T) {
+	n, _ := stubCompletion(t, testPageJSON[:40], "length", "")
+
+	if _, err := n.completePages(context.Background(), DefaultTenant, "", UserRole, "prompt", 1); !errors.Is(err, ErrTruncated) {
+		t.Errorf("Expected ErrTruncated, got %v", err)
+	}
+}
+
+func TestProviderPerRole(t *testing.T) {
+	type received struct {
+		model, header string
+	}
+	var requests []received
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var request struct {
+			Model string `json:"model"`
+		}
+		json.NewDecoder(r.Body).Decode(&request)
+		requests = append(requests, received{model: request.Model, header: r.Header.Get("X-Deployment")})
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]any{
+			"choices": []any{map[string]any{
+				"finish_reason": "stop",
+				"message":       map[string]any{"role": "assistant", "content": testPageJSON},
+			}},
+		})
+	}))
+	defer server.Close()
+
+	generators, err := newGenerators(&Config{
+		LLM: ProviderConfig{
+			BaseURL: server.URL,
+			Model:   "llama-3.1-8b-instruct",
+			Timeout: time.Second,
+			Headers: map[string]string{"X-Deployment": "shared"},
+		},
+		Providers: map[GenerationRole]ProviderConfig{
+			TriggerRole: {Model: "qwen2.5-7b-instruct", Headers: map[string]string{"X-Deployment": "trigger"}},
+		},
+	})
+	if err != nil {
+		t.Fatalf("newGenerators() error = %v", err)
+	}
+	n := &Nexus{generators: generators, rdClient: unreachableRedis()}
+
+	for _, role := range []GenerationRole{UserRole, TriggerRole} {
+		if _, err := n.completePages(context.Background(), DefaultTenant, "", role, "prompt", 1); err != nil {
+			t.Fatalf("completePages(%s) error = %v", role, err)
+		}
+	}
+
+	expected := []received{
+		{model: "llama-3.1-8b-instruct", header: "shared"},
+		{model: "qwen2.5-7b-instruct", header: "trigger"},
+	}
+	if len(requests) != len(expected) || requests[0] != expected[0] || requests[1] != expected[1] {
+		t.Errorf("Expected requests %+v, got %+v", expected, requests)
+	}
+}
+
+func TestCompletePages_Candidates(t *testing.T) {
+	var requested []int
+
+	// The server answers with at most two choices, the second one invalid
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var request struct {
+			N int `json:"n"`
+		}
+		json.NewDecoder(r.Body).Decode(&request)
+		requested = append(requested, request.N)
+
+		choices := []any{map[string]any{
+			"finish_reason": "stop",
+			"message":       map[string]any{"role": "assistant", "content": testPageJSON},
+		}}
+		if request.N > 1 {
+			choices = append(choices, map[string]any{
+				"finish_reason": "stop",
+				"message":       map[string]any{"role": "assistant", "content": `{"layout":"card"}`},
+			})
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]any{"choices": choices})
+	}))
+	defer server.Close()
+
+	generators, err := newGenerators(&Config{LLM: ProviderConfig{BaseURL: server.URL, APIKey: "test"}})
+	if err != nil {
+		t.Fatalf("newGenerators() error = %v", err)
+	}
+	n := &Nexus{generators: generators, rdClient: unreachableRedis()}
+
+	pages, err := n.completePages(context.Background(), DefaultTenant, "", TriggerRole, "prompt", 3)
+	if err != nil {
+		t.Fatalf("completePages() error = %v", err)
+	}
+	if len(pages) != 2 {
+		t.Errorf("Expected 2 valid candidates, got %d", len(pages))
+	}
+
+	// The candidate missing from the first answer is asked for again
+	if len(requested) != 2 || requested[0] != 3 || requested[1] != 0 {
+		t.Errorf("Expected requests for n=3 then a single choice, got %v", requested)
+	}
+}
@@ -1,5 +1,15 @@
 package nexus
 
+import (
+	"net"
+	"net/url"
+	"time"
+
+	"github.com/dbrun3/nexus-vector/dao"
+	"github.com/dbrun3/nexus-vector/torchserve"
+	"github.com/dbrun3/nexus-vector/util"
+)
+
 type Env string
 
 const Test Env = "test"
@@ -7,8 +17,48 @@ const Prod Env = "prod"
 
 // Config holds all configuration parameters for initializing Nexus
 type Config struct {
-	// OpenAI configuration
-	OpenAIKey string
+	// OpenAI configuration, OutputMode defaulting to SchemaOutput
+	OpenAIKey  string
+	OutputMode OutputMode
+
+	// LLM configures the OpenAI-compatible server pages are generated with, Providers overriding it per generation role
+	LLM       ProviderConfig
+	Providers map[GenerationRole]ProviderConfig
+	Limits    GenerationLimits
+
+	// Retry and Breaker make chat completion requests resilient to rate limiting and provider outages
+	Retry   RetryConfig
+	Breaker BreakerConfig
+
+	// GenerationCacheWindow is how long pages generated from identical input are not generated again, negative
+	// disabling it. Defaults to DefaultGenerationCacheWindow
+	GenerationCacheWindow time.Duration
+
+	// Candidates is how many candidate pages each generation produces per role, the best KeepCandidates of them
+	// being stored. Both default to 1
+	Candidates     int
+	KeepCandidates int
+
+	// Judge scores generated pages before they are stored, dropping those below its threshold
+	Judge JudgeConfig
+
+	// Context generates pages for a user and trigger together, stored under a blend of their embeddings
+	Context ContextConfig
+
+	// UserVectors also represents users by a vector per interest facet, queried along with their profile vector
+	UserVectors UserVectorConfig
+
+	// Safety checks the copy of generated pages, rejecting or redacting offending pages
+	Safety SafetyConfig
+
+	// PromptDir holds the prompt templates (see Prompts), the embedded ones being used when empty.
+	// PromptVersions selects each generation role's version, defaulting to DefaultPromptVersion
+	PromptDir      string
+	PromptVersions map[GenerationRole]string
+
+	// FallbackPages is a JSON file of curated template pages served while page generation is unavailable, the embedded
+	// ones being used when empty
+	FallbackPages string
 
 	// Qdrant configuration
 	QdrantHost string
@@ -21,9 +71,119 @@ type Config struct {
 	MongoUser string
 	MongoPass string
 
-	// TorchServe configuration
-	TorchServeHost string
-	ModelName      string
+	// TorchServe configuration, Batch coalescing concurrent embedding calls of a model into one prediction.
+	// TorchServeProtocol is torchserve.GRPCProtocol (default), torchserve.StreamProtocol or torchserve.RESTProtocol for
+	// networks blocking gRPC, and the management API defaults to TorchServeHost's host
+	TorchServeHost           string
+	TorchServeProtocol       string
+	TorchServeManagementHost string
+	ModelName                string
+	ModelVersion             torchserve.ModelVersion
+	Batch                    torchserve.BatchConfig
+
+	// TextFormat is how users and triggers are serialized into the text they are embedded from, util.DefaultTextFormat
+	// when empty
+	TextFormat util.TextFormat
+
+	// NormalizeEmbeddings scales every embedding to unit length once validated
+	NormalizeEmbeddings bool
+
+	// EmbeddingEncoding is how embeddings are stored in Redis, dao.DefaultEmbeddingEncoding when empty. Embeddings in
+	// any encoding are read
+	EmbeddingEncoding dao.EmbeddingEncoding
+
+	// Drift samples recent user and trigger embeddings and compares their statistics to a baseline stored in Redis
+	Drift DriftConfig
+
+	// TriggerCache caches trigger embeddings in process and in Redis
+	TriggerCache TriggerCacheConfig
+
+	// EmbeddingModels lists every model pages are embedded with, the first being the default for requests.
+	// Defaults to ModelName with VectorSize when empty
+	EmbeddingModels []EmbeddingModel
+
+	// Locales pages can be generated and served in, the first being the fallback of every request. Defaults to DefaultLocale
+	Locales []string
+
+	// Tenant configuration, requests for tenants other than DefaultTenant are rejected unless listed in Tenants
+	TenantIsolation TenantIsolation
+	Tenants         map[string]TenantConfig
 
 	Env Env
 }
+
+type TenantIsolation string
+
+const (
+	// FilterIsolation keeps all tenants' pages in one collection, filtered by their tenant payload field
+	FilterIsolation TenantIsolation = "filter"
+	// CollectionIsolation keeps each tenant's pages in its own collection
+	CollectionIsolation TenantIsolation = "collection"
+)
+
+// TenantConfig overrides the global defaults for a single tenant, unset fields inherit them
+type TenantConfig struct {
+	MinScore       *float32 `json:"min_score,omitempty"`
+	GenerateChance *float32 `json:"generate_chance,omitempty"`
+
+	// PromptVersions selects the prompt template version of each generation role
+	PromptVersions map[GenerationRole]string `json:"prompt_versions,omitempty"`
+
+	// BlockedTerms rejects generated pages mentioning any of them, e.g. competitor names
+	BlockedTerms []string `json:"blocked_terms,omitempty"`
+
+	// DailyGenerationLimit caps background page generations per day, 0 being unlimited
+	DailyGenerationLimit int `json:"daily_generation_limit,omitempty"`
+}
+
+// EmbeddingModel is a TorchServe model whose vectors are stored on every page under its name
+type EmbeddingModel struct {
+	Name      string
+	Dimension uint64
+	Version   torchserve.ModelVersion // pinned or canary versions, TorchServe's default version when unset
+}
+
+// locales returns the configured locales normalized, falling back to DefaultLocale
+func (c *Config) locales() []string {
+	locales := make([]string, 0, len(c.Locales))
+	for _, locale := range c.Locales {
+		if locale = normalizeLocale(locale); locale != "" {
+			locales = append(locales, locale)
+		}
+	}
+	if len(locales) == 0 {
+		return []string{DefaultLocale}
+	}
+	return locales
+}
+
+// embeddingModels returns the configured embedding models, falling back to the single ModelName
+func (c *Config) embeddingModels() []EmbeddingModel {
+	if len(c.EmbeddingModels) > 0 {
+		return c.EmbeddingModels
+	}
+	return []EmbeddingModel{{Name: c.ModelName, Dimension: VectorSize, Version: c.ModelVersion}}
+}
+
+// managementHost returns the TorchServe management API host, falling back to TorchServeHost's host
+func (c *Config) managementHost() string {
+	if c.TorchServeManagementHost != "" {
+		return c.TorchServeManagementHost
+	}
+	host := c.TorchServeHost
+	if u, err := url.Parse(host); err == nil && u.Host != "" {
+		host = u.Host
+	}
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	return host
+}
+
+// generationWindow returns the configured generation cache window, falling back to DefaultGenerationCacheWindow
+func (c *Config) generationWindow() time.Duration {
+	if c.GenerationCacheWindow == 0 {
+		return DefaultGenerationCacheWindow
+	}
+	return c.GenerationCacheWindow
+}
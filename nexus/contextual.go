@@ -0,0 +1,139 @@
+package nexus
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"math"
+	"strconv"
+
+	"github.com/dbrun3/nexus-vector/model"
+	"github.com/qdrant/go-client/qdrant"
+)
+
+// DefaultContextTriggerWeight is the trigger's share of a contextual page's blended embedding
+const DefaultContextTriggerWeight = 0.5
+
+// ContextConfig configures contextual pages, generated for a user and a trigger together and stored under a blend of
+// the trigger's and user's embeddings
+type ContextConfig struct {
+	Enabled bool
+
+	// TriggerWeight is the trigger's share of the blended embedding from 0 to 1, the user's being the rest.
+	// Defaults to DefaultContextTriggerWeight
+	TriggerWeight float32
+}
+
+// triggerWeight returns the configured trigger weight, falling back to DefaultContextTriggerWeight
+func (c ContextConfig) triggerWeight() float32 {
+	if c.TriggerWeight == 0 {
+		return DefaultContextTriggerWeight
+	}
+	return c.TriggerWeight
+}
+
+func (c ContextConfig) validate() error {
+	if c.TriggerWeight < 0 || c.TriggerWeight > 1 {
+		return fmt.Errorf("context trigger weight must be between 0 and 1, got %v", c.TriggerWeight)
+	}
+	return nil
+}
+
+// pageRoles returns the generation roles every background generation runs
+func (n *Nexus) pageRoles() []GenerationRole {
+	if n.contextual.Enabled {
+		return generationRoles
+	}
+	return []GenerationRole{UserRole, TriggerRole}
+}
+
+// blendEmbeddings combines a trigger and a user embedding weighted by the trigger's share, normalised to unit length so
+// its cosine similarity compares with that of the embeddings it was blended from
+func blendEmbeddings(trigger, user []float32, triggerWeight float32) []float32 {
+	if len(trigger) != len(user) {
+		return nil
+	}
+
+	blended := make([]float32, len(trigger))
+	var norm float64
+	for i := range trigger {
+		blended[i] = triggerWeight*trigger[i] + (1-triggerWeight)*user[i]
+		norm += float64(blended[i]) * float64(blended[i])
+	}
+	if norm == 0 {
+		return blended
+	}
+
+	scale := float32(1 / math.Sqrt(norm))
+	for i := range blended {
+		blended[i] *= scale
+	}
+	return blended
+}
+
+// contextText is the text a contextual page is generated and judged for
+func contextText(userText, triggerText string) string {
+	return userText + "\n" + triggerText
+}
+
+// generateNewContextPages generates candidate pages for a tenant's user and a trigger together in a locale with a
+// version of the context prompt and stores them along with the user and trigger texts their embedding is blended from.
+// Nothing is stored when an identical user profile and trigger share the generation, whose pages are stored by the
+// request that made it
+func (n *Nexus) generateNewContextPages(ctx context.Context, tenant, version, locale, userId string, trigger model.Trigger, store func(ctx context.Context, pages []model.Page, userText, triggerText string) error) error {
+	userSnapshot, userText, err := n.userSnapshot(ctx, tenant, userId)
+	if err != nil {
+		return err
+	}
+	triggerText, err := n.serializer.TriggerText(trigger)
+	if err != nil {
+		return fmt.Errorf("failed to clean trigger: %w", err)
+	}
+
+	userJSON, err := json.Marshal(userSnapshot)
+	if err != nil {
+		return fmt.Errorf("failed to marshal user snapshot: %w", err)
+	}
+	triggerJSON, err := json.Marshal(trigger)
+	if err != nil {
+		return fmt.Errorf("failed to marshal trigger: %w", err)
+	}
+
+	data := promptData("", locale)
+	data.User, data.Trigger = string(userJSON), string(triggerJSON)
+	prompt, err := n.prompts.Load().Render(ContextRole, version, data)
+	if err != nil {
+		return err
+	}
+
+	return n.generateOnce(ctx, tenant, ContextRole, version+"/"+locale, contextText(userText, triggerText), func(ctx context.Context) ([]model.Page, error) {
+		log.Printf("Background: Generating context pages for user %s and trigger type %s", userId, trigger.TriggerType)
+		pages, err := n.completePages(ctx, tenant, userId, ContextRole, prompt, n.candidates)
+		if err != nil {
+			return nil, err
+		}
+		log.Printf("Background: Generated %d context pages for user %s and trigger type %s", len(pages), userId, trigger.TriggerType)
+		return pages, nil
+	}, func(ctx context.Context, pages []model.Page) error {
+		return store(ctx, pages, userText, triggerText)
+	})
+}
+
+// dedupePoints drops repeated points from results sorted by descending score, keeping each point's best score
+func dedupePoints(results []*qdrant.ScoredPoint) []*qdrant.ScoredPoint {
+	seen := make(map[string]bool, len(results))
+	deduped := results[:0]
+	for _, result := range results {
+		id := result.GetId().GetUuid()
+		if id == "" {
+			id = strconv.FormatUint(result.GetId().GetNum(), 10)
+		}
+		if seen[id] {
+			continue
+		}
+		seen[id] = true
+		deduped = append(deduped, result)
+	}
+	return deduped
+}
@@ -0,0 +1,54 @@
+package nexus
+
+import (
+	"math"
+	"testing"
+
+	"github.com/qdrant/go-client/qdrant"
+)
+
+func TestBlendEmbeddings(t *testing.T) {
+	tests := []struct {
+		name     string
+		trigger  []float32
+		user     []float32
+		weight   float32
+		expected []float32
+	}{
+		{name: "even blend", trigger: []float32{1, 0}, user: []float32{0, 1}, weight: 0.5, expected: []float32{math.Sqrt2 / 2, math.Sqrt2 / 2}},
+		{name: "trigger only", trigger: []float32{3, 4}, user: []float32{0, 1}, weight: 1, expected: []float32{0.6, 0.8}},
+		{name: "user weighted", trigger: []float32{1, 0}, user: []float32{0, 1}, weight: 0.25, expected: []float32{0.31622776, 0.9486833}},
+		{name: "opposite embeddings cancel", trigger: []float32{1, 0}, user: []float32{-1, 0}, weight: 0.5, expected: []float32{0, 0}},
+		{name: "mismatched dimensions", trigger: []float32{1, 0}, user: []float32{1}, weight: 0.5},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			blended := blendEmbeddings(tt.trigger, tt.user, tt.weight)
+			if len(blended) != len(tt.expected) {
+				t.Fatalf("blendEmbeddings() = %v, expected %v", blended, tt.expected)
+			}
+			for i := range blended {
+				if math.Abs(float64(blended[i]-tt.expected[i])) > 1e-6 {
+					t.Errorf("blendEmbeddings() = %v, expected %v", blended, tt.expected)
+					break
+				}
+			}
+		})
+	}
+}
+
+func TestDedupePoints(t *testing.T) {
+	results := []*qdrant.ScoredPoint{
+		{Id: qdrant.NewID("a"), Score: 0.97},
+		{Id: qdrant.NewID("b"), Score: 0.95},
+		{Id: qdrant.NewID("a"), Score: 0.93},
+		{Id: qdrant.NewIDNum(1), Score: 0.91},
+		{Id: qdrant.NewIDNum(1), Score: 0.90},
+	}
+
+	deduped := dedupePoints(results)
+	if len(deduped) != 3 || deduped[0].Score != 0.97 || deduped[1].GetId().GetUuid() != "b" || deduped[2].GetId().GetNum() != 1 {
+		t.Errorf("Unexpected deduped results %v", deduped)
+	}
+}
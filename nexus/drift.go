@@ -0,0 +1,348 @@
+package nexus
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"math/rand/v2"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/dbrun3/nexus-vector/metrics"
+	"github.com/redis/go-redis/v9"
+)
+
+// Embedding drift monitoring defaults
+const (
+	DefaultDriftInterval   = time.Minute
+	DefaultDriftSampleRate = 0.1
+	DefaultDriftWindow     = 500
+)
+
+// MinDriftSamples is how many embeddings a model and group must have sampled before their statistics are computed
+const MinDriftSamples = 20
+
+// UserDriftGroup groups user embeddings, trigger embeddings being grouped by trigger type
+const UserDriftGroup = "user"
+
+var ErrDriftDisabled = errors.New("embedding drift monitoring is disabled")
+
+// DriftConfig configures embedding drift monitoring, which samples recent user and trigger embeddings and periodically
+// compares their statistics to a baseline stored in Redis
+type DriftConfig struct {
+	Enabled bool
+
+	// Interval is how often statistics are computed and compared, defaulting to DefaultDriftInterval
+	Interval time.Duration
+
+	// SampleRate is the share of embeddings sampled from 0 to 1, defaulting to DefaultDriftSampleRate
+	SampleRate float64
+
+	// Window is how many of the most recently sampled embeddings of a model and group statistics are computed over,
+	// defaulting to DefaultDriftWindow
+	Window int
+}
+
+func (c DriftConfig) interval() time.Duration {
+	if c.Interval == 0 {
+		return DefaultDriftInterval
+	}
+	return c.Interval
+}
+
+func (c DriftConfig) sampleRate() float64 {
+	if c.SampleRate == 0 {
+		return DefaultDriftSampleRate
+	}
+	return c.SampleRate
+}
+
+func (c DriftConfig) window() int {
+	if c.Window == 0 {
+		return DefaultDriftWindow
+	}
+	return c.Window
+}
+
+func (c DriftConfig) validate() error {
+	if c.Interval < 0 {
+		return fmt.Errorf("drift interval must not be negative, got %v", c.Interval)
+	}
+	if c.SampleRate < 0 || c.SampleRate > 1 {
+		return fmt.Errorf("drift sample rate must be between 0 and 1, got %v", c.SampleRate)
+	}
+	if c.Window < 0 || (c.Window > 0 && c.Window < MinDriftSamples) {
+		return fmt.Errorf("drift window must be at least %d, got %d", MinDriftSamples, c.Window)
+	}
+	return nil
+}
+
+// EmbeddingStats summarizes the embeddings sampled for a model and group
+type EmbeddingStats struct {
+	Samples            int       `json:"samples"`
+	MeanNorm           float64   `json:"mean_norm"`
+	NormStdDev         float64   `json:"norm_std_dev"`
+	PairwiseSimilarity float64   `json:"pairwise_similarity"` // mean cosine similarity between distinct samples
+	Centroid           []float32 `json:"centroid,omitempty"`
+	ComputedAt         time.Time `json:"computed_at"`
+}
+
+// EmbeddingDrift compares the current statistics of a model and group to their baseline
+type EmbeddingDrift struct {
+	Model    string          `json:"model"`
+	Group    string          `json:"group"`
+	Current  EmbeddingStats  `json:"current"`
+	Baseline *EmbeddingStats `json:"baseline,omitempty"`
+
+	CentroidShift   float64 `json:"centroid_shift"`   // cosine distance between the centroids
+	NormShift       float64 `json:"norm_shift"`       // relative change of the mean norm
+	SimilarityShift float64 `json:"similarity_shift"` // absolute change of the mean pairwise similarity
+	Score           float64 `json:"score"`            // the largest shift
+}
+
+// driftKey identifies the embeddings of a model and group
+type driftKey struct {
+	model, group string
+}
+
+// driftMonitor keeps the most recently sampled embeddings of every model and group
+type driftMonitor struct {
+	config DriftConfig
+
+	mu      sync.Mutex
+	samples map[driftKey]*driftSamples
+}
+
+// driftSamples is a ring of sampled embeddings, next overwriting the oldest once full
+type driftSamples struct {
+	embeddings [][]float32
+	next       int
+}
+
+// newDriftMonitor returns nil when drift monitoring is disabled
+func newDriftMonitor(config DriftConfig) *driftMonitor {
+	if !config.Enabled {
+		return nil
+	}
+	return &driftMonitor{config: config, samples: make(map[driftKey]*driftSamples)}
+}
+
+// sample keeps an embedding of a model and group at the configured sample rate. Embeddings are never modified once
+// created, so they are kept without copying
+func (d *driftMonitor) sample(embeddingModel, group string, embedding []float32) {
+	if d == nil || rand.Float64() >= d.config.sampleRate() {
+		return
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	key := driftKey{embeddingModel, group}
+	s, ok := d.samples[key]
+	if !ok {
+		s = &driftSamples{}
+		d.samples[key] = s
+	}
+	if len(s.embeddings) < d.config.window() {
+		s.embeddings = append(s.embeddings, embedding)
+		return
+	}
+	s.embeddings[s.next] = embedding
+	s.next = (s.next + 1) % len(s.embeddings)
+}
+
+// stats computes the statistics of every model and group with at least MinDriftSamples samples
+func (d *driftMonitor) stats() map[driftKey]EmbeddingStats {
+	d.mu.Lock()
+	sampled := make(map[driftKey][][]float32, len(d.samples))
+	for key, s := range d.samples {
+		if len(s.embeddings) >= MinDriftSamples {
+			sampled[key] = slices.Clone(s.embeddings)
+		}
+	}
+	d.mu.Unlock()
+
+	stats := make(map[driftKey]EmbeddingStats, len(sampled))
+	for key, embeddings := range sampled {
+		stats[key] = computeEmbeddingStats(embeddings)
+	}
+	return stats
+}
+
+// computeEmbeddingStats returns the centroid, norm and mean pairwise cosine similarity of embeddings of one dimension.
+// The mean pairwise similarity follows from the sum of the unit embeddings u as (|Σu|² - n) / (n(n-1)), so it takes a
+// single pass instead of comparing every pair
+func computeEmbeddingStats(embeddings [][]float32) EmbeddingStats {
+	stats := EmbeddingStats{Samples: len(embeddings), ComputedAt: time.Now()}
+	if len(embeddings) == 0 {
+		return stats
+	}
+
+	dimension := len(embeddings[0])
+	centroid := make([]float64, dimension)
+	unitSum := make([]float64, dimension)
+	var normSum, normSquareSum float64
+	units := 0
+
+	for _, embedding := range embeddings {
+		var squares float64
+		for i, v := range embedding {
+			centroid[i] += float64(v)
+			squares += float64(v) * float64(v)
+		}
+		norm := math.Sqrt(squares)
+		normSum += norm
+		normSquareSum += squares
+
+		if norm > 0 {
+			for i, v := range embedding {
+				unitSum[i] += float64(v) / norm
+			}
+			units++
+		}
+	}
+
+	count := float64(len(embeddings))
+	stats.MeanNorm = normSum / count
+	stats.NormStdDev = math.Sqrt(max(0, normSquareSum/count-stats.MeanNorm*stats.MeanNorm))
+
+	stats.Centroid = make([]float32, dimension)
+	for i := range centroid {
+		stats.Centroid[i] = float32(centroid[i] / count)
+	}
+
+	if units > 1 {
+		var unitSumSquares float64
+		for _, v := range unitSum {
+			unitSumSquares += v * v
+		}
+		stats.PairwiseSimilarity = (unitSumSquares - float64(units)) / float64(units*(units-1))
+	}
+
+	return stats
+}
+
+// newEmbeddingDrift compares current statistics to a baseline, reporting no drift without one
+func newEmbeddingDrift(embeddingModel, group string, current EmbeddingStats, baseline *EmbeddingStats) EmbeddingDrift {
+	drift := EmbeddingDrift{Model: embeddingModel, Group: group, Current: current, Baseline: baseline}
+	if baseline == nil {
+		return drift
+	}
+
+	drift.CentroidShift = 1 - float64(cosineSimilarity(current.Centroid, baseline.Centroid))
+	if baseline.MeanNorm > 0 {
+		drift.NormShift = math.Abs(current.MeanNorm-baseline.MeanNorm) / baseline.MeanNorm
+	}
+	drift.SimilarityShift = math.Abs(current.PairwiseSimilarity - baseline.PairwiseSimilarity)
+	drift.Score = max(drift.CentroidShift, drift.NormShift, drift.SimilarityShift)
+	return drift
+}
+
+// driftBaselineKey is the Redis key of the baseline statistics of a model and group, shared by every tenant as
+// embeddings only depend on their model and text
+func driftBaselineKey(embeddingModel, group string) string {
+	return "drift_baseline:" + embeddingModel + ":" + group
+}
+
+// monitorDrift compares embedding statistics to their baselines every interval until ctx is done
+func (n *Nexus) monitorDrift(ctx context.Context) {
+	ticker := time.NewTicker(n.drift.config.interval())
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if _, err := n.EmbeddingDrift(ctx); err != nil {
+				log.Printf("Failed to compare embedding statistics: %v", err)
+			}
+		}
+	}
+}
+
+// EmbeddingDrift compares the statistics of recently sampled embeddings of every model and group to their baselines
+// and reports them as metrics. The first statistics of a model and group without a baseline become its baseline
+func (n *Nexus) EmbeddingDrift(ctx context.Context) ([]EmbeddingDrift, error) {
+	return n.compareDrift(ctx, false)
+}
+
+// ResetDriftBaselines replaces the baseline of every model and group with their current statistics, e.g. once a
+// model or preprocessing change is accepted
+func (n *Nexus) ResetDriftBaselines(ctx context.Context) ([]EmbeddingDrift, error) {
+	return n.compareDrift(ctx, true)
+}
+
+func (n *Nexus) compareDrift(ctx context.Context, reset bool) ([]EmbeddingDrift, error) {
+	if n.drift == nil {
+		return nil, ErrDriftDisabled
+	}
+
+	drifts := make([]EmbeddingDrift, 0)
+	for key, current := range n.drift.stats() {
+		baseline, err := n.driftBaseline(ctx, key, current, reset)
+		if err != nil {
+			return nil, err
+		}
+
+		drift := newEmbeddingDrift(key.model, key.group, current, baseline)
+		metrics.EmbeddingDriftScore.WithLabelValues(key.model, key.group).Set(drift.Score)
+		metrics.EmbeddingCentroidShift.WithLabelValues(key.model, key.group).Set(drift.CentroidShift)
+		metrics.EmbeddingMeanNorm.WithLabelValues(key.model, key.group).Set(current.MeanNorm)
+		metrics.EmbeddingPairwiseSimilarity.WithLabelValues(key.model, key.group).Set(current.PairwiseSimilarity)
+		drifts = append(drifts, drift)
+	}
+
+	slices.SortFunc(drifts, func(a, b EmbeddingDrift) int {
+		if c := strings.Compare(a.Model, b.Model); c != 0 {
+			return c
+		}
+		return strings.Compare(a.Group, b.Group)
+	})
+	return drifts, nil
+}
+
+// driftBaseline reads the baseline of a model and group from Redis, storing current as the baseline when there is
+// none yet or reset is set
+func (n *Nexus) driftBaseline(ctx context.Context, key driftKey, current EmbeddingStats, reset bool) (*EmbeddingStats, error) {
+	redisKey := driftBaselineKey(key.model, key.group)
+
+	if !reset {
+		value, err := n.rdClient.Get(ctx, redisKey).Result()
+		if err == nil {
+			var baseline EmbeddingStats
+			if err := json.Unmarshal([]byte(value), &baseline); err != nil {
+				return nil, fmt.Errorf("failed to unmarshal drift baseline %s: %w", redisKey, err)
+			}
+			return &baseline, nil
+		}
+		if !errors.Is(err, redis.Nil) {
+			return nil, fmt.Errorf("failed to get drift baseline: %w", err)
+		}
+	}
+
+	value, err := json.Marshal(current)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal drift baseline: %w", err)
+	}
+	if reset {
+		err = n.rdClient.Set(ctx, redisKey, value, 0).Err()
+	} else {
+		// Another replica may have stored its own first statistics in the meantime, which are kept
+		var stored bool
+		stored, err = n.rdClient.SetNX(ctx, redisKey, value, 0).Result()
+		if err == nil && !stored {
+			return n.driftBaseline(ctx, key, current, false)
+		}
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to store drift baseline: %w", err)
+	}
+
+	return &current, nil
+}
@@ -0,0 +1,86 @@
+package nexus
+
+import (
+	"math"
+	"math/rand/v2"
+	"testing"
+)
+
+func TestComputeEmbeddingStats(t *testing.T) {
+	r := rand.New(rand.NewPCG(1, 2))
+	embeddings := make([][]float32, 30)
+	for i := range embeddings {
+		embeddings[i] = []float32{float32(r.NormFloat64()) + 1, float32(r.NormFloat64()), float32(r.NormFloat64())}
+	}
+	embeddings[3] = []float32{0, 0, 0} // counted in the norm only
+
+	stats := computeEmbeddingStats(embeddings)
+
+	// Compare the single pass pairwise similarity to every pair
+	var similarity float64
+	pairs := 0
+	for i := range embeddings {
+		for j := i + 1; j < len(embeddings); j++ {
+			if i == 3 || j == 3 {
+				continue
+			}
+			similarity += float64(cosineSimilarity(embeddings[i], embeddings[j]))
+			pairs++
+		}
+	}
+	if expected := similarity / float64(pairs); math.Abs(stats.PairwiseSimilarity-expected) > 1e-5 {
+		t.Errorf("PairwiseSimilarity = %v, expected %v", stats.PairwiseSimilarity, expected)
+	}
+
+	var norms, centroid0 float64
+	for _, embedding := range embeddings {
+		norms += math.Sqrt(float64(embedding[0]*embedding[0] + embedding[1]*embedding[1] + embedding[2]*embedding[2]))
+		centroid0 += float64(embedding[0])
+	}
+	if expected := norms / 30; math.Abs(stats.MeanNorm-expected) > 1e-5 {
+		t.Errorf("MeanNorm = %v, expected %v", stats.MeanNorm, expected)
+	}
+	if expected := centroid0 / 30; math.Abs(float64(stats.Centroid[0])-expected) > 1e-5 {
+		t.Errorf("Centroid[0] = %v, expected %v", stats.Centroid[0], expected)
+	}
+	if stats.Samples != 30 || stats.NormStdDev <= 0 {
+		t.Errorf("Unexpected stats %+v", stats)
+	}
+}
+
+func TestNewEmbeddingDrift(t *testing.T) {
+	baseline := EmbeddingStats{MeanNorm: 2, PairwiseSimilarity: 0.4, Centroid: []float32{1, 0}}
+	current := EmbeddingStats{MeanNorm: 2.5, PairwiseSimilarity: 0.3, Centroid: []float32{1, 1}}
+
+	drift := newEmbeddingDrift("minilm", "snap", current, &baseline)
+	if math.Abs(drift.CentroidShift-(1-math.Sqrt2/2)) > 1e-6 || math.Abs(drift.NormShift-0.25) > 1e-9 ||
+		math.Abs(drift.SimilarityShift-0.1) > 1e-9 || drift.Score != drift.CentroidShift {
+		t.Errorf("newEmbeddingDrift() = %+v", drift)
+	}
+
+	if drift := newEmbeddingDrift("minilm", "snap", current, nil); drift.Score != 0 {
+		t.Errorf("Expected no drift without a baseline, got %+v", drift)
+	}
+}
+
+func TestDriftMonitorWindow(t *testing.T) {
+	d := newDriftMonitor(DriftConfig{Enabled: true, SampleRate: 1, Window: MinDriftSamples})
+	for i := range MinDriftSamples + 5 {
+		d.sample("minilm", UserDriftGroup, []float32{float32(i)})
+	}
+	d.sample("minilm", "snap", []float32{1})
+
+	stats := d.stats()
+	if len(stats) != 1 {
+		t.Fatalf("Expected stats of the user group only, got %v", stats)
+	}
+	user := stats[driftKey{"minilm", UserDriftGroup}]
+	// The oldest 5 samples (0 to 4) were overwritten
+	if user.Samples != MinDriftSamples || user.MeanNorm != float64(5+MinDriftSamples+4)/2 {
+		t.Errorf("Unexpected user stats %+v", user)
+	}
+
+	if newDriftMonitor(DriftConfig{}) != nil {
+		t.Error("Expected no monitor when disabled")
+	}
+}
@@ -0,0 +1,131 @@
+package nexus
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/dbrun3/nexus-vector/dao"
+	"github.com/dbrun3/nexus-vector/model"
+	"github.com/redis/go-redis/v9"
+	"golang.org/x/sync/errgroup"
+)
+
+// ErrUnknownEmbeddingModel is returned for requests naming an embedding model that isn't configured
+var ErrUnknownEmbeddingModel = errors.New("unknown embedding model")
+
+// resolveModel returns the embedding model a request asked for, or the default model when none was given
+func (n *Nexus) resolveModel(name string) (string, error) {
+	if name == "" {
+		return n.models[0].Name, nil
+	}
+	if _, ok := n.embedders[name]; !ok {
+		return "", fmt.Errorf("%w: %s", ErrUnknownEmbeddingModel, name)
+	}
+	return name, nil
+}
+
+// embedAll embeds text with every configured model concurrently, reusing any embeddings already in have
+func (n *Nexus) embedAll(ctx context.Context, text string, have map[string][]float32) (map[string][]float32, error) {
+	return n.embedEach(ctx, have, func(ctx context.Context, embeddingModel string) ([]float32, error) {
+		result, err := n.embedTexts(ctx, embeddingModel, text)
+		if err != nil {
+			return nil, err
+		}
+		return result[0], nil
+	})
+}
+
+// embedSource embeds a page source with every configured model concurrently, reusing any embeddings already in have.
+// Contextual sources embed their trigger and user texts and blend them
+func (n *Nexus) embedSource(ctx context.Context, source dao.PageSource, have map[string][]float32) (map[string][]float32, error) {
+	if source.Kind != dao.ContextSource {
+		return n.embedAll(ctx, source.Text, have)
+	}
+	return n.embedEach(ctx, have, func(ctx context.Context, embeddingModel string) ([]float32, error) {
+		result, err := n.embedTexts(ctx, embeddingModel, source.Text, source.UserText)
+		if err != nil {
+			return nil, err
+		}
+		return blendEmbeddings(result[0], result[1], source.TriggerWeight), nil
+	})
+}
+
+// embedEach runs embed for every configured model missing from have concurrently
+func (n *Nexus) embedEach(ctx context.Context, have map[string][]float32, embed func(ctx context.Context, embeddingModel string) ([]float32, error)) (map[string][]float32, error) {
+	var mu sync.Mutex
+	embeddings := make(map[string][]float32, len(n.models))
+	g, gctx := errgroup.WithContext(ctx)
+
+	for _, m := range n.models {
+		if embedding, ok := have[m.Name]; ok {
+			embeddings[m.Name] = embedding
+			continue
+		}
+
+		g.Go(func() error {
+			embedding, err := embed(gctx, m.Name)
+			if err != nil {
+				return fmt.Errorf("model %s: %w", m.Name, err)
+			}
+
+			mu.Lock()
+			embeddings[m.Name] = embedding
+			mu.Unlock()
+			return nil
+		})
+	}
+
+	if err := g.Wait(); err != nil {
+		return nil, err
+	}
+
+	return embeddings, nil
+}
+
+// userEmbeddingText returns the text a user's embedding is derived from
+func (n *Nexus) userEmbeddingText(snapshot model.UserSnapshot) (string, error) {
+	// Embedding is anonymous and simply reflects user trends
+	snapshot.ID = ""
+	return n.serializer.UserText(snapshot)
+}
+
+// userEmbeddingKey is the Redis key of a tenant's user embedding for one embedding model
+func userEmbeddingKey(tenant, embeddingModel, userId string) string {
+	return tenantKey(tenant, "embedding:"+embeddingModel+":"+userId)
+}
+
+// storeUserEmbedding caches a user's embedding for one embedding model in Redis
+func (n *Nexus) storeUserEmbedding(ctx context.Context, tenant, userId, embeddingModel string, embedding []float32) error {
+	value, err := dao.EmbeddingToRedis(embedding, n.encoding)
+	if err != nil {
+		return fmt.Errorf("failed to marshal embedding: %w", err)
+	}
+
+	err = n.rdClient.Set(ctx, userEmbeddingKey(tenant, embeddingModel, userId), value, 0).Err()
+	if err != nil {
+		return fmt.Errorf("failed to store embedding in Redis: %w", err)
+	}
+
+	return nil
+}
+
+// loadUserEmbedding reads a user's cached embedding for one embedding model from Redis.
+// Embeddings cached before keys were versioned by model are stored under the bare user ID and belong to the default model and tenant
+func (n *Nexus) loadUserEmbedding(ctx context.Context, tenant, userId, embeddingModel string) ([]float32, error) {
+	value, err := n.rdClient.Get(ctx, userEmbeddingKey(tenant, embeddingModel, userId)).Result()
+	if errors.Is(err, redis.Nil) && embeddingModel == n.models[0].Name && tenant == DefaultTenant {
+		value, err = n.rdClient.Get(ctx, userId).Result()
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get embedding: %w", err)
+	}
+
+	embedding, err := dao.EmbeddingFromRedis(value)
+	if err != nil {
+		return nil, fmt.Errorf("failed to convert embedding: %w", err)
+	}
+
+	return n.validateEmbedding(embeddingModel, EmbeddingFromRedis, embedding)
+}
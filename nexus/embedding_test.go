@@ -0,0 +1,138 @@
+package nexus
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/dbrun3/nexus-vector/model"
+	"github.com/dbrun3/nexus-vector/torchserve"
+	"github.com/dbrun3/nexus-vector/util"
+)
+
+func TestResolveModel(t *testing.T) {
+	n := &Nexus{
+		models:    []EmbeddingModel{{Name: "minilm", Dimension: 384}, {Name: "mpnet", Dimension: 768}},
+		embedders: map[string]*torchserve.Client{"minilm": nil, "mpnet": nil},
+	}
+
+	tests := []struct {
+		name    string
+		want    string
+		wantErr error
+	}{
+		{"", "minilm", nil},
+		{"minilm", "minilm", nil},
+		{"mpnet", "mpnet", nil},
+		{"e5", "", ErrUnknownEmbeddingModel},
+	}
+	for _, tt := range tests {
+		got, err := n.resolveModel(tt.name)
+		if got != tt.want || !errors.Is(err, tt.wantErr) {
+			t.Errorf("resolveModel(%q) = %q, %v, want %q, %v", tt.name, got, err, tt.want, tt.wantErr)
+		}
+	}
+}
+
+func TestPageQueryNamedVector(t *testing.T) {
+	n := &Nexus{isolation: CollectionIsolation}
+
+	for _, vector := range []string{"minilm", "mpnet"} {
+		query := n.pageQuery("acme", vector, []string{"en", "fr"}, []float32{1, 0, 0})
+		if query.Using == nil || *query.Using != vector {
+			t.Errorf("Expected the query to use the %s vector, got %v", vector, query.Using)
+		}
+		if query.GetCollectionName() != PageCollection+"_acme" || query.GetLimit() != 2*QueryLimit {
+			t.Errorf("Unexpected query of collection %s with limit %d", query.GetCollectionName(), query.GetLimit())
+		}
+	}
+
+	// Legacy collections of unnamed vectors are queried without naming one
+	if query := n.pageQuery("acme", "", []string{"en"}, []float32{1, 0, 0}); query.Using != nil {
+		t.Errorf("Expected no named vector, got %q", *query.Using)
+	}
+}
+
+func TestVectorName(t *testing.T) {
+	n := &Nexus{models: []EmbeddingModel{{Name: "minilm", Dimension: 3}, {Name: "mpnet", Dimension: 4}}}
+
+	tests := []struct {
+		name           string
+		names          map[string]uint64
+		embeddingModel string
+		want           string
+		ok             bool
+	}{
+		{"named", map[string]uint64{"minilm": 3, "mpnet": 4}, "mpnet", "mpnet", true},
+		{"model added since", map[string]uint64{"minilm": 3}, "mpnet", "", false},
+		{"legacy default model", nil, "minilm", "", true},
+		{"legacy other model", nil, "mpnet", "", false},
+	}
+	for _, tt := range tests {
+		got, ok := n.vectorName(tt.names, tt.embeddingModel)
+		if ok != tt.ok || (ok && got != tt.want) {
+			t.Errorf("%s: vectorName() = %q, %v, want %q, %v", tt.name, got, ok, tt.want, tt.ok)
+		}
+	}
+}
+
+func TestPointVectors(t *testing.T) {
+	n := &Nexus{models: []EmbeddingModel{{Name: "minilm", Dimension: 3}, {Name: "mpnet", Dimension: 4}}}
+	embeddings := map[string][]float32{"minilm": {1, 0, 0}, "mpnet": {0, 1, 0, 0}}
+
+	// Only the vectors a collection has are written
+	vectors, err := n.pointVectors(map[string]uint64{"minilm": 3}, embeddings)
+	if err != nil {
+		t.Fatalf("pointVectors() error = %v", err)
+	}
+	if named := vectors.GetVectors().GetVectors(); len(named) != 1 || named["minilm"] == nil {
+		t.Errorf("Expected only the minilm vector, got %v", vectors)
+	}
+
+	// Legacy collections get the default model's embedding as their unnamed vector
+	vectors, err = n.pointVectors(nil, embeddings)
+	if err != nil {
+		t.Fatalf("pointVectors() error = %v", err)
+	}
+	if vectors.GetVector() == nil || vectors.GetVectors() != nil {
+		t.Errorf("Expected an unnamed vector, got %v", vectors)
+	}
+
+	if _, err := n.pointVectors(map[string]uint64{"e5": 3}, embeddings); !errors.Is(err, ErrModelNotIndexed) {
+		t.Errorf("Expected ErrModelNotIndexed, got %v", err)
+	}
+}
+
+func TestDebugEmbeddings(t *testing.T) {
+	n, _, embedded := newFakeNexus(t)
+	n.serializer = util.CleanedJSONSerializer{}
+	n.drift = newDriftMonitor(DriftConfig{Enabled: true, SampleRate: 1})
+	ctx := context.Background()
+
+	trigger := model.Trigger{TriggerType: model.PostSnapTrigger, Category: "groceries"}
+	for range 2 {
+		embedding, err := n.DebugTrigger(ctx, trigger)
+		if err != nil || len(embedding) != 3 {
+			t.Fatalf("DebugTrigger() = %v, %v", embedding, err)
+		}
+	}
+	if embedded.Load() != 1 {
+		t.Errorf("Expected the repeated trigger to hit the cache, got %d predictions", embedded.Load())
+	}
+
+	// The user ID is left out of the embedded text, as in InjestUser
+	user, err := n.DebugUsersnap(ctx, model.UserSnapshot{ID: "u1", FavoriteCategories: []string{"books"}})
+	if err != nil {
+		t.Fatalf("DebugUsersnap() error = %v", err)
+	}
+	anonymous, _ := n.DebugUsersnap(ctx, model.UserSnapshot{FavoriteCategories: []string{"books"}})
+	if user[0] != anonymous[0] {
+		t.Errorf("Expected the user ID not to be embedded, got %v and %v", user, anonymous)
+	}
+
+	n.drift.mu.Lock()
+	defer n.drift.mu.Unlock()
+	if len(n.drift.samples) != 0 {
+		t.Errorf("Expected debug embeddings not to be sampled for drift monitoring, got %v", n.drift.samples)
+	}
+}
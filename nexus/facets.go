@@ -0,0 +1,193 @@
+package nexus
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/dbrun3/nexus-vector/dao"
+	"github.com/dbrun3/nexus-vector/metrics"
+	"github.com/dbrun3/nexus-vector/model"
+	"github.com/qdrant/go-client/qdrant"
+	"github.com/redis/go-redis/v9"
+	"golang.org/x/sync/errgroup"
+)
+
+// DefaultMaxUserFacets is how many facet vectors are stored per user and embedding model by default
+const DefaultMaxUserFacets = 4
+
+// UserVectorConfig configures how users are represented when their pages are queried
+type UserVectorConfig struct {
+	// MultiVector also represents a user by a vector per interest facet (each favorite category, then their last
+	// purchase category) besides their profile vector, and queries pages with all of them
+	MultiVector bool
+
+	// MaxFacets is how many facets a user is represented by at most. Defaults to DefaultMaxUserFacets
+	MaxFacets int
+}
+
+// maxFacets returns the configured facet limit, falling back to DefaultMaxUserFacets
+func (c UserVectorConfig) maxFacets() int {
+	if c.MaxFacets == 0 {
+		return DefaultMaxUserFacets
+	}
+	return c.MaxFacets
+}
+
+func (c UserVectorConfig) validate() error {
+	if c.MaxFacets < 0 {
+		return fmt.Errorf("max user facets must not be negative, got %d", c.MaxFacets)
+	}
+	return nil
+}
+
+// userFacets returns the interest facets of a user, each favorite category and then their last purchase category, up
+// to limit. A user with a single interest is described by their profile alone and has none
+func userFacets(snapshot model.UserSnapshot, limit int) []string {
+	var facets []string
+	for _, category := range append(slices.Clone(snapshot.FavoriteCategories), snapshot.LastPurchaseCategory) {
+		facet := strings.ToLower(strings.TrimSpace(category))
+		if facet == "" || slices.Contains(facets, facet) {
+			continue
+		}
+		facets = append(facets, facet)
+	}
+
+	if len(facets) < 2 {
+		return nil
+	}
+	return facets[:min(len(facets), limit)]
+}
+
+// facetSnapshot narrows a user snapshot to one facet, keeping the rest of their profile
+func facetSnapshot(snapshot model.UserSnapshot, facet string) model.UserSnapshot {
+	snapshot.FavoriteCategories = []string{facet}
+	if !strings.EqualFold(strings.TrimSpace(snapshot.LastPurchaseCategory), facet) {
+		snapshot.LastPurchaseCategory = ""
+	}
+	return snapshot
+}
+
+// userTexts returns the texts a user's embeddings are derived from, their profile text first followed by the text of
+// each facet when users are represented by several vectors
+func (n *Nexus) userTexts(snapshot model.UserSnapshot) ([]string, []string, error) {
+	text, err := n.userEmbeddingText(snapshot)
+	if err != nil {
+		return nil, nil, err
+	}
+	if !n.userVectors.MultiVector {
+		return nil, []string{text}, nil
+	}
+
+	facets := userFacets(snapshot, n.userVectors.maxFacets())
+	texts := []string{text}
+	for _, facet := range facets {
+		text, err := n.userEmbeddingText(facetSnapshot(snapshot, facet))
+		if err != nil {
+			return nil, nil, err
+		}
+		texts = append(texts, text)
+	}
+
+	return facets, texts, nil
+}
+
+// userFacetsKey is the Redis hash of a tenant's user facet embeddings for one embedding model, keyed by facet
+func userFacetsKey(tenant, embeddingModel, userId string) string {
+	return tenantKey(tenant, "facets:"+embeddingModel+":"+userId)
+}
+
+// storeUserFacets replaces a user's cached facet embeddings for one embedding model in Redis, deleting them when the
+// user has no facets
+func (n *Nexus) storeUserFacets(ctx context.Context, tenant, userId, embeddingModel string, facets []string, embeddings [][]float32) error {
+	values := make([]any, 0, 2*len(facets))
+	for i, facet := range facets {
+		value, err := dao.EmbeddingToRedis(embeddings[i], n.encoding)
+		if err != nil {
+			return fmt.Errorf("failed to marshal embedding: %w", err)
+		}
+		values = append(values, facet, value)
+	}
+
+	key := userFacetsKey(tenant, embeddingModel, userId)
+	_, err := n.rdClient.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.Del(ctx, key)
+		if len(values) > 0 {
+			pipe.HSet(ctx, key, values...)
+		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("failed to store facet embeddings in Redis: %w", err)
+	}
+
+	return nil
+}
+
+// loadUserFacets reads a user's cached facet embeddings for one embedding model from Redis, ordered by facet. Users
+// injested before facets were stored have none, and facet embeddings failing validation are skipped
+func (n *Nexus) loadUserFacets(ctx context.Context, tenant, userId, embeddingModel string) ([][]float32, error) {
+	values, err := n.rdClient.HGetAll(ctx, userFacetsKey(tenant, embeddingModel, userId)).Result()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get facet embeddings: %w", err)
+	}
+
+	embeddings := make([][]float32, 0, len(values))
+	for _, facet := range slices.Sorted(maps.Keys(values)) {
+		embedding, err := dao.EmbeddingFromRedis(values[facet])
+		if err != nil {
+			continue
+		}
+		if embedding, err = n.validateEmbedding(embeddingModel, EmbeddingFromRedis, embedding); err != nil {
+			continue
+		}
+		embeddings = append(embeddings, embedding)
+	}
+
+	return embeddings, nil
+}
+
+// queryUserVectors queries pages with each of a user's vectors concurrently and merges their results
+func (n *Nexus) queryUserVectors(ctx context.Context, tenant, embeddingModel string, locales []string, vectors [][]float32) ([]*qdrant.ScoredPoint, error) {
+	metrics.UserVectors.WithLabelValues(embeddingModel).Observe(float64(len(vectors)))
+	if len(vectors) == 1 {
+		return n.queryQdrant(ctx, tenant, embeddingModel, locales, vectors[0])
+	}
+
+	results := make([][]*qdrant.ScoredPoint, len(vectors))
+	g, gctx := errgroup.WithContext(ctx)
+	for i, vector := range vectors {
+		g.Go(func() error {
+			var err error
+			results[i], err = n.queryQdrant(gctx, tenant, embeddingModel, locales, vector)
+			return err
+		})
+	}
+	if err := g.Wait(); err != nil {
+		return nil, err
+	}
+
+	return mergeResults(results...), nil
+}
+
+// mergeResults combines the results of several queries sorted by relevancy score (descending), a page found by several
+// queries keeping its best score
+func mergeResults(results ...[]*qdrant.ScoredPoint) []*qdrant.ScoredPoint {
+	size := 0
+	for _, r := range results {
+		size += len(r)
+	}
+
+	merged := make([]*qdrant.ScoredPoint, 0, size)
+	for _, r := range results {
+		merged = append(merged, r...)
+	}
+	sort.SliceStable(merged, func(i, j int) bool {
+		return merged[i].Score > merged[j].Score
+	})
+
+	return dedupePoints(merged)
+}
@@ -0,0 +1,113 @@
+package nexus
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"github.com/dbrun3/nexus-vector/model"
+	"github.com/qdrant/go-client/qdrant"
+)
+
+func TestUserFacets(t *testing.T) {
+	tests := []struct {
+		name     string
+		snapshot model.UserSnapshot
+		limit    int
+		expected []string
+	}{
+		{
+			name:     "favorite categories then last purchase",
+			snapshot: model.UserSnapshot{FavoriteCategories: []string{"electronics", "books"}, LastPurchaseCategory: "sports"},
+			limit:    4,
+			expected: []string{"electronics", "books", "sports"},
+		},
+		{
+			name:     "duplicates and blanks dropped",
+			snapshot: model.UserSnapshot{FavoriteCategories: []string{"Books", " books", "", "toys"}, LastPurchaseCategory: "TOYS"},
+			limit:    4,
+			expected: []string{"books", "toys"},
+		},
+		{
+			name:     "limited",
+			snapshot: model.UserSnapshot{FavoriteCategories: []string{"a", "b", "c", "d", "e"}},
+			limit:    3,
+			expected: []string{"a", "b", "c"},
+		},
+		{
+			name:     "single interest described by the profile",
+			snapshot: model.UserSnapshot{FavoriteCategories: []string{"groceries"}, LastPurchaseCategory: "Groceries"},
+			limit:    4,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			facets := userFacets(tt.snapshot, tt.limit)
+			if !reflect.DeepEqual(facets, tt.expected) {
+				t.Errorf("userFacets() = %v, expected %v", facets, tt.expected)
+			}
+		})
+	}
+}
+
+func TestFacetSnapshot(t *testing.T) {
+	snapshot := model.UserSnapshot{Age: 30, FavoriteCategories: []string{"electronics", "books"}, LastPurchaseCategory: "Books"}
+
+	books := facetSnapshot(snapshot, "books")
+	if !reflect.DeepEqual(books.FavoriteCategories, []string{"books"}) || books.LastPurchaseCategory != "Books" || books.Age != 30 {
+		t.Errorf("facetSnapshot(books) = %+v", books)
+	}
+	electronics := facetSnapshot(snapshot, "electronics")
+	if !reflect.DeepEqual(electronics.FavoriteCategories, []string{"electronics"}) || electronics.LastPurchaseCategory != "" {
+		t.Errorf("facetSnapshot(electronics) = %+v", electronics)
+	}
+	if len(snapshot.FavoriteCategories) != 2 {
+		t.Errorf("facetSnapshot() modified the snapshot's favorite categories: %v", snapshot.FavoriteCategories)
+	}
+}
+
+func TestMergeResults(t *testing.T) {
+	profile := []*qdrant.ScoredPoint{
+		{Id: qdrant.NewID("a"), Score: 0.91},
+		{Id: qdrant.NewID("b"), Score: 0.90},
+	}
+	books := []*qdrant.ScoredPoint{
+		{Id: qdrant.NewID("c"), Score: 0.96},
+		{Id: qdrant.NewID("a"), Score: 0.94},
+	}
+
+	merged := mergeResults(profile, books, nil)
+
+	var ids []string
+	var scores []float32
+	for _, result := range merged {
+		ids = append(ids, result.GetId().GetUuid())
+		scores = append(scores, result.Score)
+	}
+	if !reflect.DeepEqual(ids, []string{"c", "a", "b"}) || !reflect.DeepEqual(scores, []float32{0.96, 0.94, 0.90}) {
+		t.Errorf("mergeResults() = %v with scores %v", ids, scores)
+	}
+}
+
+func TestStoreUserFacets(t *testing.T) {
+	n, fake, _ := newFakeNexus(t)
+	ctx := context.Background()
+	key := userFacetsKey("acme", "minilm", "u1")
+
+	err := n.storeUserFacets(ctx, "acme", "u1", "minilm", []string{"groceries", "electronics"}, [][]float32{{1, 0, 0}, {0, 1, 0}})
+	if err != nil {
+		t.Fatalf("storeUserFacets() error = %v", err)
+	}
+	if fields, _ := fake.HKeys(key); len(fields) != 2 {
+		t.Fatalf("Expected 2 facets stored, got %v", fields)
+	}
+
+	// Users without facets, e.g. once users are represented by a single vector, keep none
+	if err := n.storeUserFacets(ctx, "acme", "u1", "minilm", nil, nil); err != nil {
+		t.Fatalf("storeUserFacets() error = %v", err)
+	}
+	if fake.Exists(key) {
+		t.Error("Expected the facets deleted")
+	}
+}
@@ -0,0 +1,74 @@
+package nexus
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/dbrun3/nexus-vector/torchserve"
+	"github.com/redis/go-redis/v9"
+)
+
+// newFakeTorchServe starts a fake TorchServe REST inference API embedding each text as [length, 1, 0] and returns a
+// client of it with the number of texts embedded
+func newFakeTorchServe(t *testing.T, modelName string) (*torchserve.Client, *atomic.Int32) {
+	t.Helper()
+	var embedded atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/ping" {
+			w.Write([]byte(`{"status": "Healthy"}`))
+			return
+		}
+		var body struct {
+			Input []string `json:"input"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		embeddings := make([][]float64, len(body.Input))
+		for i, text := range body.Input {
+			embeddings[i] = []float64{float64(len(text)), 1, 0}
+		}
+		embedded.Add(int32(len(body.Input)))
+		json.NewEncoder(w).Encode(embeddings)
+	}))
+
+	client, err := torchserve.NewRESTClient(server.URL, modelName)
+	if err != nil {
+		t.Fatalf("NewRESTClient() error = %v", err)
+	}
+	t.Cleanup(func() {
+		client.Close()
+		server.Close()
+	})
+	return client, &embedded
+}
+
+// newFakeNexus returns a Nexus embedding with a fake TorchServe model "minilm" of dimension 3 and storing in an in-process Redis
+func newFakeNexus(t *testing.T) (*Nexus, *miniredis.Miniredis, *atomic.Int32) {
+	t.Helper()
+	tsClient, embedded := newFakeTorchServe(t, "minilm")
+	fake, rdClient := newFakeRedis(t)
+	n := &Nexus{
+		tsClient:     tsClient,
+		rdClient:     rdClient,
+		env:          Test,
+		models:       []EmbeddingModel{{Name: "minilm", Dimension: 3}},
+		embedders:    map[string]*torchserve.Client{"minilm": tsClient},
+		triggerCache: newTriggerCache(TriggerCacheConfig{}),
+	}
+	return n, fake, embedded
+}
+
+// newFakeRedis starts an in-process Redis for the duration of a test and returns it with a client of it
+func newFakeRedis(t *testing.T) (*miniredis.Miniredis, *redis.Client) {
+	t.Helper()
+	server := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: server.Addr()})
+	t.Cleanup(func() { client.Close() })
+	return server, client
+}
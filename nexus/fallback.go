@@ -0,0 +1,66 @@
+package nexus
+
+import (
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"os"
+	"slices"
+
+	"github.com/dbrun3/nexus-vector/model"
+)
+
+// embeddedFallbackPages are the curated template pages built into the binary
+//
+//go:embed fallback_pages.json
+var embeddedFallbackPages []byte
+
+// LoadFallbackPages reads the curated template pages served while page generation is unavailable from a JSON list of
+// pages, the embedded ones being used when path is empty. Pages without a locale are in DefaultLocale
+func LoadFallbackPages(path string) ([]model.Page, error) {
+	data := embeddedFallbackPages
+	if path != "" {
+		var err error
+		if data, err = os.ReadFile(path); err != nil {
+			return nil, fmt.Errorf("failed to read fallback pages: %w", err)
+		}
+	}
+
+	var pages []model.Page
+	if err := json.Unmarshal(data, &pages); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal fallback pages: %w", err)
+	}
+	for i := range pages {
+		pages[i].SchemaVersion = model.PageSchemaVersion
+		if pages[i].Locale == "" {
+			pages[i].Locale = DefaultLocale
+		}
+		pages[i].Locale = normalizeLocale(pages[i].Locale)
+		if err := pages[i].Validate(); err != nil {
+			return nil, fmt.Errorf("fallback page %q: %w", pages[i].Id, err)
+		}
+	}
+	return pages, nil
+}
+
+// fallbackPages picks up to QueryLimit curated template pages in the most preferred locale that has any, pages of the
+// trigger's category first and then pages of no category
+func fallbackPages(pages []model.Page, trigger model.Trigger, locales []string) []model.Page {
+	candidates := make([]model.Page, 0, len(pages))
+	for _, page := range pages {
+		if page.Category == trigger.Category {
+			candidates = append(candidates, page)
+		}
+	}
+	for _, page := range pages {
+		if page.Category == "" && trigger.Category != "" {
+			candidates = append(candidates, page)
+		}
+	}
+
+	preferred := preferLocale(candidates, locales)
+	if len(preferred) == 0 || !slices.Contains(locales, preferred[0].Locale) {
+		return nil
+	}
+	return preferred[:min(len(preferred), QueryLimit)]
+}
@@ -0,0 +1,51 @@
+package nexus
+
+import (
+	"testing"
+
+	"github.com/dbrun3/nexus-vector/model"
+)
+
+func TestLoadFallbackPages(t *testing.T) {
+	pages, err := LoadFallbackPages("")
+	if err != nil {
+		t.Fatalf("LoadFallbackPages() error = %v", err)
+	}
+	if len(pages) == 0 {
+		t.Fatal("Expected embedded fallback pages")
+	}
+}
+
+func TestFallbackPages(t *testing.T) {
+	pages := []model.Page{
+		{Id: "groceries", Category: "groceries", Locale: "en"},
+		{Id: "generic", Locale: "en"},
+		{Id: "electronics", Category: "electronics", Locale: "en"},
+		{Id: "generic-es", Locale: "es"},
+	}
+
+	tests := []struct {
+		name     string
+		category string
+		locales  []string
+		expected []string
+	}{
+		{name: "trigger category first", category: "groceries", locales: []string{"en"}, expected: []string{"groceries", "generic"}},
+		{name: "generic pages for other categories", category: "books", locales: []string{"en"}, expected: []string{"generic"}},
+		{name: "most preferred locale", category: "groceries", locales: []string{"es", "en"}, expected: []string{"generic-es"}},
+		{name: "no page in any locale", category: "groceries", locales: []string{"fr"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			selected := fallbackPages(pages, model.Trigger{Category: tt.category}, tt.locales)
+			ids := make([]string, len(selected))
+			for i, page := range selected {
+				ids[i] = page.Id
+			}
+			if len(ids) != len(tt.expected) || (len(ids) > 0 && ids[0] != tt.expected[0]) || len(ids) > 1 && ids[1] != tt.expected[1] {
+				t.Errorf("fallbackPages() = %v, expected %v", ids, tt.expected)
+			}
+		})
+	}
+}
@@ -6,141 +6,254 @@ import (
 	"fmt"
 	"log"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/dbrun3/nexus-vector/api"
 	"github.com/dbrun3/nexus-vector/dao"
+	"github.com/dbrun3/nexus-vector/metrics"
 	"github.com/dbrun3/nexus-vector/model"
 	"github.com/google/uuid"
-	"github.com/openai/openai-go/v2"
 	"github.com/qdrant/go-client/qdrant"
-	"golang.org/x/sync/errgroup"
 )
 
-func (n *Nexus) generateNewPages(request api.NexusRequest, syncEmbedding, asyncEmbedding []float32) {
-	g, gctx := errgroup.WithContext(context.Background())
+// generateNewPages generates and stores a user page, a trigger page and, when enabled, a contextual page for a tenant in
+// the given locale, reusing the request's embeddings for embeddingModel
+func (n *Nexus) generateNewPages(tenant string, settings tenantSettings, request api.NexusRequest, embeddingModel, locale string, syncEmbedding, asyncEmbedding []float32) {
+	skip, err := n.reserveGeneration(context.Background(), tenant, request.UserId, settings)
+	if err != nil {
+		fmt.Printf("Error generating new pages: %v\n", err)
+		return
+	}
+	if skip != "" {
+		metrics.GenerationsSkipped.WithLabelValues(skip).Inc()
+		if skip == SkipTenantLimit {
+			log.Printf("Background: Daily generation limit reached for tenant %s", tenant)
+		}
+		return
+	}
+
+	// Generations are independent, one failing doesn't stop the others
+	ctx := context.Background()
+	var wg sync.WaitGroup
+	generate := func(role GenerationRole, fn func() error) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := fn(); err != nil {
+				// Log error but don't block - this is background processing
+				fmt.Printf("Error generating new %s pages: %v\n", role, err)
+			}
+		}()
+	}
 
 	// Generate and store user page with async embedding
-	g.Go(func() error {
-		userPage, err := n.generateNewUserPage(gctx, request.UserId)
-		if err != nil {
-			return err
-		}
-		return n.StorePageInQdrant(gctx, userPage, asyncEmbedding)
+	generate(UserRole, func() error {
+		return n.generateNewUserPages(ctx, tenant, settings.promptVersions[UserRole], locale, request.UserId, func(ctx context.Context, userPages []model.Page, userText string) error {
+			source := dao.PageSource{Kind: dao.UserSource, Text: userText}
+			return n.storeGeneratedPages(ctx, tenant, request.UserId, settings, UserRole, locale, userPages, userText, embeddingModel, asyncEmbedding, source)
+		})
 	})
 
 	// Generate and store trigger page with sync embedding
-	g.Go(func() error {
-		triggerPage, err := n.generateNewTriggerPage(gctx, request.Trigger)
-		if err != nil {
-			return err
-		}
-		return n.StorePageInQdrant(gctx, triggerPage, syncEmbedding)
+	generate(TriggerRole, func() error {
+		return n.generateNewTriggerPages(ctx, tenant, settings.promptVersions[TriggerRole], locale, request.UserId, request.Trigger, func(ctx context.Context, triggerPages []model.Page, triggerText string) error {
+			source := dao.PageSource{Kind: dao.TriggerSource, Text: triggerText}
+			return n.storeGeneratedPages(ctx, tenant, request.UserId, settings, TriggerRole, locale, triggerPages, triggerText, embeddingModel, syncEmbedding, source)
+		})
 	})
 
-	// Wait for both generations to complete
-	if err := g.Wait(); err != nil {
-		// Log error but don't block - this is background processing
-		fmt.Printf("Error generating new pages: %v\n", err)
-		return
+	// Generate and store contextual page with the blend of both embeddings
+	if n.contextual.Enabled {
+		generate(ContextRole, func() error {
+			return n.generateNewContextPages(ctx, tenant, settings.promptVersions[ContextRole], locale, request.UserId, request.Trigger, func(ctx context.Context, contextPages []model.Page, userText, triggerText string) error {
+				weight := n.contextual.triggerWeight()
+				source := dao.PageSource{Kind: dao.ContextSource, Text: triggerText, UserText: userText, TriggerWeight: weight}
+				blended := blendEmbeddings(syncEmbedding, asyncEmbedding, weight)
+				return n.storeGeneratedPages(ctx, tenant, request.UserId, settings, ContextRole, locale, contextPages, contextText(userText, triggerText), embeddingModel, blended, source)
+			})
+		})
 	}
+
+	// Wait for every generation to complete
+	wg.Wait()
 }
 
-func (n *Nexus) generateNewUserPage(ctx context.Context, userId string) (model.Page, error) {
-	// Get user snapshot from MongoDB
-	userSnapshot, err := n.mdClient.GetUserSnapshot(ctx, userId)
+// storeGeneratedPages moderates, ranks and judges the candidate pages a role generated in a locale for input, storing
+// the best of them under embedding for embeddingModel. Moderation and judge requests count against userId's rate limit
+func (n *Nexus) storeGeneratedPages(ctx context.Context, tenant, userId string, settings tenantSettings, role GenerationRole, locale string, pages []model.Page, input, embeddingModel string, embedding []float32, source dao.PageSource) error {
+	for i := range pages {
+		pages[i].Locale = locale
+	}
+	pages = n.moderatePages(ctx, tenant, userId, role, settings, pages)
+	best, err := n.bestCandidates(ctx, role, embeddingModel, embedding, pages, dao.Generation{PromptVersion: settings.promptVersions[role]})
 	if err != nil {
-		return model.Page{}, fmt.Errorf("failed to get user snapshot: %w", err)
+		return err
+	}
+	best = n.judgePages(ctx, tenant, userId, role, settings.promptVersions[JudgeRole], input, best)
+	return n.storePages(ctx, tenant, best, map[string][]float32{embeddingModel: embedding}, source)
+}
+
+// userSnapshot reads a tenant's user snapshot from MongoDB along with the text their embedding is derived from
+func (n *Nexus) userSnapshot(ctx context.Context, tenant, userId string) (*model.UserSnapshot, string, error) {
+	userSnapshot, err := n.mdClient.GetUserSnapshot(ctx, storageTenant(tenant), userId)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to get user snapshot: %w", err)
 	}
 	if userSnapshot == nil {
-		return model.Page{}, fmt.Errorf("user snapshot not found for ID: %s", userId)
+		return nil, "", fmt.Errorf("user snapshot not found for ID: %s", userId)
 	}
 
-	// Marshal user snapshot for ChatGPT
-	userJSON, err := json.Marshal(userSnapshot)
+	userText, err := n.userEmbeddingText(*userSnapshot)
 	if err != nil {
-		return model.Page{}, fmt.Errorf("failed to marshal user snapshot: %w", err)
+		return nil, "", fmt.Errorf("failed to clean user snapshot: %w", err)
 	}
+	return userSnapshot, userText, nil
+}
 
-	log.Printf("Background: Generating user page for user %s", userId)
-	chatCompletion, err := n.oaClient.Chat.Completions.New(ctx, openai.ChatCompletionNewParams{
-		Messages: []openai.ChatCompletionMessageParamUnion{
-			openai.UserMessage(fmt.Sprintf("%s\n\nUser Profile: %s", AsyncPrompt, string(userJSON))),
-		},
-		Model: openai.ChatModelGPT4o,
-	})
+// generateNewUserPages generates candidate pages for a tenant's user in a locale with a version of the user prompt and
+// stores them along with the text their embedding is derived from. Nothing is stored when a user with an identical
+// profile shares the generation, whose pages are stored by the request that made it
+func (n *Nexus) generateNewUserPages(ctx context.Context, tenant, version, locale, userId string, store func(ctx context.Context, pages []model.Page, userText string) error) error {
+	// Get user snapshot from MongoDB
+	userSnapshot, userText, err := n.userSnapshot(ctx, tenant, userId)
 	if err != nil {
-		return model.Page{}, fmt.Errorf("OpenAI API error: %w", err)
+		return err
 	}
-	log.Printf("Background: Generated user page for user %s", userId)
 
-	var page model.Page
-	err = json.Unmarshal([]byte(stripCodeFences(chatCompletion.Choices[0].Message.Content)), &page)
+	// Marshal user snapshot for ChatGPT
+	userJSON, err := json.Marshal(userSnapshot)
 	if err != nil {
-		return model.Page{}, fmt.Errorf("failed to unmarshal page: %w", err)
+		return fmt.Errorf("failed to marshal user snapshot: %w", err)
 	}
 
-	return page, nil
+	prompt, err := n.prompts.Load().Render(UserRole, version, promptData(string(userJSON), locale))
+	if err != nil {
+		return err
+	}
+
+	return n.generateOnce(ctx, tenant, UserRole, version+"/"+locale, userText, func(ctx context.Context) ([]model.Page, error) {
+		log.Printf("Background: Generating user pages for user %s", userId)
+		pages, err := n.completePages(ctx, tenant, userId, UserRole, prompt, n.candidates)
+		if err != nil {
+			return nil, err
+		}
+		log.Printf("Background: Generated %d user pages for user %s", len(pages), userId)
+		return pages, nil
+	}, func(ctx context.Context, pages []model.Page) error {
+		return store(ctx, pages, userText)
+	})
 }
 
-func (n *Nexus) generateNewTriggerPage(ctx context.Context, trigger model.Trigger) (model.Page, error) {
-	// Marshal trigger for ChatGPT
-	triggerJSON, err := json.Marshal(trigger)
+// generateNewTriggerPages generates candidate pages for a trigger in a locale with a version of the trigger prompt and
+// stores them along with the text its embedding is derived from. Nothing is stored when an identical trigger shares the
+// generation, whose pages are stored by the request that made it
+func (n *Nexus) generateNewTriggerPages(ctx context.Context, tenant, version, locale, userId string, trigger model.Trigger, store func(ctx context.Context, pages []model.Page, triggerText string) error) error {
+	triggerText, err := n.serializer.TriggerText(trigger)
 	if err != nil {
-		return model.Page{}, fmt.Errorf("failed to marshal trigger: %w", err)
+		return fmt.Errorf("failed to clean trigger: %w", err)
 	}
 
-	log.Printf("Background: Generating trigger page for trigger type %s", trigger.TriggerType)
-	chatCompletion, err := n.oaClient.Chat.Completions.New(ctx, openai.ChatCompletionNewParams{
-		Messages: []openai.ChatCompletionMessageParamUnion{
-			openai.UserMessage(fmt.Sprintf("%s\n\nTrigger Context: %s", SyncPrompt, string(triggerJSON))),
-		},
-		Model: openai.ChatModelGPT4o,
-	})
+	// Marshal trigger for ChatGPT
+	triggerJSON, err := json.Marshal(trigger)
 	if err != nil {
-		return model.Page{}, fmt.Errorf("OpenAI API error: %w", err)
+		return fmt.Errorf("failed to marshal trigger: %w", err)
 	}
-	log.Printf("Background: Generated trigger page for trigger type %s", trigger.TriggerType)
 
-	var page model.Page
-	err = json.Unmarshal([]byte(stripCodeFences(chatCompletion.Choices[0].Message.Content)), &page)
+	prompt, err := n.prompts.Load().Render(TriggerRole, version, promptData(string(triggerJSON), locale))
 	if err != nil {
-		return model.Page{}, fmt.Errorf("failed to unmarshal page: %w", err)
+		return err
 	}
 
-	return page, nil
+	return n.generateOnce(ctx, tenant, TriggerRole, version+"/"+locale, triggerText, func(ctx context.Context) ([]model.Page, error) {
+		log.Printf("Background: Generating trigger pages for trigger type %s", trigger.TriggerType)
+		pages, err := n.completePages(ctx, tenant, userId, TriggerRole, prompt, n.candidates)
+		if err != nil {
+			return nil, err
+		}
+		log.Printf("Background: Generated %d trigger pages for trigger type %s", len(pages), trigger.TriggerType)
+		return pages, nil
+	}, func(ctx context.Context, pages []model.Page) error {
+		return store(ctx, pages, triggerText)
+	})
 }
 
-// StorePageInQdrant stores a single page with its embedding in Qdrant
-func (n *Nexus) StorePageInQdrant(ctx context.Context, page model.Page, embedding []float32) error {
+// StorePageInQdrant stores a single tenant page with its default model embedding, and the source text it was embedded from, in Qdrant
+func (n *Nexus) StorePageInQdrant(ctx context.Context, tenant string, page model.Page, embedding []float32, source dao.PageSource) error {
+	if _, err := n.tenant(tenant); err != nil {
+		return err
+	}
+	return n.storePages(ctx, tenant, []generatedPage{{page: page}}, map[string][]float32{n.models[0].Name: embedding}, source)
+}
+
+// storePages stores tenant pages derived from the same source with one vector per embedding model, embedding the source
+// once for any model missing from embeddings, and how each page was generated
+func (n *Nexus) storePages(ctx context.Context, tenant string, pages []generatedPage, embeddings map[string][]float32, source dao.PageSource) error {
+	if len(pages) == 0 {
+		return nil
+	}
+	if source.Text == "" && len(embeddings) < len(n.models) {
+		return fmt.Errorf("page has no source text to embed for every model")
+	}
+	embeddings, err := n.embedSource(ctx, source, embeddings)
+	if err != nil {
+		return fmt.Errorf("failed to create page embeddings: %w", err)
+	}
+	names, err := n.vectorSchema(ctx, n.pageCollection(tenant))
+	if err != nil {
+		return err
+	}
+	vectors, err := n.pointVectors(names, embeddings)
+	if err != nil {
+		return err
+	}
+
 	// Create payload with page, timestamp, and time range (in this case using a dummy range)
 	from := time.Now().Unix()
 	until := time.Now().Add(24 * time.Hour).Unix() // Valid for 24 hours
-	payload := dao.NewQdrantPagePayload(page, from, until)
 
-	// Generate unique ID for this page
-	pointID := uuid.New().String()
+	points := make([]*qdrant.PointStruct, len(pages))
+	for i, generated := range pages {
+		payload := dao.NewQdrantPagePayload(generated.page, source, tenant, from, until)
+		payload.Generation = generated.generation
 
-	// Create Qdrant point
-	point := &qdrant.PointStruct{
-		Id:      qdrant.NewID(pointID),
-		Vectors: qdrant.NewVectors(embedding...),
-		Payload: qdrant.NewValueMap(payload.ToMap()),
+		// Create Qdrant point with a unique ID for this page
+		points[i] = &qdrant.PointStruct{
+			Id:      qdrant.NewID(uuid.New().String()),
+			Vectors: vectors,
+			Payload: qdrant.NewValueMap(payload.ToMap()),
+		}
 	}
 
 	// Store in Qdrant
-	_, err := n.qdClient.Upsert(ctx, &qdrant.UpsertPoints{
-		CollectionName: PageCollection,
-		Points:         []*qdrant.PointStruct{point},
+	_, err = n.qdClient.Upsert(ctx, &qdrant.UpsertPoints{
+		CollectionName: n.pageCollection(tenant),
+		Points:         points,
 	})
 
 	if err != nil {
-		return fmt.Errorf("failed to store page in Qdrant: %w", err)
+		return fmt.Errorf("failed to store pages in Qdrant: %w", err)
 	}
 
 	return nil
 }
 
+// parsePage parses a generated page and validates it against the current page schema
+func parsePage(content string) (model.Page, error) {
+	var page model.Page
+	err := json.Unmarshal([]byte(stripCodeFences(content)), &page)
+	if err != nil {
+		return model.Page{}, fmt.Errorf("failed to unmarshal page: %w", err)
+	}
+
+	page.SchemaVersion = model.PageSchemaVersion
+	if err := page.Validate(); err != nil {
+		return model.Page{}, fmt.Errorf("generated page rejected: %w", err)
+	}
+
+	return page, nil
+}
+
 func stripCodeFences(s string) string {
 	s = strings.TrimSpace(s)
 	s = strings.TrimPrefix(s, "```json")
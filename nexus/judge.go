@@ -0,0 +1,221 @@
+package nexus
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"regexp"
+
+	"github.com/dbrun3/nexus-vector/metrics"
+	"github.com/dbrun3/nexus-vector/model"
+)
+
+// Scores a judge may give each rubric criterion
+const (
+	MinCriterionScore = 1
+	MaxCriterionScore = 5
+)
+
+// Verdicts of the judge on a page
+const (
+	JudgePassed   = "passed"
+	JudgeRejected = "rejected"
+	JudgeError    = "error"
+)
+
+// Criterion is one aspect of a page the judge scores. Names are used as JSON keys of the judge's output
+type Criterion struct {
+	Name        string  `json:"name"`
+	Description string  `json:"description"`
+	Weight      float64 `json:"weight,omitempty"` // defaults to 1
+}
+
+// DefaultRubric is the rubric used when JudgeConfig.Rubric is empty
+var DefaultRubric = []Criterion{
+	{Name: "relevance", Description: "The page directly relates to the trigger event or user profile it was generated for and offers them something of value."},
+	{Name: "clarity", Description: "Titles and subtitles are clear, concise and free of spelling or grammar mistakes, and any call to action is obvious."},
+	{Name: "policy_compliance", Description: "The page makes no misleading, medical or financial claims, contains nothing offensive and does not promote competitors."},
+}
+
+// JudgeConfig configures the LLM judge that scores generated pages before they are stored, its provider being
+// Config.Providers[JudgeRole]
+type JudgeConfig struct {
+	Enabled bool
+	Rubric  []Criterion
+
+	// Threshold is the quality score from 0 to 1 below which pages are dropped
+	Threshold float64
+
+	// FailOpen stores pages the judge fails to score unscored instead of dropping them, so a judge outage doesn't stop
+	// generation
+	FailOpen bool
+}
+
+// JudgeData is what a judge prompt template is rendered with
+type JudgeData struct {
+	Role   GenerationRole // the role that generated the page
+	Input  string         // the text the page was generated for
+	Page   string         // the page as JSON
+	Rubric []Criterion
+}
+
+// judgeVerdict is the judge's output
+type judgeVerdict struct {
+	Scores map[string]int `json:"scores"`
+	Reason string         `json:"reason"`
+}
+
+// Criterion names are used as JSON keys of the judge's structured output
+var criterionPattern = regexp.MustCompile(`^[a-z][a-z0-9_]{0,63}$`)
+
+// rubric returns the configured rubric, falling back to DefaultRubric
+func (c JudgeConfig) rubric() []Criterion {
+	if len(c.Rubric) == 0 {
+		return DefaultRubric
+	}
+	return c.Rubric
+}
+
+func (c JudgeConfig) validate() error {
+	if c.Threshold < 0 || c.Threshold > 1 {
+		return fmt.Errorf("judge threshold must be between 0 and 1, got %v", c.Threshold)
+	}
+	seen := make(map[string]bool, len(c.Rubric))
+	for _, criterion := range c.Rubric {
+		if !criterionPattern.MatchString(criterion.Name) {
+			return fmt.Errorf("invalid judge criterion name %q", criterion.Name)
+		}
+		if seen[criterion.Name] {
+			return fmt.Errorf("duplicate judge criterion %q", criterion.Name)
+		}
+		if criterion.Weight < 0 {
+			return fmt.Errorf("judge criterion %q has a negative weight", criterion.Name)
+		}
+		seen[criterion.Name] = true
+	}
+	return nil
+}
+
+// judgeSchema is the structured output schema of a verdict on a rubric
+func judgeSchema(rubric []Criterion) map[string]any {
+	properties := make(map[string]any, len(rubric))
+	required := make([]string, len(rubric))
+	for i, criterion := range rubric {
+		properties[criterion.Name] = map[string]any{"type": "integer"}
+		required[i] = criterion.Name
+	}
+	return map[string]any{
+		"type": "object",
+		"properties": map[string]any{
+			"scores": map[string]any{
+				"type":                 "object",
+				"properties":           properties,
+				"required":             required,
+				"additionalProperties": false,
+			},
+			"reason": map[string]any{"type": "string"},
+		},
+		"required":             []string{"scores", "reason"},
+		"additionalProperties": false,
+	}
+}
+
+// score combines a verdict's criterion scores into a weighted quality score from 0 to 1
+func (v judgeVerdict) score(rubric []Criterion) (float64, error) {
+	var total, weights float64
+	for _, criterion := range rubric {
+		s, ok := v.Scores[criterion.Name]
+		if !ok {
+			return 0, fmt.Errorf("judge gave no %s score", criterion.Name)
+		}
+		s = min(max(s, MinCriterionScore), MaxCriterionScore)
+
+		weight := criterion.Weight
+		if weight == 0 {
+			weight = 1
+		}
+		total += weight * float64(s-MinCriterionScore) / (MaxCriterionScore - MinCriterionScore)
+		weights += weight
+	}
+	if weights == 0 {
+		return 0, fmt.Errorf("judge rubric has no weight")
+	}
+	return total / weights, nil
+}
+
+// judgePage asks the judge for a page's quality score and the reason for its lowest criterion score
+func (n *Nexus) judgePage(ctx context.Context, tenant, userId string, role GenerationRole, version, input string, page model.Page) (float64, string, error) {
+	pageJSON, err := json.Marshal(page)
+	if err != nil {
+		return 0, "", fmt.Errorf("failed to marshal page: %w", err)
+	}
+
+	rubric := n.judge.rubric()
+	prompt, err := n.prompts.Load().Render(JudgeRole, version, JudgeData{
+		Role:   role,
+		Input:  input,
+		Page:   string(pageJSON),
+		Rubric: rubric,
+	})
+	if err != nil {
+		return 0, "", err
+	}
+
+	chatCompletion, err := n.complete(ctx, tenant, userId, JudgeRole, prompt, 1, "verdict", judgeSchema(rubric))
+	if err != nil {
+		return 0, "", err
+	}
+	if len(chatCompletion.Choices) == 0 {
+		return 0, "", fmt.Errorf("OpenAI API returned no choices")
+	}
+	content, err := choiceContent(chatCompletion.Choices[0])
+	if err != nil {
+		return 0, "", err
+	}
+
+	var verdict judgeVerdict
+	if err := json.Unmarshal([]byte(stripCodeFences(content)), &verdict); err != nil {
+		return 0, "", fmt.Errorf("failed to unmarshal verdict: %w", err)
+	}
+	score, err := verdict.score(rubric)
+	if err != nil {
+		return 0, "", err
+	}
+	return score, verdict.Reason, nil
+}
+
+// judgePages scores pages with the judge when it is enabled, recording each page's score and dropping pages below the
+// threshold. Pages the judge fails to score are dropped too, unless the judge fails open
+func (n *Nexus) judgePages(ctx context.Context, tenant, userId string, role GenerationRole, version, input string, pages []generatedPage) []generatedPage {
+	if !n.judge.Enabled {
+		return pages
+	}
+
+	passed := make([]generatedPage, 0, len(pages))
+	for _, generated := range pages {
+		score, reason, err := n.judgePage(ctx, tenant, userId, role, version, input, generated.page)
+		if err != nil {
+			metrics.JudgeVerdicts.WithLabelValues(string(role), JudgeError).Inc()
+			if !n.judge.FailOpen {
+				log.Printf("Background: Failed to judge %s page, dropping it: %v", role, err)
+				continue
+			}
+			log.Printf("Background: Failed to judge %s page, storing it unscored: %v", role, err)
+			passed = append(passed, generated)
+			continue
+		}
+
+		metrics.JudgeScores.WithLabelValues(string(role)).Observe(score)
+		if score < n.judge.Threshold {
+			metrics.JudgeVerdicts.WithLabelValues(string(role), JudgeRejected).Inc()
+			log.Printf("Background: Judge rejected %s page %q with score %.2f: %s", role, pageCopy(generated.page), score, reason)
+			continue
+		}
+
+		metrics.JudgeVerdicts.WithLabelValues(string(role), JudgePassed).Inc()
+		generated.generation.QualityScore = float32(score)
+		passed = append(passed, generated)
+	}
+	return passed
+}
@@ -0,0 +1,190 @@
+package nexus
+
+import (
+	"context"
+	"encoding/json"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/dbrun3/nexus-vector/model"
+)
+
+func TestJudgePrompt(t *testing.T) {
+	prompts, err := LoadPrompts("")
+	if err != nil {
+		t.Fatalf("LoadPrompts() error = %v", err)
+	}
+
+	for role, expected := range map[GenerationRole]string{
+		TriggerRole: "The page was generated in response to this trigger event:\nsnap at Target",
+		UserRole:    "The page was generated for this user profile:\nsnap at Target",
+	} {
+		prompt, err := prompts.Render(JudgeRole, DefaultPromptVersion, JudgeData{
+			Role:   role,
+			Input:  "snap at Target",
+			Page:   testPageJSON,
+			Rubric: DefaultRubric,
+		})
+		if err != nil {
+			t.Fatalf("Render(%s) error = %v", role, err)
+		}
+
+		for _, s := range []string{expected, testPageJSON, `{"scores": {"relevance": 4}`} {
+			if !strings.Contains(prompt, s) {
+				t.Errorf("Expected judge prompt for %s to contain %q, got:\n%s", role, s, prompt)
+			}
+		}
+		for _, criterion := range DefaultRubric {
+			if !strings.Contains(prompt, "- "+criterion.Name+": "+criterion.Description) {
+				t.Errorf("Expected judge prompt to contain criterion %s, got:\n%s", criterion.Name, prompt)
+			}
+		}
+	}
+}
+
+func TestVerdictScore(t *testing.T) {
+	rubric := []Criterion{
+		{Name: "relevance", Weight: 3},
+		{Name: "clarity"},
+	}
+
+	tests := []struct {
+		name     string
+		scores   map[string]int
+		expected float64
+		wantErr  bool
+	}{
+		{name: "best", scores: map[string]int{"relevance": 5, "clarity": 5}, expected: 1},
+		{name: "worst", scores: map[string]int{"relevance": 1, "clarity": 1}, expected: 0},
+		{name: "weighted", scores: map[string]int{"relevance": 5, "clarity": 1}, expected: 0.75},
+		{name: "out of range scores are clamped", scores: map[string]int{"relevance": 9, "clarity": -2}, expected: 0.75},
+		{name: "missing criterion", scores: map[string]int{"relevance": 5}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			score, err := judgeVerdict{Scores: tt.scores}.score(rubric)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("score() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if math.Abs(score-tt.expected) > 1e-9 {
+				t.Errorf("score() = %v, expected %v", score, tt.expected)
+			}
+		})
+	}
+}
+
+func TestJudgeConfigValidate(t *testing.T) {
+	tests := []struct {
+		name    string
+		config  JudgeConfig
+		wantErr bool
+	}{
+		{name: "default rubric", config: JudgeConfig{Enabled: true, Threshold: 0.6}},
+		{name: "threshold above 1", config: JudgeConfig{Threshold: 1.5}, wantErr: true},
+		{name: "invalid criterion name", config: JudgeConfig{Rubric: []Criterion{{Name: "Tone of voice"}}}, wantErr: true},
+		{name: "duplicate criterion", config: JudgeConfig{Rubric: []Criterion{{Name: "tone"}, {Name: "tone"}}}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.config.validate(); (err != nil) != tt.wantErr {
+				t.Errorf("validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestJudgePages(t *testing.T) {
+	type received struct {
+		model, schema, prompt string
+	}
+	var requests []received
+
+	// The judge scores pages by title: good pages pass, bad pages fail and broken pages make it error
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var request struct {
+			Model    string `json:"model"`
+			Messages []struct {
+				Content string `json:"content"`
+			} `json:"messages"`
+			ResponseFormat struct {
+				JSONSchema struct {
+					Name string `json:"name"`
+				} `json:"json_schema"`
+			} `json:"response_format"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+			t.Errorf("Failed to decode request: %v", err)
+		}
+		prompt := request.Messages[0].Content
+		requests = append(requests, received{model: request.Model, schema: request.ResponseFormat.JSONSchema.Name, prompt: prompt})
+
+		w.Header().Set("Content-Type", "application/json")
+		verdict := `{"scores":{"relevance":5,"clarity":4,"policy_compliance":5},"reason":"Clear"}`
+		switch {
+		case strings.Contains(prompt, "Bad Page"):
+			verdict = `{"scores":{"relevance":2,"clarity":1,"policy_compliance":3},"reason":"Off topic"}`
+		case strings.Contains(prompt, "Broken Page"):
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(map[string]any{"error": map[string]any{"message": "context too long", "type": "invalid_request_error"}})
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]any{
+			"choices": []any{map[string]any{
+				"finish_reason": "stop",
+				"message":       map[string]any{"role": "assistant", "content": verdict},
+			}},
+		})
+	}))
+	defer server.Close()
+
+	config := &Config{
+		LLM:       ProviderConfig{BaseURL: server.URL, APIKey: "test"},
+		Providers: map[GenerationRole]ProviderConfig{JudgeRole: {Model: "judge-model"}},
+		Judge:     JudgeConfig{Enabled: true, Threshold: 0.6},
+	}
+	generators, err := newGenerators(config)
+	if err != nil {
+		t.Fatalf("newGenerators() error = %v", err)
+	}
+	prompts, err := LoadPrompts("")
+	if err != nil {
+		t.Fatalf("LoadPrompts() error = %v", err)
+	}
+	n := &Nexus{generators: generators, rdClient: unreachableRedis(), judge: config.Judge}
+	n.prompts.Store(prompts)
+
+	pages := []generatedPage{
+		{page: model.Page{Layout: "card", Title: []string{"Good Page"}}},
+		{page: model.Page{Layout: "card", Title: []string{"Bad Page"}}},
+		{page: model.Page{Layout: "card", Title: []string{"Broken Page"}}},
+	}
+	passed := n.judgePages(context.Background(), DefaultTenant, "", TriggerRole, DefaultPromptVersion, "snap at Target", pages)
+
+	if len(passed) != 1 || passed[0].page.Title[0] != "Good Page" {
+		t.Fatalf("Expected only the good page to pass, got %+v", passed)
+	}
+	// relevance 5, clarity 4 and policy compliance 5 of 5
+	if score := passed[0].generation.QualityScore; math.Abs(float64(score)-11.0/12) > 1e-6 {
+		t.Errorf("Expected quality score %v, got %v", 11.0/12, score)
+	}
+
+	// Failing open keeps pages the judge failed to score, unscored
+	n.judge.FailOpen = true
+	passed = n.judgePages(context.Background(), DefaultTenant, "", TriggerRole, DefaultPromptVersion, "snap at Target", pages)
+	if len(passed) != 2 || passed[1].page.Title[0] != "Broken Page" || passed[1].generation.QualityScore != 0 {
+		t.Fatalf("Expected the good page and the unscored broken page to pass, got %+v", passed)
+	}
+
+	for _, request := range requests {
+		if request.model != "judge-model" || request.schema != "verdict" {
+			t.Errorf("Expected judge-model requests with the verdict schema, got %+v", request)
+		}
+		if !strings.Contains(request.prompt, "snap at Target") || !strings.Contains(request.prompt, "- policy_compliance: ") {
+			t.Errorf("Expected the judge prompt to contain the input and rubric, got:\n%s", request.prompt)
+		}
+	}
+}
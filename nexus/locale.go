@@ -0,0 +1,95 @@
+package nexus
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/dbrun3/nexus-vector/api"
+	"github.com/dbrun3/nexus-vector/model"
+	"github.com/qdrant/go-client/qdrant"
+)
+
+// DefaultLocale is the locale of pages stored before pages carried one
+const DefaultLocale = "en"
+
+// Language names used to instruct generation, locales without one are passed to the LLM as is
+var localeLanguages = map[string]string{
+	"en": "English",
+	"es": "Spanish",
+	"fr": "French",
+}
+
+// normalizeLocale lowercases a locale tag and uses '-' as its separator, e.g. "es_MX" -> "es-mx"
+func normalizeLocale(locale string) string {
+	return strings.ReplaceAll(strings.ToLower(strings.TrimSpace(locale)), "_", "-")
+}
+
+// localePreference returns the supported locales a request accepts, most preferred first. A requested locale that
+// is not supported falls back to its base language, and the first supported locale is always accepted last
+func (n *Nexus) localePreference(request api.NexusRequest) []string {
+	requested := append([]string{request.Locale}, request.FallbackLocales...)
+	preference := make([]string, 0, len(requested)+1)
+
+	accept := func(locale string) bool {
+		if !slices.Contains(n.locales, locale) {
+			return false
+		}
+		if !slices.Contains(preference, locale) {
+			preference = append(preference, locale)
+		}
+		return true
+	}
+
+	for _, locale := range requested {
+		locale = normalizeLocale(locale)
+		if locale == "" || accept(locale) {
+			continue
+		}
+		if base, _, ok := strings.Cut(locale, "-"); ok {
+			accept(base)
+		}
+	}
+	accept(n.locales[0])
+
+	return preference
+}
+
+// localeCondition restricts a query to pages in any of the given locales, pages stored without a locale being in DefaultLocale
+func localeCondition(locales []string) *qdrant.Condition {
+	conditions := []*qdrant.Condition{
+		qdrant.NewMatchKeywords("locale", locales...),
+	}
+	if slices.Contains(locales, DefaultLocale) {
+		conditions = append(conditions, qdrant.NewIsEmpty("locale"))
+	}
+	return qdrant.NewFilterAsCondition(&qdrant.Filter{
+		Should: conditions,
+	})
+}
+
+// preferLocale keeps only the pages of the most preferred locale that has any pages
+func preferLocale(pages []model.Page, locales []string) []model.Page {
+	for _, locale := range locales {
+		preferred := make([]model.Page, 0, len(pages))
+		for _, page := range pages {
+			if page.Locale == locale {
+				preferred = append(preferred, page)
+			}
+		}
+		if len(preferred) > 0 {
+			return preferred
+		}
+	}
+	return pages
+}
+
+// promptData is the prompt template data for an input in a locale
+func promptData(input, locale string) PromptData {
+	base, _, _ := strings.Cut(locale, "-")
+	language, ok := localeLanguages[base]
+	if !ok {
+		language = fmt.Sprintf("the language of locale %q", locale)
+	}
+	return PromptData{Input: input, Locale: locale, Language: language}
+}
@@ -0,0 +1,72 @@
+package nexus
+
+import (
+	"slices"
+	"testing"
+
+	"github.com/dbrun3/nexus-vector/api"
+	"github.com/dbrun3/nexus-vector/model"
+)
+
+func TestLocalePreference(t *testing.T) {
+	n := &Nexus{locales: []string{"en", "es", "fr", "fr-ca"}}
+
+	tests := []struct {
+		name     string
+		request  api.NexusRequest
+		expected []string
+	}{
+		{
+			name:     "no locale requested",
+			request:  api.NexusRequest{},
+			expected: []string{"en"},
+		},
+		{
+			name:     "supported locale",
+			request:  api.NexusRequest{Locale: "es"},
+			expected: []string{"es", "en"},
+		},
+		{
+			name:     "regional locale falls back to base language",
+			request:  api.NexusRequest{Locale: "es_MX"},
+			expected: []string{"es", "en"},
+		},
+		{
+			name:     "supported regional locale",
+			request:  api.NexusRequest{Locale: "fr-CA", FallbackLocales: []string{"fr"}},
+			expected: []string{"fr-ca", "fr", "en"},
+		},
+		{
+			name:     "unsupported locales are dropped",
+			request:  api.NexusRequest{Locale: "de", FallbackLocales: []string{"it", "fr", "es", "fr"}},
+			expected: []string{"fr", "es", "en"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			preference := n.localePreference(tt.request)
+			if !slices.Equal(preference, tt.expected) {
+				t.Errorf("localePreference() = %v, expected %v", preference, tt.expected)
+			}
+		})
+	}
+}
+
+func TestPreferLocale(t *testing.T) {
+	pages := []model.Page{
+		{Id: "1", Locale: "en"},
+		{Id: "2", Locale: "fr"},
+		{Id: "3", Locale: "en"},
+	}
+
+	if preferred := preferLocale(pages, []string{"fr", "en"}); len(preferred) != 1 || preferred[0].Id != "2" {
+		t.Errorf("Expected only the French page, got %+v", preferred)
+	}
+	if preferred := preferLocale(pages, []string{"es", "en"}); len(preferred) != 2 || preferred[0].Id != "1" {
+		t.Errorf("Expected the English fallback pages, got %+v", preferred)
+	}
+	if preferred := preferLocale(nil, []string{"en"}); len(preferred) != 0 {
+		t.Errorf("Expected no pages, got %+v", preferred)
+	}
+}
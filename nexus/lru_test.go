@@ -0,0 +1,42 @@
+package nexus
+
+import "testing"
+
+func TestLRU(t *testing.T) {
+	c := newLRU[string, int](2)
+	c.add("a", 1)
+	c.add("b", 2)
+
+	// Reading a marks it as recently used, so adding c evicts b
+	if v, ok := c.get("a"); !ok || v != 1 {
+		t.Fatalf("get(a) = %v, %v", v, ok)
+	}
+	c.add("c", 3)
+	if _, ok := c.get("b"); ok {
+		t.Error("Expected b to be evicted")
+	}
+
+	c.add("a", 4)
+	if v, _ := c.get("a"); v != 4 || c.len() != 2 {
+		t.Errorf("Expected a updated to 4 with 2 entries, got %v with %d", v, c.len())
+	}
+}
+
+func TestNewTriggerCache(t *testing.T) {
+	c := newTriggerCache(TriggerCacheConfig{})
+	if c.memory == nil || c.memory.size != DefaultTriggerCacheSize || c.ttl != DefaultTriggerCacheTTL {
+		t.Errorf("Expected the default cache, got %+v", c)
+	}
+
+	c = newTriggerCache(TriggerCacheConfig{Size: -1, TTL: -1})
+	if c.memory != nil || c.ttl != 0 {
+		t.Errorf("Expected both tiers disabled, got %+v", c)
+	}
+
+	if triggerCacheKey("a", "", 0, "bc") == triggerCacheKey("ab", "", 0, "c") {
+		t.Error("Expected keys of different models and texts to differ")
+	}
+	if triggerCacheKey("a", "1.0", 0, "b") == triggerCacheKey("a", "2.0", 0, "b") || triggerCacheKey("a", "", 0, "b") == triggerCacheKey("a", "", 1, "b") {
+		t.Error("Expected keys of different model versions and generations to differ")
+	}
+}
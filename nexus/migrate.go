@@ -0,0 +1,185 @@
+package nexus
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/dbrun3/nexus-vector/dao"
+	"github.com/redis/go-redis/v9"
+)
+
+// NewRedisClient creates a Redis client, on port 6379 unless host has one
+func NewRedisClient(host string) *redis.Client {
+	if !strings.Contains(host, ":") {
+		host += ":6379"
+	}
+	return redis.NewClient(&redis.Options{
+		Addr:     host,
+		Password: "", // no password set
+		DB:       0,  // use default DB
+	})
+}
+
+// EmbeddingMigration summarizes a migration of the embeddings stored in Redis
+type EmbeddingMigration struct {
+	Encoding dao.EmbeddingEncoding `json:"encoding"`
+	DryRun   bool                  `json:"dry_run"`  // nothing was written, Migrated counting the embeddings to re-encode
+	Scanned  int                   `json:"scanned"`  // keys
+	Migrated int                   `json:"migrated"` // embeddings re-encoded
+	Current  int                   `json:"current"`  // embeddings already in Encoding
+	Skipped  int                   `json:"skipped"`  // keys that don't hold embeddings
+}
+
+// errNotEmbedding skips a key that does not hold an embedding
+var errNotEmbedding = errors.New("not an embedding")
+
+// embeddingKeyType returns the Redis type of the embeddings stored under key, false for keys that don't store embeddings:
+// user embeddings (also under bare user IDs before keys were versioned by model), user facet embeddings and cached
+// trigger embeddings
+func embeddingKeyType(key string) (string, bool) {
+	if strings.HasPrefix(key, "trigger_embedding:") {
+		return "string", true
+	}
+	if !strings.Contains(key, ":") {
+		if key == triggerGenerationKey {
+			return "", false
+		}
+		return "string", true
+	}
+
+	// Strip a tenant's t:{tenant}: prefix
+	if rest, ok := strings.CutPrefix(key, tenantKeyPrefix+"{"); ok {
+		if _, after, found := strings.Cut(rest, "}:"); found {
+			key = after
+		}
+	}
+	switch {
+	case strings.HasPrefix(key, "embedding:"):
+		return "string", true
+	case strings.HasPrefix(key, "facets:"):
+		return "hash", true
+	}
+	return "", false
+}
+
+// MigrateEmbeddings re-encodes every user, user facet and trigger embedding stored in Redis with encoding, keeping their
+// expiry. Only keys Nexus stores embeddings under are read, other keys are left untouched, and an embedding rewritten
+// while it is migrated keeps the newer value. A dry run counts the embeddings to re-encode without writing them
+func MigrateEmbeddings(ctx context.Context, rdClient *redis.Client, encoding dao.EmbeddingEncoding, dryRun bool) (EmbeddingMigration, error) {
+	if encoding == "" {
+		encoding = dao.DefaultEmbeddingEncoding
+	}
+	migration := EmbeddingMigration{Encoding: encoding, DryRun: dryRun}
+
+	// Legacy user embeddings are stored under bare user IDs, so every key is scanned
+	iter := rdClient.Scan(ctx, 0, "*", 1000).Iterator()
+	for iter.Next(ctx) {
+		key := iter.Val()
+		migration.Scanned++
+
+		expected, ok := embeddingKeyType(key)
+		if !ok {
+			migration.Skipped++
+			continue
+		}
+
+		current := false
+		err := rdClient.Watch(ctx, func(tx *redis.Tx) error {
+			kind, err := tx.Type(ctx, key).Result()
+			if err != nil {
+				return err
+			}
+			if kind != expected {
+				return errNotEmbedding
+			}
+
+			switch kind {
+			case "string":
+				value, err := tx.Get(ctx, key).Result()
+				if err != nil {
+					// Gone since it was scanned
+					return errNotEmbedding
+				}
+				migrated, err := reencodeEmbedding(value, encoding)
+				if err != nil {
+					return err
+				}
+				if migrated == "" {
+					current = true
+					return nil
+				}
+				if dryRun {
+					return nil
+				}
+				_, err = tx.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+					return pipe.SetArgs(ctx, key, migrated, redis.SetArgs{KeepTTL: true}).Err()
+				})
+				return err
+
+			default:
+				// User facet embeddings, keyed by facet
+				values, err := tx.HGetAll(ctx, key).Result()
+				if err != nil {
+					return err
+				}
+				if len(values) == 0 {
+					return errNotEmbedding
+				}
+				var fields []any
+				for field, value := range values {
+					migrated, err := reencodeEmbedding(value, encoding)
+					if err != nil {
+						return err
+					}
+					if migrated != "" {
+						fields = append(fields, field, migrated)
+					}
+				}
+				if len(fields) == 0 {
+					current = true
+					return nil
+				}
+				if dryRun {
+					return nil
+				}
+				_, err = tx.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+					return pipe.HSet(ctx, key, fields...).Err()
+				})
+				return err
+			}
+		}, key)
+
+		switch {
+		case errors.Is(err, errNotEmbedding):
+			migration.Skipped++
+		case errors.Is(err, redis.TxFailedErr):
+			// Rewritten by Nexus while it was migrated
+		case err != nil:
+			return migration, fmt.Errorf("failed to migrate %s: %w", key, err)
+		case current:
+			migration.Current++
+		default:
+			migration.Migrated++
+		}
+	}
+	if err := iter.Err(); err != nil {
+		return migration, fmt.Errorf("failed to scan Redis keys: %w", err)
+	}
+
+	return migration, nil
+}
+
+// reencodeEmbedding returns an embedding stored in Redis re-encoded with encoding, or an empty string when it already is.
+// Values that are not embeddings fail with errNotEmbedding
+func reencodeEmbedding(value string, encoding dao.EmbeddingEncoding) (string, error) {
+	embedding, from, err := dao.ParseEmbedding(value)
+	if err != nil || len(embedding) == 0 {
+		return "", errNotEmbedding
+	}
+	if from == encoding {
+		return "", nil
+	}
+	return dao.EmbeddingToRedis(embedding, encoding)
+}
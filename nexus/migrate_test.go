@@ -0,0 +1,105 @@
+package nexus
+
+import (
+	"context"
+	"testing"
+
+	"github.com/dbrun3/nexus-vector/dao"
+)
+
+func TestEmbeddingKeyType(t *testing.T) {
+	tests := []struct {
+		key  string
+		kind string
+		ok   bool
+	}{
+		{"user-1", "string", true}, // legacy bare user ID
+		{"embedding:minilm:user-1", "string", true},
+		{"t:{acme}:embedding:minilm:user-1", "string", true},
+		{"facets:minilm:user-1", "hash", true},
+		{"t:{acme}:facets:minilm:user-1", "hash", true},
+		{"trigger_embedding:0af3", "string", true},
+		{"trigger_embedding_generation", "", false},
+		{"generated:0af3", "", false},
+		{"t:{acme}:llm_rate:user-1:29000000", "", false},
+		{"llm_budget:2026-10-18", "", false},
+		{"drift_baseline:minilm:user", "", false},
+	}
+	for _, tt := range tests {
+		kind, ok := embeddingKeyType(tt.key)
+		if ok != tt.ok || kind != tt.kind {
+			t.Errorf("embeddingKeyType(%q) = %q, %v, want %q, %v", tt.key, kind, ok, tt.kind, tt.ok)
+		}
+	}
+}
+
+func TestMigrateEmbeddings(t *testing.T) {
+	fake, rdClient := newFakeRedis(t)
+	ctx := context.Background()
+
+	encode := func(encoding dao.EmbeddingEncoding) string {
+		value, err := dao.EmbeddingToRedis([]float32{0.5, -0.25, 1}, encoding)
+		if err != nil {
+			t.Fatalf("EmbeddingToRedis() error = %v", err)
+		}
+		return value
+	}
+	legacy, binary := encode(dao.JSONEncoding), encode(dao.Float32Encoding)
+
+	fake.Set("user-1", legacy)
+	fake.Set("embedding:minilm:user-1", legacy)
+	fake.Set("t:{acme}:embedding:minilm:user-2", binary)
+	fake.HSet("facets:minilm:user-1", "groceries", legacy, "electronics", binary)
+	fake.Set("trigger_embedding:0af3", legacy)
+
+	// Values of other keys that look like embeddings are never rewritten
+	fake.Set("drift_baseline:minilm:user", legacy)
+	fake.Set("generated:0af3", "\x011")
+	fake.HSet("llm_budget:2026-10-18", "tokens", "[1]")
+
+	untouched := map[string]string{"drift_baseline:minilm:user": legacy, "generated:0af3": "\x011"}
+	migrated := []string{"user-1", "embedding:minilm:user-1", "trigger_embedding:0af3"}
+
+	// A dry run counts without writing
+	migration, err := MigrateEmbeddings(ctx, rdClient, dao.Float32Encoding, true)
+	if err != nil {
+		t.Fatalf("MigrateEmbeddings() error = %v", err)
+	}
+	if migration.Scanned != 8 || migration.Migrated != 4 || migration.Current != 1 || migration.Skipped != 3 {
+		t.Errorf("Unexpected dry run %+v", migration)
+	}
+	for _, key := range migrated {
+		if value, _ := fake.Get(key); value != legacy {
+			t.Errorf("Expected a dry run to leave %s untouched, got %q", key, value)
+		}
+	}
+
+	migration, err = MigrateEmbeddings(ctx, rdClient, dao.Float32Encoding, false)
+	if err != nil {
+		t.Fatalf("MigrateEmbeddings() error = %v", err)
+	}
+	if migration.Migrated != 4 || migration.Current != 1 || migration.Skipped != 3 {
+		t.Errorf("Unexpected migration %+v", migration)
+	}
+	for _, key := range migrated {
+		if value, _ := fake.Get(key); value != binary {
+			t.Errorf("Expected %s re-encoded, got %q", key, value)
+		}
+	}
+	if value := fake.HGet("facets:minilm:user-1", "groceries"); value != binary {
+		t.Errorf("Expected the facet embedding re-encoded, got %q", value)
+	}
+	for key, value := range untouched {
+		if got, _ := fake.Get(key); got != value {
+			t.Errorf("Expected %s untouched, got %q", key, got)
+		}
+	}
+	if value := fake.HGet("llm_budget:2026-10-18", "tokens"); value != "[1]" {
+		t.Errorf("Expected the budget untouched, got %q", value)
+	}
+
+	// Everything is current afterwards
+	if migration, err = MigrateEmbeddings(ctx, rdClient, dao.Float32Encoding, false); err != nil || migration.Migrated != 0 || migration.Current != 5 {
+		t.Errorf("Expected every embedding current, got %+v, %v", migration, err)
+	}
+}
@@ -0,0 +1,32 @@
+package nexus
+
+import (
+	"context"
+
+	"github.com/dbrun3/nexus-vector/torchserve"
+)
+
+// EmbeddingModelStatus is a configured embedding model with every version of it TorchServe has registered
+type EmbeddingModelStatus struct {
+	Name       string                        `json:"name"`
+	Dimension  uint64                        `json:"dimension"`
+	Version    torchserve.ModelVersion       `json:"version"`
+	Registered []torchserve.ModelDescription `json:"registered"`
+	Error      string                        `json:"error,omitempty"` // why TorchServe could not describe the model
+}
+
+// EmbeddingModels describes every configured embedding model with the TorchServe management API
+func (n *Nexus) EmbeddingModels(ctx context.Context) []EmbeddingModelStatus {
+	statuses := make([]EmbeddingModelStatus, len(n.models))
+	for i, m := range n.models {
+		statuses[i] = EmbeddingModelStatus{Name: m.Name, Dimension: m.Dimension, Version: m.Version}
+
+		descriptions, err := n.tsAdmin.DescribeModel(ctx, m.Name, "all")
+		if err != nil {
+			statuses[i].Error = err.Error()
+			continue
+		}
+		statuses[i].Registered = descriptions
+	}
+	return statuses
+}
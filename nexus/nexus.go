@@ -2,13 +2,16 @@ package nexus
 
 import (
 	"context"
-	"encoding/json"
 	"fmt"
+	"log"
 	"math/rand/v2"
-	"sort"
-	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/dbrun3/nexus-vector/api"
+	"github.com/dbrun3/nexus-vector/dao"
+	"github.com/dbrun3/nexus-vector/metrics"
 	"github.com/dbrun3/nexus-vector/model"
 	"github.com/dbrun3/nexus-vector/mongo"
 	"github.com/dbrun3/nexus-vector/qdrant_util"
@@ -16,43 +19,95 @@ import (
 	"github.com/qdrant/go-client/qdrant"
 
 	"github.com/dbrun3/nexus-vector/torchserve"
-	"github.com/openai/openai-go/v2"
-	"github.com/openai/openai-go/v2/option"
 	"github.com/redis/go-redis/v9"
 	"golang.org/x/sync/errgroup"
+	"golang.org/x/sync/singleflight"
 )
 
+// PageCollection is an alias of the physical collection currently being served
 const PageCollection = "page_collection"
 const VectorSize = 384 // default all-minilm-l6-v2 size
 const MinScore = 0.9
 const NewGenerateChance = 0.1
 
+// Payload fields indexed for filtering in every page collection
+var indexedFields = []string{"tenant", "locale", "source.kind", "generation.prompt_version"}
+
 type Nexus struct {
-	oaClient *openai.Client
 	qdClient *qdrant.Client
 	tsClient *torchserve.Client
+	tsAdmin  *torchserve.ManagementClient
 	rdClient *redis.Client
 	mdClient *mongo.Client
 	env      Env
+
+	// Embedding models in configured order (default first), each with a TorchServe client sharing tsClient's connection
+	models    []EmbeddingModel
+	embedders map[string]*torchserve.Client
+	normalize bool // scale every embedding to unit length
+	encoding  dao.EmbeddingEncoding
+
+	// Turns users and triggers into the text they are embedded from
+	serializer util.Serializer
+
+	isolation TenantIsolation
+	tenants   map[string]tenantSettings
+
+	// Named vectors of every page collection, read at startup and refreshed every VectorSchemaRefresh
+	vectors vectorSchemas
+
+	// Trigger embeddings cached by model and cleaned text
+	triggerCache *triggerCache
+
+	// Supported locales, the first being every request's fallback
+	locales []string
+
+	// LLM clients of each generation role
+	generators map[GenerationRole]*generator
+	limits     GenerationLimits
+	paused     atomic.Bool
+
+	// Prompt templates, swapped when reloaded from promptDir
+	prompts   atomic.Pointer[Prompts]
+	promptDir string
+
+	// Candidate pages generated per role and how many of the best are stored
+	candidates     int
+	keepCandidates int
+	judge          JudgeConfig
+	moderator      *moderator
+
+	// Contextual pages generated for a user and trigger together
+	contextual ContextConfig
+
+	// Whether users are also represented by a vector per interest facet
+	userVectors UserVectorConfig
+
+	// Recently sampled embeddings compared to their baseline statistics, nil when disabled
+	drift *driftMonitor
+
+	// Curated template pages served while page generation is unavailable
+	fallbackPages []model.Page
+
+	// The last reindex started in the background
+	reindexMu  sync.Mutex
+	reindexJob *ReindexJob
+
+	// Generations in flight in this replica and how long their outputs are reused
+	inflight         singleflight.Group
+	generationWindow time.Duration
 }
 
 func InitializeNexus(ctx context.Context, config *Config) (*Nexus, error) {
 
-	// setup openai
-	oaClient := openai.NewClient(
-		option.WithAPIKey(config.OpenAIKey),
-	)
+	// setup openai compatible clients
+	generators, err := newGenerators(config)
+	if err != nil {
+		return nil, err
+	}
 
 	// setup redis
-	redisHost := config.RedisHost
-	if !strings.Contains(redisHost, ":") {
-		redisHost += ":6379"
-	}
-	rdClient := redis.NewClient(&redis.Options{
-		Addr:     redisHost,
-		Password: "", // no password set
-		DB:       0,  // use default DB
-	})
+	rdClient := NewRedisClient(config.RedisHost)
 
 	// setup mongodb (on prod only)
 	mdClient, err := mongo.NewClient(config.MongoHost, config.MongoUser, config.MongoPass)
@@ -60,127 +115,303 @@ func InitializeNexus(ctx context.Context, config *Config) (*Nexus, error) {
 		return nil, fmt.Errorf("failed to create MongoDB client: %w", err)
 	}
 
-	// setup qdrant
-	qdClient, err := qdrant_util.NewClient(ctx, config.QdrantHost, PageCollection, VectorSize)
+	serializer, err := util.NewSerializer(config.TextFormat)
+	if err != nil {
+		return nil, err
+	}
+
+	candidates, keepCandidates := config.candidates()
+	if err := config.Judge.validate(); err != nil {
+		return nil, err
+	}
+	if err := config.Context.validate(); err != nil {
+		return nil, err
+	}
+	if err := config.UserVectors.validate(); err != nil {
+		return nil, err
+	}
+	if err := config.Drift.validate(); err != nil {
+		return nil, err
+	}
+	moderator, err := newModerator(config)
+	if err != nil {
+		return nil, err
+	}
+
+	fallbackPages, err := LoadFallbackPages(config.FallbackPages)
+	if err != nil {
+		return nil, err
+	}
+
+	tenants, err := newTenants(config.Tenants, config.PromptVersions)
+	if err != nil {
+		return nil, err
+	}
+
+	// load prompt templates and make sure every selected version exists
+	prompts, err := LoadPrompts(config.PromptDir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load prompts: %w", err)
+	}
+	if err := prompts.check(tenants); err != nil {
+		return nil, err
+	}
+	isolation := config.TenantIsolation
+	if isolation == "" {
+		isolation = FilterIsolation
+	}
+
+	// setup qdrant with one named vector per embedding model
+	models := config.embeddingModels()
+	vectors := make(map[string]uint64, len(models))
+	for _, m := range models {
+		vectors[m.Name] = m.Dimension
+	}
+	qdClient, err := qdrant_util.NewAliasedClient(ctx, config.QdrantHost, PageCollection, vectors)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create qdrant client: %w", err)
 	}
 
 	// set up torchserve
-	tsClient, err := torchserve.NewClient(config.TorchServeHost, config.ModelName)
+	tsClient, err := torchserve.NewProtocolClient(config.TorchServeProtocol, config.TorchServeHost, models[0].Name)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create TorchServe client: %w", err)
 	}
+	embedders := make(map[string]*torchserve.Client, len(models))
+	for _, m := range models {
+		embedders[m.Name] = tsClient.WithModel(m.Name).WithVersion(m.Version).WithBatching(config.Batch)
+	}
 
-	return &Nexus{
-		oaClient: &oaClient,
-		qdClient: qdClient,
-		tsClient: tsClient,
-		rdClient: rdClient,
-		mdClient: mdClient,
-		env:      config.Env,
-	}, nil
+	n := &Nexus{
+		qdClient:  qdClient,
+		tsClient:  embedders[models[0].Name],
+		tsAdmin:   torchserve.NewManagementClient(config.managementHost()),
+		rdClient:  rdClient,
+		mdClient:  mdClient,
+		env:       config.Env,
+		models:    models,
+		embedders: embedders,
+		normalize: config.NormalizeEmbeddings,
+		encoding:  config.EmbeddingEncoding,
+
+		serializer: serializer,
+
+		triggerCache: newTriggerCache(config.TriggerCache),
+
+		isolation: isolation,
+		tenants:   tenants,
+		locales:   config.locales(),
+
+		generators: generators,
+		limits:     config.Limits,
+		promptDir:  config.PromptDir,
+
+		candidates:     candidates,
+		keepCandidates: keepCandidates,
+		judge:          config.Judge,
+		moderator:      moderator,
+		contextual:     config.Context,
+		userVectors:    config.UserVectors,
+		drift:          newDriftMonitor(config.Drift),
+		fallbackPages:  fallbackPages,
+
+		generationWindow: config.generationWindow(),
+	}
+	n.prompts.Store(prompts)
+
+	for _, collection := range n.pageCollections() {
+		if err := qdrant_util.EnsureAlias(ctx, qdClient, collection, vectors); err != nil {
+			return nil, fmt.Errorf("failed to create qdrant collection: %w", err)
+		}
+		for _, field := range indexedFields {
+			if err := qdrant_util.EnsureKeywordIndex(ctx, qdClient, collection, field); err != nil {
+				return nil, err
+			}
+		}
+
+		// Collections created before a model was configured have no vector for it until they are reindexed, pages
+		// being stored and queried with the vectors they have meanwhile
+		stored, err := n.vectorSchema(ctx, collection)
+		if err != nil {
+			return nil, err
+		}
+		for _, m := range models {
+			if _, ok := n.vectorName(stored, m.Name); !ok {
+				log.Printf("Warning: %s has no vector for embedding model %s, run POST /admin/reindex", collection, m.Name)
+			}
+		}
+	}
+
+	if mdClient != nil {
+		for tenant := range tenants {
+			if err := mdClient.EnsureTenant(ctx, storageTenant(tenant)); err != nil {
+				return nil, fmt.Errorf("failed to create MongoDB collection for tenant %s: %w", tenant, err)
+			}
+		}
+	}
+
+	// Embedding statistics are compared for the life of the process
+	if n.drift != nil {
+		go n.monitorDrift(context.Background())
+	}
+
+	return n, nil
 }
 
-// GetNexus returns relevant pages and/or asynchronously creates new one based on the request and its calling user
-func (n *Nexus) GetNexus(ctx context.Context, request api.NexusRequest) ([]model.Page, error) {
+// GetNexus returns a tenant's relevant pages and/or asynchronously creates new one based on the request and its calling user
+func (n *Nexus) GetNexus(ctx context.Context, tenant string, request api.NexusRequest) ([]model.Page, error) {
+
+	settings, err := n.tenant(tenant)
+	if err != nil {
+		return nil, err
+	}
+	if err := validateUserId(request.UserId); err != nil {
+		return nil, err
+	}
+
+	embeddingModel, err := n.resolveModel(request.EmbeddingModel)
+	if err != nil {
+		return nil, err
+	}
+
+	locales := n.localePreference(request)
 
 	g, gctx := errgroup.WithContext(ctx)
 	var syncEmbedding []float32
 	var asyncEmbedding []float32
 	var userResults []*qdrant.ScoredPoint
 	var triggerResults []*qdrant.ScoredPoint
+	var contextResults []*qdrant.ScoredPoint
+
+	// Closed once each embedding is set
+	asyncReady := make(chan struct{})
+	syncReady := make(chan struct{})
 
 	// Fetch pages with "Async Embedding" derivation precomputed from identity combined with long term habits
 	g.Go(func() error {
 		var err error
-		userResults, asyncEmbedding, err = n.getAsyncResults(gctx, request.UserId)
-		return err
+		userResults, asyncEmbedding, err = n.getAsyncResults(gctx, tenant, request.UserId, embeddingModel, locales)
+		if err != nil {
+			return err
+		}
+		close(asyncReady)
+		return nil
 	})
 
 	// Fetch pages with "Synchronous Embedding" derived from immediate app usage
 	g.Go(func() error {
 		var err error
-		triggerResults, syncEmbedding, err = n.getSyncResults(gctx, request.Trigger)
-		return err
+		triggerResults, syncEmbedding, err = n.getSyncResults(gctx, tenant, request.Trigger, embeddingModel, locales)
+		if err != nil {
+			return err
+		}
+		close(syncReady)
+		return nil
 	})
 
+	// Fetch contextual pages with the blend of both embeddings they were stored with, as soon as both are set
+	if n.contextual.Enabled {
+		g.Go(func() error {
+			for _, ready := range []chan struct{}{asyncReady, syncReady} {
+				select {
+				case <-ready:
+				case <-gctx.Done():
+					return gctx.Err()
+				}
+			}
+			var err error
+			contextResults, err = n.getContextResults(gctx, tenant, embeddingModel, locales, syncEmbedding, asyncEmbedding)
+			return err
+		})
+	}
+
 	if err := g.Wait(); err != nil {
 		return nil, err
 	}
 
-	// Combine results
-	allResults := make([]*qdrant.ScoredPoint, len(userResults)+len(triggerResults))
-	copy(allResults, userResults)
-	copy(allResults[len(userResults):], triggerResults)
+	// Combine results by relevancy score (descending - highest score first), a page found by several queries keeping its best score
+	allResults := mergeResults(userResults, triggerResults, contextResults)
 
-	// Sort by relevancy score (descending - highest score first)
-	sort.Slice(allResults, func(i, j int) bool {
-		return allResults[i].Score > allResults[j].Score
-	})
+	// Serve the most preferred locale that has relevant pages
+	pages := preferLocale(convertResultsToRelevantPages(allResults, settings.minScore), locales)
 
-	pages := convertResultsToRelevantPages(allResults, MinScore)
+	// Generate in the most preferred locale when it has no relevant pages, otherwise by chance
+	missed := len(pages) == 0 || pages[0].Locale != locales[0]
+
+	// Serve curated template pages while nothing relevant can be generated
+	if len(pages) == 0 && n.generationUnavailable() {
+		pages = fallbackPages(n.fallbackPages, request.Trigger, locales)
+		if len(pages) > 0 {
+			metrics.FallbackPages.WithLabelValues(tenant).Inc()
+		}
+	}
 
 	// Chance to generate new pages in the background
-	if n.env != Test && (len(pages) == 0 || rand.Float32() < NewGenerateChance) {
-		go n.generateNewPages(request, syncEmbedding, asyncEmbedding)
+	if n.env != Test && (missed || rand.Float32() < settings.generateChance) {
+		go n.generateNewPages(tenant, settings, request, embeddingModel, locales[0], syncEmbedding, asyncEmbedding)
 	}
 
 	return pages, nil
 }
 
-// InjestUser takes a user snapshot, stores it, and caches its embedding (returning it for debug purposes)
-func (n *Nexus) InjestUser(ctx context.Context, request model.UserSnapshot) ([]float32, error) {
+// InjestUser takes a tenant's user snapshot, stores it, and caches its embedding for every model (returning the default one for debug purposes)
+func (n *Nexus) InjestUser(ctx context.Context, tenant string, request model.UserSnapshot) ([]float32, error) {
+
+	if _, err := n.tenant(tenant); err != nil {
+		return nil, err
+	}
+	if err := validateUserId(request.ID); err != nil {
+		return nil, err
+	}
 
 	// Mimics slower storage used to query long-term data (not used during benchmarking which only assumes cache hits)
 	if n.env == Prod {
-		err := n.mdClient.StoreUserSnapshot(ctx, request)
+		err := n.mdClient.StoreUserSnapshot(ctx, storageTenant(tenant), request)
 		if err != nil {
 			return nil, fmt.Errorf("failed to store user snapshot in MongoDB: %w", err)
 		}
 	}
 
-	// Embedding is anonymous and simply reflects user trends
-	userId := request.ID
-	request.ID = ""
-
-	// Clean user snapshot for better embedding generation
-	cleanText, err := util.CleanUserSnapshotForEmbedding(request)
+	// Clean user snapshot for better embedding generation, along with each of its facets
+	facets, texts, err := n.userTexts(request)
 	if err != nil {
 		return nil, fmt.Errorf("failed to clean user snapshot: %w", err)
 	}
 
-	userEmbeddings, err := n.tsClient.TextToEmbeddings(ctx, cleanText)
+	userEmbeddings, err := n.embedEach(ctx, nil, func(ctx context.Context, embeddingModel string) ([]float32, error) {
+		embeddings, err := n.embedTexts(ctx, embeddingModel, texts...)
+		if err != nil {
+			return nil, err
+		}
+		// Facets stored while users were represented by several vectors are deleted otherwise
+		if err := n.storeUserFacets(ctx, tenant, request.ID, embeddingModel, facets, embeddings[1:]); err != nil {
+			return nil, err
+		}
+		return embeddings[0], nil
+	})
 	if err != nil {
 		return nil, fmt.Errorf("failed to create user embedding: %w", err)
 	}
-	if len(userEmbeddings) != 1 {
-		return nil, fmt.Errorf("invalid number of embeddings returned")
-	}
-
-	userEmbedding := userEmbeddings[0]
-
-	embeddingBytes, err := json.Marshal(userEmbedding)
-	if err != nil {
-		return nil, fmt.Errorf("failed to marshal embedding: %w", err)
-	}
 
-	err = n.rdClient.Set(ctx, userId, string(embeddingBytes), 0).Err()
-	if err != nil {
-		return nil, fmt.Errorf("failed to store embedding in Redis: %w", err)
+	for embeddingModel, userEmbedding := range userEmbeddings {
+		n.drift.sample(embeddingModel, UserDriftGroup, userEmbedding)
+		err = n.storeUserEmbedding(ctx, tenant, request.ID, embeddingModel, userEmbedding)
+		if err != nil {
+			return nil, err
+		}
 	}
 
-	return userEmbedding, nil
+	return userEmbeddings[n.models[0].Name], nil
 }
 
-// DebugBootstrap generates several random user snapshots and triggers initial GetNexus calls to populate pages
-func (n *Nexus) DebugBootstrap(ctx context.Context, count int, seedOffset uint64) ([]string, error) {
+// DebugBootstrap generates several random user snapshots for a tenant and triggers initial GetNexus calls to populate pages
+func (n *Nexus) DebugBootstrap(ctx context.Context, tenant string, count int, seedOffset uint64) ([]string, error) {
 	userIds := make([]string, 0, count)
 
 	for i := range count {
 		userSnapshot := model.CreateRandomSnapshot(seedOffset + uint64(i))
 
-		_, err := n.InjestUser(ctx, userSnapshot)
+		_, err := n.InjestUser(ctx, tenant, userSnapshot)
 		if err != nil {
 			return nil, fmt.Errorf("failed to inject user %d: %w", i, err)
 		}
@@ -199,7 +430,7 @@ func (n *Nexus) DebugBootstrap(ctx context.Context, count int, seedOffset uint64
 			}
 
 			// Call GetNexus to trigger page generation and storage
-			_, err := n.GetNexus(ctx, request)
+			_, err := n.GetNexus(ctx, tenant, request)
 			if err != nil {
 				// Log error but don't fail bootstrap - some cache misses are expected
 				fmt.Printf("Warning: GetNexus call failed for user %s, trigger %d: %v\n", userSnapshot.ID, j, err)
@@ -210,13 +441,16 @@ func (n *Nexus) DebugBootstrap(ctx context.Context, count int, seedOffset uint64
 	return userIds, nil
 }
 
-// GetUserSnapshot retrieves a user snapshot from MongoDB by ID
-func (n *Nexus) GetUserSnapshot(ctx context.Context, userId string) (*model.UserSnapshot, error) {
+// GetUserSnapshot retrieves a tenant's user snapshot from MongoDB by ID
+func (n *Nexus) GetUserSnapshot(ctx context.Context, tenant string, userId string) (*model.UserSnapshot, error) {
+	if _, err := n.tenant(tenant); err != nil {
+		return nil, err
+	}
 	if n.mdClient == nil {
 		return nil, fmt.Errorf("MongoDB client not available (test environment)")
 	}
 
-	userSnapshot, err := n.mdClient.GetUserSnapshot(ctx, userId)
+	userSnapshot, err := n.mdClient.GetUserSnapshot(ctx, storageTenant(tenant), userId)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get user snapshot: %w", err)
 	}
@@ -228,46 +462,27 @@ func (n *Nexus) DebugQd() *qdrant.Client {
 	return n.qdClient
 }
 
-// DebugTrigger creates an embedding for a trigger (for debug purposes)
+// DebugTrigger creates an embedding for a trigger with the default model, as GetNexus would (for debug purposes). Debug
+// embeddings aren't sampled for drift monitoring
 func (n *Nexus) DebugTrigger(ctx context.Context, trigger model.Trigger) ([]float32, error) {
-
-	// Clean trigger for better embedding generation
-	cleanText, err := util.CleanTriggerForEmbedding(trigger)
-	if err != nil {
-		return nil, fmt.Errorf("failed to clean trigger: %w", err)
-	}
-
-	triggerEmbeddings, err := n.tsClient.TextToEmbeddings(ctx, cleanText)
-	if err != nil {
-		return nil, fmt.Errorf("failed to create trigger embedding: %w", err)
-	}
-	if len(triggerEmbeddings) != 1 {
-		return nil, fmt.Errorf("invalid number of embeddings returned")
-	}
-
-	triggerEmbedding := triggerEmbeddings[0]
-
-	return triggerEmbedding, nil
+	return n.embedTrigger(ctx, n.models[0].Name, trigger)
 }
 
-// DebugUsersnap creates an embedding for a UserSnap (for debug purposes)
+// DebugUsersnap creates an embedding for a UserSnap with the default model, as InjestUser would (for debug purposes),
+// without sampling it for drift monitoring
 func (n *Nexus) DebugUsersnap(ctx context.Context, userSnap model.UserSnapshot) ([]float32, error) {
+	embeddingModel := n.models[0].Name
 
 	// Clean user snapshot for better embedding generation
-	cleanText, err := util.CleanUserSnapshotForEmbedding(userSnap)
+	cleanText, err := n.userEmbeddingText(userSnap)
 	if err != nil {
 		return nil, fmt.Errorf("failed to clean user snapshot: %w", err)
 	}
 
-	userEmbeddings, err := n.tsClient.TextToEmbeddings(ctx, cleanText)
+	userEmbeddings, err := n.embedTexts(ctx, embeddingModel, cleanText)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create user embedding: %w", err)
 	}
-	if len(userEmbeddings) != 1 {
-		return nil, fmt.Errorf("invalid number of embeddings returned")
-	}
-
-	userEmbedding := userEmbeddings[0]
 
-	return userEmbedding, nil
+	return userEmbeddings[0], nil
 }
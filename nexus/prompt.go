@@ -1,86 +1,136 @@
 package nexus
 
-const SyncPrompt = `
-You are a recommendation engine designed to create personalized content pages based on immediate user actions and trigger events. Create pages that respond to real-time user behaviors such as purchases, redemptions, app interactions, and location-based activities.
-
-Focus on:
-- Immediate relevance to the current trigger event
-- Time-sensitive opportunities and offers
-- Context-aware recommendations based on current activity
-- Short-term engagement and conversion optimization
-- Products, services, or content directly related to the user's immediate action
-
-Generate pages that capitalize on the user's current mindset and immediate needs, providing relevant suggestions that complement their just-completed action.
-
-INPUT: You will receive a Trigger object with the following structure:
-{
-  "trigger_type": "snap|ereceipt|redeem",
-  "amount": float64,
-  "category": "string",
-  "items": [{"name": "string", "brand": "string", "category": "string", "price": float64, "quantity": int}],
-  "retailer": "string", 
-  "location": "string",
-  "gift_card_brand": "string",
-  "gift_card_type": "physical|digital",
-  "redemption_value": float64
+import (
+	"embed"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"slices"
+	"strings"
+	"text/template"
+)
+
+// DefaultPromptVersion is the prompt template version used by roles and tenants that don't select one
+const DefaultPromptVersion = "v1"
+
+var ErrUnknownPromptVersion = errors.New("unknown prompt version")
+
+// embeddedPrompts are the prompt templates built into the binary, used unless Config.PromptDir is set
+//
+//go:embed prompts
+var embeddedPrompts embed.FS
+
+// PromptData is what a prompt template is rendered with
+type PromptData struct {
+	Input    string // the trigger or user profile as JSON
+	Locale   string
+	Language string // name of the locale's language for the LLM
+
+	// User and Trigger as JSON replace Input for contextual pages
+	User    string
+	Trigger string
+}
+
+// Prompts are the prompt template versions of every generation role, including the judge. A prompt directory holds
+// one directory per role with a <version>.tmpl file per version, and shared templates in *.tmpl files at its root that
+// every version can include by file name, e.g. {{template "page_output.tmpl"}}
+type Prompts struct {
+	templates map[GenerationRole]map[string]*template.Template
 }
 
-OUTPUT: Generate a Page object with this exact structure:
-{
-  "layout": "card|banner|list|grid|carousel|modal",
-  "type": "offer|reward|recommendation|notification|promotion|survey", 
-  "category": "groceries|electronics|clothing|restaurants|beauty|home|automotive|health|books|sports",
-  "title": ["string1", "string2", ...],
-  "subTitle": ["string1", "string2", ...]
+// LoadPrompts parses the prompt templates in dir, or the embedded templates when dir is empty
+func LoadPrompts(dir string) (*Prompts, error) {
+	if dir == "" {
+		sub, err := fs.Sub(embeddedPrompts, "prompts")
+		if err != nil {
+			return nil, err
+		}
+		return loadPrompts(sub)
+	}
+	return loadPrompts(os.DirFS(dir))
 }
 
-Ensure the page directly relates to the trigger event and provides immediate value to the user's current context.
-
-Return purely the JSON object.
-`
-
-const AsyncPrompt = `
-You are a recommendation engine designed to create personalized content pages based on long-term user behavioral patterns and preferences. Create pages that reflect deep user insights gathered from extended interaction history and persistent preference data.
-
-Focus on:
-- Long-term user interests and behavioral trends
-- Seasonal patterns and recurring preferences
-- Lifestyle-based recommendations and content
-- Brand loyalty and category affinity insights
-- Personalized content that builds lasting engagement
-- Cross-category recommendations based on user's complete profile
-
-Generate pages that demonstrate understanding of the user's overall preferences, lifestyle, and long-term interests, providing recommendations that align with their established patterns and potential future needs.
-
-INPUT: You will receive a UserSnapshot object with the following structure:
-{
-  "id": "string",
-  "gender": "male|female|non-binary|prefer-not-to-say",
-  "age": int,
-  "location": "urban|suburban|rural", 
-  "rewards_balance": int,
-  "total_spend": float64,
-  "last_purchase_category": "string",
-  "favorite_categories": ["string1", "string2", ...],
-  "engagement_level": "high|medium|low",
-  "app_usage_frequency": "daily|weekly|monthly|rare",
-  "preferred_offer_type": "cashback|discount|freebie",
-  "seasonal_preference": "spring|summer|fall|winter",
-  "shopping_time_pref": "morning|afternoon|evening|night",
-  "price_sensitivity": "high|medium|low",
-  "brand_loyalty": "high|medium|low"
+func loadPrompts(fsys fs.FS) (*Prompts, error) {
+	shared, err := fs.Glob(fsys, "*.tmpl")
+	if err != nil {
+		return nil, err
+	}
+
+	prompts := &Prompts{templates: make(map[GenerationRole]map[string]*template.Template, len(llmRoles))}
+	for _, role := range llmRoles {
+		files, err := fs.Glob(fsys, path.Join(string(role), "*.tmpl"))
+		if err != nil {
+			return nil, err
+		}
+		if len(files) == 0 {
+			return nil, fmt.Errorf("no %s prompt templates found", role)
+		}
+
+		versions := make(map[string]*template.Template, len(files))
+		for _, file := range files {
+			version := strings.TrimSuffix(path.Base(file), ".tmpl")
+			t, err := template.New(path.Base(file)).ParseFS(fsys, append([]string{file}, shared...)...)
+			if err != nil {
+				return nil, fmt.Errorf("failed to parse %s prompt %s: %w", role, version, err)
+			}
+			versions[version] = t
+		}
+		prompts.templates[role] = versions
+	}
+	return prompts, nil
 }
 
-OUTPUT: Generate a Page object with this exact structure:
-{
-  "layout": "card|banner|list|grid|carousel|modal",
-  "type": "offer|reward|recommendation|notification|promotion|survey",
-  "category": "groceries|electronics|clothing|restaurants|beauty|home|automotive|health|books|sports", 
-  "title": ["string1", "string2", ...],
-  "subTitle": ["string1", "string2", ...]
+// Versions lists the prompt template versions of every generation role
+func (p *Prompts) Versions() map[GenerationRole][]string {
+	versions := make(map[GenerationRole][]string, len(p.templates))
+	for role, templates := range p.templates {
+		for version := range templates {
+			versions[role] = append(versions[role], version)
+		}
+		slices.Sort(versions[role])
+	}
+	return versions
 }
 
-Create pages that reflect the user's long-term preferences, shopping patterns, and lifestyle characteristics for sustained engagement.
+// Render renders a version of a generation role's prompt with its data, PromptData for page generation and JudgeData
+// for the judge
+func (p *Prompts) Render(role GenerationRole, version string, data any) (string, error) {
+	t, ok := p.templates[role][version]
+	if !ok {
+		return "", fmt.Errorf("%w: %s %s", ErrUnknownPromptVersion, role, version)
+	}
+
+	var prompt strings.Builder
+	if err := t.Execute(&prompt, data); err != nil {
+		return "", fmt.Errorf("failed to render %s prompt %s: %w", role, version, err)
+	}
+	return prompt.String(), nil
+}
 
-Return purely the JSON object.
-`
+// check verifies that every prompt version a tenant selects exists
+func (p *Prompts) check(tenants map[string]tenantSettings) error {
+	for tenant, settings := range tenants {
+		for role, version := range settings.promptVersions {
+			if _, ok := p.templates[role][version]; !ok {
+				return fmt.Errorf("%w: tenant %s selects %s prompt %s", ErrUnknownPromptVersion, tenant, role, version)
+			}
+		}
+	}
+	return nil
+}
+
+// ReloadPrompts parses the prompt templates again so edits apply without a restart, keeping the current templates
+// when the new ones fail to parse or lack a version a tenant selects
+func (n *Nexus) ReloadPrompts() (map[GenerationRole][]string, error) {
+	prompts, err := LoadPrompts(n.promptDir)
+	if err != nil {
+		return nil, err
+	}
+	if err := prompts.check(n.tenants); err != nil {
+		return nil, err
+	}
+	n.prompts.Store(prompts)
+	return prompts.Versions(), nil
+}
@@ -0,0 +1,84 @@
+package nexus
+
+import (
+	"errors"
+	"slices"
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+func TestLoadPrompts_Embedded(t *testing.T) {
+	prompts, err := LoadPrompts("")
+	if err != nil {
+		t.Fatalf("LoadPrompts() error = %v", err)
+	}
+
+	for _, role := range llmRoles {
+		if !slices.Contains(prompts.Versions()[role], DefaultPromptVersion) {
+			t.Fatalf("Expected a %s prompt %s, got %v", role, DefaultPromptVersion, prompts.Versions()[role])
+		}
+	}
+
+	for _, role := range []GenerationRole{UserRole, TriggerRole} {
+		prompt, err := prompts.Render(role, DefaultPromptVersion, promptData(`{"id":"input"}`, "es"))
+		if err != nil {
+			t.Fatalf("Render(%s) error = %v", role, err)
+		}
+		for _, expected := range []string{`"layout": "card|banner|list|grid|carousel|modal"`, "Write every title and subTitle in Spanish.", `{"id":"input"}`} {
+			if !strings.Contains(prompt, expected) {
+				t.Errorf("Expected %s prompt to contain %q, got:\n%s", role, expected, prompt)
+			}
+		}
+	}
+
+	data := promptData("", "en")
+	data.User, data.Trigger = `{"id":"user"}`, `{"trigger_type":"snap"}`
+	prompt, err := prompts.Render(ContextRole, DefaultPromptVersion, data)
+	if err != nil {
+		t.Fatalf("Render(%s) error = %v", ContextRole, err)
+	}
+	for _, expected := range []string{`User Profile: {"id":"user"}`, `Trigger Context: {"trigger_type":"snap"}`} {
+		if !strings.Contains(prompt, expected) {
+			t.Errorf("Expected %s prompt to contain %q, got:\n%s", ContextRole, expected, prompt)
+		}
+	}
+}
+
+func TestLoadPrompts_Versions(t *testing.T) {
+	fsys := fstest.MapFS{
+		"shared.tmpl":     {Data: []byte(`{{define "output"}}Return JSON.{{end}}`)},
+		"user/v1.tmpl":    {Data: []byte(`User {{.Input}}. {{template "output"}}`)},
+		"user/v2.tmpl":    {Data: []byte(`User v2 {{.Input}} in {{.Language}}. {{template "output"}}`)},
+		"trigger/v1.tmpl": {Data: []byte(`Trigger {{.Input}}`)},
+		"context/v1.tmpl": {Data: []byte(`Context {{.User}} {{.Trigger}}`)},
+		"judge/v1.tmpl":   {Data: []byte(`Judge {{.Page}}`)},
+	}
+	prompts, err := loadPrompts(fsys)
+	if err != nil {
+		t.Fatalf("loadPrompts() error = %v", err)
+	}
+
+	if versions := prompts.Versions()[UserRole]; !slices.Equal(versions, []string{"v1", "v2"}) {
+		t.Errorf("Expected user versions [v1 v2], got %v", versions)
+	}
+
+	prompt, err := prompts.Render(UserRole, "v2", promptData("{}", "fr-ca"))
+	if err != nil {
+		t.Fatalf("Render() error = %v", err)
+	}
+	if prompt != "User v2 {} in French. Return JSON." {
+		t.Errorf("Unexpected prompt %q", prompt)
+	}
+
+	if _, err := prompts.Render(TriggerRole, "v2", promptData("{}", "en")); !errors.Is(err, ErrUnknownPromptVersion) {
+		t.Errorf("Expected ErrUnknownPromptVersion, got %v", err)
+	}
+
+	tenants, _ := newTenants(map[string]TenantConfig{
+		"acme": {PromptVersions: map[GenerationRole]string{TriggerRole: "v2"}},
+	}, nil)
+	if err := prompts.check(tenants); !errors.Is(err, ErrUnknownPromptVersion) {
+		t.Errorf("Expected ErrUnknownPromptVersion for a missing tenant version, got %v", err)
+	}
+}
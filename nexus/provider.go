@@ -0,0 +1,180 @@
+package nexus
+
+import (
+	"fmt"
+	"maps"
+	"sync/atomic"
+	"time"
+
+	"github.com/openai/openai-go/v2"
+	"github.com/openai/openai-go/v2/option"
+)
+
+// GenerationRole is the kind of LLM call made while generating pages, each role having its own LLM provider and
+// prompt templates
+type GenerationRole string
+
+const (
+	UserRole    GenerationRole = "user"
+	TriggerRole GenerationRole = "trigger"
+	// ContextRole generates pages for a user and a trigger together
+	ContextRole GenerationRole = "context"
+	// JudgeRole scores generated pages before they are stored
+	JudgeRole GenerationRole = "judge"
+	// ModerationRole checks generated pages with the moderation API, which takes no prompt
+	ModerationRole GenerationRole = "moderation"
+)
+
+// generationRoles generate pages, llmRoles are every role with prompts and usageRoles every role whose usage is recorded
+var (
+	generationRoles = []GenerationRole{UserRole, TriggerRole, ContextRole}
+	llmRoles        = []GenerationRole{UserRole, TriggerRole, ContextRole, JudgeRole}
+	usageRoles      = []GenerationRole{UserRole, TriggerRole, ContextRole, JudgeRole, ModerationRole}
+)
+
+// ProviderConfig configures an OpenAI-compatible chat completions server, e.g. OpenAI itself or a self-hosted vLLM,
+// llama.cpp or Ollama server. Unset fields inherit the shared Config.LLM and then the defaults
+type ProviderConfig struct {
+	BaseURL      string // defaults to the OpenAI API
+	APIKey       string // defaults to Config.OpenAIKey
+	Model        string // defaults to gpt-4o
+	Organization string
+	Timeout      time.Duration // per request, unlimited by default
+	Headers      map[string]string
+	OutputMode   OutputMode // defaults to Config.OutputMode
+
+	// Prices in USD per million tokens used to estimate cost, defaulting to GPT-4o's on the OpenAI API
+	InputCostPerMillion  float64
+	OutputCostPerMillion float64
+}
+
+// GPT-4o prices in USD per million tokens
+const (
+	GPT4oInputCostPerMillion  = 2.50
+	GPT4oOutputCostPerMillion = 10.00
+)
+
+// generator is the LLM client of a generation role
+type generator struct {
+	client *openai.Client
+	model  string
+
+	// Prices in USD per token
+	inputCost  float64
+	outputCost float64
+
+	// Index in outputModes of the configured output mode and of the one the provider currently accepts, falling back
+	// to less constrained modes when it rejects one until OutputModeRetry later
+	configuredMode int32
+	outputMode     atomic.Int32
+	downgradedAt   atomic.Int64 // Unix nanoseconds
+
+	// How failed requests are retried and the breaker that stops them while the provider keeps failing
+	retry   RetryConfig
+	breaker *breaker
+}
+
+// merge returns c with every field set in override replaced, headers being combined
+func (c ProviderConfig) merge(override ProviderConfig) ProviderConfig {
+	if override.BaseURL != "" {
+		c.BaseURL = override.BaseURL
+	}
+	if override.APIKey != "" {
+		c.APIKey = override.APIKey
+	}
+	if override.Model != "" {
+		c.Model = override.Model
+	}
+	if override.Organization != "" {
+		c.Organization = override.Organization
+	}
+	if override.Timeout != 0 {
+		c.Timeout = override.Timeout
+	}
+	if override.OutputMode != "" {
+		c.OutputMode = override.OutputMode
+	}
+	if override.InputCostPerMillion != 0 {
+		c.InputCostPerMillion = override.InputCostPerMillion
+	}
+	if override.OutputCostPerMillion != 0 {
+		c.OutputCostPerMillion = override.OutputCostPerMillion
+	}
+	if len(override.Headers) > 0 {
+		headers := maps.Clone(c.Headers)
+		if headers == nil {
+			headers = make(map[string]string, len(override.Headers))
+		}
+		maps.Copy(headers, override.Headers)
+		c.Headers = headers
+	}
+	return c
+}
+
+// provider returns the effective provider configuration of a generation role
+func (c *Config) provider(role GenerationRole) ProviderConfig {
+	defaults := ProviderConfig{
+		APIKey:     c.OpenAIKey,
+		Model:      openai.ChatModelGPT4o,
+		OutputMode: c.OutputMode,
+	}
+	provider := defaults.merge(c.LLM).merge(c.Providers[role])
+
+	// Only GPT-4o on the OpenAI API has known prices, other servers and models cost what they are configured to
+	if provider.BaseURL == "" && provider.Model == openai.ChatModelGPT4o &&
+		provider.InputCostPerMillion == 0 && provider.OutputCostPerMillion == 0 {
+		provider.InputCostPerMillion = GPT4oInputCostPerMillion
+		provider.OutputCostPerMillion = GPT4oOutputCostPerMillion
+	}
+	return provider
+}
+
+func newGenerator(config ProviderConfig) (*generator, error) {
+	outputMode, err := outputModeIndex(config.OutputMode)
+	if err != nil {
+		return nil, err
+	}
+
+	opts := []option.RequestOption{
+		option.WithAPIKey(config.APIKey),
+	}
+	if config.BaseURL != "" {
+		opts = append(opts, option.WithBaseURL(config.BaseURL))
+	}
+	if config.Organization != "" {
+		opts = append(opts, option.WithOrganization(config.Organization))
+	}
+	if config.Timeout > 0 {
+		opts = append(opts, option.WithRequestTimeout(config.Timeout))
+	}
+	for key, value := range config.Headers {
+		opts = append(opts, option.WithHeader(key, value))
+	}
+
+	client := openai.NewClient(opts...)
+	g := &generator{
+		client:     &client,
+		model:      config.Model,
+		inputCost:  config.InputCostPerMillion / 1e6,
+		outputCost: config.OutputCostPerMillion / 1e6,
+
+		configuredMode: outputMode,
+	}
+	g.outputMode.Store(outputMode)
+	return g, nil
+}
+
+// newGenerators creates the LLM client of every role
+func newGenerators(config *Config) (map[GenerationRole]*generator, error) {
+	generators := make(map[GenerationRole]*generator, len(llmRoles))
+	for _, role := range llmRoles {
+		g, err := newGenerator(config.provider(role))
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s generation provider: %w", role, err)
+		}
+		g.retry = config.Retry.withDefaults()
+		g.breaker = newBreaker(role, config.Breaker)
+		generators[role] = g
+	}
+	return generators, nil
+}
@@ -0,0 +1,463 @@
+package nexus
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/dbrun3/nexus-vector/dao"
+	"github.com/dbrun3/nexus-vector/model"
+	"github.com/dbrun3/nexus-vector/qdrant_util"
+	"github.com/qdrant/go-client/qdrant"
+)
+
+const ReindexBatchSize = 64
+
+// ReindexResult summarises a completed reindex
+type ReindexResult struct {
+	Models         []string            `json:"models"`
+	Collections    []CollectionReindex `json:"collections"`
+	PagesReindexed int                 `json:"pages_reindexed"`
+	PagesCarried   int                 `json:"pages_carried"` // pages stored without source text keep their stored vectors
+	PagesSkipped   int                 `json:"pages_skipped"` // pages without source text nor a vector of an unchanged model
+	UsersReindexed int                 `json:"users_reindexed"`
+	Partial        bool                `json:"partial,omitempty"` // some aliases still serve their previous collection
+}
+
+// CollectionReindex records which collection an alias was moved to by a reindex
+type CollectionReindex struct {
+	Alias              string `json:"alias"`
+	Collection         string `json:"collection"`
+	PreviousCollection string `json:"previous_collection"`
+	Swapped            bool   `json:"swapped"`
+}
+
+var ErrReindexRunning = errors.New("a reindex is already running")
+
+// Reindex job states
+const (
+	ReindexRunning   = "running"
+	ReindexSucceeded = "succeeded"
+	ReindexFailed    = "failed"
+)
+
+// ReindexJob reports a reindex running in the background
+type ReindexJob struct {
+	State      string         `json:"state"`
+	StartedAt  time.Time      `json:"started_at"`
+	FinishedAt *time.Time     `json:"finished_at,omitempty"`
+	Result     *ReindexResult `json:"result,omitempty"` // once finished, partial when failed
+	Error      string         `json:"error,omitempty"`
+}
+
+// StartReindex runs Reindex in the background, detached from the caller's context so a client disconnecting or a proxy
+// timing out doesn't cancel it halfway, and returns the started job. Only one reindex runs at a time
+func (n *Nexus) StartReindex() (ReindexJob, error) {
+	n.reindexMu.Lock()
+	defer n.reindexMu.Unlock()
+
+	if n.reindexJob != nil && n.reindexJob.State == ReindexRunning {
+		return *n.reindexJob, ErrReindexRunning
+	}
+	n.reindexJob = &ReindexJob{State: ReindexRunning, StartedAt: time.Now()}
+
+	go func() {
+		result, err := n.Reindex(context.Background())
+
+		n.reindexMu.Lock()
+		defer n.reindexMu.Unlock()
+		finished := time.Now()
+		n.reindexJob.FinishedAt = &finished
+		n.reindexJob.Result = result
+		n.reindexJob.State = ReindexSucceeded
+		if err != nil {
+			log.Printf("Reindex failed: %v", err)
+			n.reindexJob.State = ReindexFailed
+			n.reindexJob.Error = err.Error()
+		}
+	}()
+
+	return *n.reindexJob, nil
+}
+
+// ReindexStatus returns the last reindex started with StartReindex, false when none was
+func (n *Nexus) ReindexStatus() (ReindexJob, bool) {
+	n.reindexMu.Lock()
+	defer n.reindexMu.Unlock()
+
+	if n.reindexJob == nil {
+		return ReindexJob{}, false
+	}
+	return *n.reindexJob, true
+}
+
+// Reindex re-embeds every page with each configured embedding model into new collections, points each page collection
+// alias at its new collection and then re-derives the cached user embeddings of every tenant served by them from MongoDB.
+// Every collection is filled before any alias is swapped, so a failed copy leaves every alias on its previous collection,
+// and pages stored in the meantime are copied again before and after the swaps. Previous collections are kept for
+// rollback, and new collections are deleted unless their alias was swapped.
+func (n *Nexus) Reindex(ctx context.Context) (*ReindexResult, error) {
+	result := &ReindexResult{}
+
+	vectors := make(map[string]uint64, len(n.models))
+	for _, m := range n.models {
+		vectors[m.Name] = m.Dimension
+		result.Models = append(result.Models, m.Name)
+	}
+
+	var reindexes []*collectionCopy
+	defer func() {
+		for _, reindex := range reindexes {
+			if !reindex.Swapped {
+				n.dropCollection(reindex.Collection)
+			}
+		}
+	}()
+
+	for _, alias := range n.pageCollections() {
+		reindex := &collectionCopy{CollectionReindex: CollectionReindex{
+			Alias:      alias,
+			Collection: qdrant_util.VersionedName(alias),
+		}}
+		reindexes = append(reindexes, reindex)
+		if err := n.fillCollection(ctx, reindex, vectors, result); err != nil {
+			return result, err
+		}
+	}
+
+	// Aliases are swapped one by one, those swapped before a failure serving their new collection
+	var errs []error
+	swapped := make(map[string]bool, len(reindexes))
+	for _, reindex := range reindexes {
+		previous, err := qdrant_util.SwapAlias(ctx, n.qdClient, reindex.Alias, reindex.Collection)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("failed to swap %s, %d of %d aliases swapped: %w", reindex.Alias, len(swapped), len(reindexes), err))
+			break
+		}
+		reindex.PreviousCollection = previous
+		reindex.Swapped = true
+		swapped[reindex.Alias] = true
+		n.setVectorSchema(reindex.Alias, vectors)
+		log.Printf("Reindex: %s now serves %s", reindex.Alias, reindex.Collection)
+
+		// Pages stored in the previous collection until the swap
+		if previous != "" {
+			if err := n.copyPages(ctx, previous, reindex.Collection, reindex.caughtUp, result); err != nil {
+				errs = append(errs, fmt.Errorf("failed to copy pages stored in %s during the swap: %w", previous, err))
+			}
+		}
+	}
+	for _, reindex := range reindexes {
+		result.Collections = append(result.Collections, reindex.CollectionReindex)
+	}
+	result.Partial = len(swapped) > 0 && len(swapped) < len(reindexes)
+	if len(swapped) == 0 {
+		return result, errors.Join(errs...)
+	}
+
+	// Trigger embeddings cached before the reindex may come from another model version than the pages now served
+	if err := n.invalidateTriggerCache(ctx); err != nil {
+		errs = append(errs, err)
+	}
+
+	// User embeddings can only be re-derived where their snapshots are stored
+	if n.mdClient == nil {
+		log.Printf("Reindex: MongoDB not available, cached user embeddings were not re-derived")
+		return result, errors.Join(errs...)
+	}
+
+	// Users are only re-embedded for the pages their tenant is now served
+	for tenant := range n.tenants {
+		if !swapped[n.pageCollection(tenant)] {
+			continue
+		}
+		count, err := n.reindexUsers(ctx, tenant)
+		result.UsersReindexed += count
+		if err != nil {
+			errs = append(errs, fmt.Errorf("pages reindexed but user embeddings of tenant %s failed: %w", tenant, err))
+			break
+		}
+	}
+	log.Printf("Reindex: re-derived %d user embeddings", result.UsersReindexed)
+
+	return result, errors.Join(errs...)
+}
+
+// collectionCopy is a collection being filled by a reindex
+type collectionCopy struct {
+	CollectionReindex
+	caughtUp int64 // when the last copy of the pages stored since the first one started, in Unix seconds
+}
+
+// fillCollection creates the new collection of a reindex and copies the pages behind its alias into it, then copies the
+// pages stored meanwhile again
+func (n *Nexus) fillCollection(ctx context.Context, reindex *collectionCopy, vectors map[string]uint64, result *ReindexResult) error {
+	err := qdrant_util.CreateNamedCollection(ctx, n.qdClient, reindex.Collection, vectors)
+	if err != nil {
+		return err
+	}
+	for _, field := range indexedFields {
+		if err := qdrant_util.EnsureKeywordIndex(ctx, n.qdClient, reindex.Collection, field); err != nil {
+			return err
+		}
+	}
+	if err := n.setCollectionModels(ctx, reindex.Collection); err != nil {
+		return err
+	}
+	log.Printf("Reindex: copying %s into %s with models %v", reindex.Alias, reindex.Collection, result.Models)
+
+	started := time.Now().Unix()
+	if err := n.copyPages(ctx, reindex.Alias, reindex.Collection, 0, result); err != nil {
+		return err
+	}
+	reindex.caughtUp = time.Now().Unix()
+	return n.copyPages(ctx, reindex.Alias, reindex.Collection, started, result)
+}
+
+// dropCollection deletes a collection that was never served along with its record of models
+func (n *Nexus) dropCollection(collection string) {
+	if err := n.qdClient.DeleteCollection(context.Background(), collection); err != nil {
+		log.Printf("Reindex: failed to delete partial collection %s: %v", collection, err)
+	}
+	if err := n.rdClient.Del(context.Background(), collectionModelsKey(collection)).Err(); err != nil {
+		log.Printf("Reindex: failed to delete the models of %s: %v", collection, err)
+	}
+}
+
+// copyPages copies the pages of collection from stored since a Unix time (every page when 0) into collection to,
+// re-embedding their source text. Pages stored without source text, such as every page stored before sources were
+// recorded, keep their stored vectors of the models whose pinned version is unchanged and are skipped otherwise
+func (n *Nexus) copyPages(ctx context.Context, from, to string, since int64, result *ReindexResult) error {
+	current, err := qdrant_util.ResolveAlias(ctx, n.qdClient, from)
+	if err != nil {
+		return err
+	}
+	if current == "" {
+		current = from
+	}
+	versions, err := n.collectionModels(ctx, current)
+	if err != nil {
+		return err
+	}
+
+	var filter *qdrant.Filter
+	if since > 0 {
+		filter = &qdrant.Filter{
+			Must: []*qdrant.Condition{qdrant.NewRange("created_at", &qdrant.Range{Gte: qdrant.PtrOf(float64(since))})},
+		}
+	}
+
+	// Copy pages batch by batch, re-embedding their source text
+	var offset *qdrant.PointId
+	for {
+		points, next, err := n.qdClient.ScrollAndOffset(ctx, &qdrant.ScrollPoints{
+			CollectionName: from,
+			Filter:         filter,
+			Offset:         offset,
+			Limit:          qdrant.PtrOf(uint32(ReindexBatchSize)),
+			WithPayload:    qdrant.NewWithPayload(true),
+			WithVectors:    qdrant.NewWithVectors(true),
+		})
+		if err != nil {
+			return fmt.Errorf("failed to scroll pages: %w", err)
+		}
+
+		// Contextual pages also embed their user text, blended with the source text by the page's trigger weight
+		texts := make([]string, 0, len(points))
+		kept := make([]*qdrant.RetrievedPoint, 0, len(points))
+		sources := make([]dao.PageSource, 0, len(points))
+		userTexts := make(map[int]int)
+		var carried []*qdrant.PointStruct
+		for _, point := range points {
+			source := dao.SourceFromPayload(point.Payload)
+			if source.Text == "" {
+				vectors := n.storedVectors(point.GetVectors(), versions)
+				if len(vectors) == 0 {
+					result.PagesSkipped++
+					continue
+				}
+				carried = append(carried, &qdrant.PointStruct{
+					Id:      point.Id,
+					Vectors: qdrant.NewVectorsMap(vectors),
+					Payload: point.Payload,
+				})
+				continue
+			}
+			texts = append(texts, source.Text)
+			kept = append(kept, point)
+			sources = append(sources, source)
+		}
+		for i, source := range sources {
+			if source.Kind == dao.ContextSource {
+				userTexts[i] = len(texts)
+				texts = append(texts, source.UserText)
+			}
+		}
+
+		if len(carried) > 0 {
+			_, err = n.qdClient.Upsert(ctx, &qdrant.UpsertPoints{
+				CollectionName: to,
+				Points:         carried,
+			})
+			if err != nil {
+				return fmt.Errorf("failed to store pages in %s: %w", to, err)
+			}
+			result.PagesCarried += len(carried)
+		}
+
+		if len(kept) > 0 {
+			pointVectors := make([]map[string]*qdrant.Vector, len(kept))
+			for i := range pointVectors {
+				pointVectors[i] = make(map[string]*qdrant.Vector, len(n.models))
+			}
+
+			for _, m := range n.models {
+				embeddings, err := n.embedTexts(ctx, m.Name, texts...)
+				if err != nil {
+					return fmt.Errorf("failed to create page embeddings with model %s: %w", m.Name, err)
+				}
+				for i := range kept {
+					embedding := embeddings[i]
+					if j, ok := userTexts[i]; ok {
+						embedding = blendEmbeddings(embedding, embeddings[j], sources[i].TriggerWeight)
+					}
+					pointVectors[i][m.Name] = qdrant.NewVector(embedding...)
+				}
+			}
+
+			upserts := make([]*qdrant.PointStruct, len(kept))
+			for i, point := range kept {
+				upserts[i] = &qdrant.PointStruct{
+					Id:      point.Id,
+					Vectors: qdrant.NewVectorsMap(pointVectors[i]),
+					Payload: point.Payload,
+				}
+			}
+
+			_, err = n.qdClient.Upsert(ctx, &qdrant.UpsertPoints{
+				CollectionName: to,
+				Points:         upserts,
+			})
+			if err != nil {
+				return fmt.Errorf("failed to store pages in %s: %w", to, err)
+			}
+			result.PagesReindexed += len(kept)
+		}
+
+		if next == nil {
+			return nil
+		}
+		offset = next
+	}
+}
+
+// collectionModelsKey records the pinned version of each model a reindexed collection was embedded with
+func collectionModelsKey(collection string) string {
+	return "collection_models:" + collection
+}
+
+// setCollectionModels records the pinned versions of the configured models a collection is embedded with
+func (n *Nexus) setCollectionModels(ctx context.Context, collection string) error {
+	versions := make(map[string]any, len(n.models))
+	for _, m := range n.models {
+		versions[m.Name] = m.Version.Version
+	}
+	if err := n.rdClient.HSet(ctx, collectionModelsKey(collection), versions).Err(); err != nil {
+		return fmt.Errorf("failed to record the models of %s: %w", collection, err)
+	}
+	return nil
+}
+
+// collectionModels returns the pinned version of each model a collection was embedded with, empty for collections
+// filled before versions were recorded
+func (n *Nexus) collectionModels(ctx context.Context, collection string) (map[string]string, error) {
+	versions, err := n.rdClient.HGetAll(ctx, collectionModelsKey(collection)).Result()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read the models of %s: %w", collection, err)
+	}
+	return versions, nil
+}
+
+// storedVectors returns the vectors a page was stored with that can be carried into a new collection, by model name:
+// those fitting a configured model still pinned to the version recorded for them (versions). Vectors of TorchServe's
+// default version may have come from any version, and vectors of a legacy unnamed-vector collection belong to the default
+// model
+func (n *Nexus) storedVectors(output *qdrant.VectorsOutput, versions map[string]string) map[string]*qdrant.Vector {
+	stored := make(map[string][]float32)
+	if named := output.GetVectors(); named != nil {
+		for name, vector := range named.GetVectors() {
+			stored[name] = qdrant_util.DenseData(vector)
+		}
+	} else if vector := output.GetVector(); vector != nil {
+		stored[n.models[0].Name] = qdrant_util.DenseData(vector)
+	}
+
+	vectors := make(map[string]*qdrant.Vector, len(n.models))
+	for _, m := range n.models {
+		if m.Version.Version == "" || versions[m.Name] != m.Version.Version {
+			continue
+		}
+		if data, ok := stored[m.Name]; ok && uint64(len(data)) == m.Dimension {
+			vectors[m.Name] = qdrant.NewVector(data...)
+		}
+	}
+	return vectors
+}
+
+// reindexUsers recomputes every stored user's cached embeddings of a tenant with each configured model, along with their
+// facet embeddings when users are represented by several vectors, deleting facets stored before otherwise
+func (n *Nexus) reindexUsers(ctx context.Context, tenant string) (int, error) {
+	count := 0
+	ids := make([]string, 0, ReindexBatchSize)
+	facets := make([][]string, 0, ReindexBatchSize)
+	texts := make([]string, 0, ReindexBatchSize)
+
+	flush := func() error {
+		if len(ids) == 0 {
+			return nil
+		}
+		for _, m := range n.models {
+			embeddings, err := n.embedTexts(ctx, m.Name, texts...)
+			if err != nil {
+				return fmt.Errorf("failed to create user embeddings with model %s: %w", m.Name, err)
+			}
+
+			// Each user's profile embedding is followed by one per facet
+			offset := 0
+			for i, id := range ids {
+				if err := n.storeUserEmbedding(ctx, tenant, id, m.Name, embeddings[offset]); err != nil {
+					return err
+				}
+				err := n.storeUserFacets(ctx, tenant, id, m.Name, facets[i], embeddings[offset+1:offset+1+len(facets[i])])
+				if err != nil {
+					return err
+				}
+				offset += 1 + len(facets[i])
+			}
+		}
+		count += len(ids)
+		ids, facets, texts = ids[:0], facets[:0], texts[:0]
+		return nil
+	}
+
+	err := n.mdClient.ForEachUserSnapshot(ctx, storageTenant(tenant), func(snapshot model.UserSnapshot) error {
+		snapshotFacets, snapshotTexts, err := n.userTexts(snapshot)
+		if err != nil {
+			return fmt.Errorf("failed to clean user snapshot: %w", err)
+		}
+		ids = append(ids, snapshot.ID)
+		facets = append(facets, snapshotFacets)
+		texts = append(texts, snapshotTexts...)
+		if len(ids) == ReindexBatchSize {
+			return flush()
+		}
+		return nil
+	})
+	if err != nil {
+		return count, err
+	}
+
+	return count, flush()
+}
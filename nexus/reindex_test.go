@@ -0,0 +1,85 @@
+package nexus
+
+import (
+	"testing"
+
+	"github.com/dbrun3/nexus-vector/torchserve"
+	"github.com/qdrant/go-client/qdrant"
+)
+
+func TestStoredVectors(t *testing.T) {
+	n := &Nexus{models: []EmbeddingModel{
+		{Name: "minilm", Dimension: 2, Version: torchserve.ModelVersion{Version: "2.0"}},
+		{Name: "mpnet", Dimension: 3, Version: torchserve.ModelVersion{Version: "1.0"}},
+	}}
+	unchanged := map[string]string{"minilm": "2.0", "mpnet": "1.0"}
+	legacy := &qdrant.VectorsOutput{VectorsOptions: &qdrant.VectorsOutput_Vector{Vector: &qdrant.VectorOutput{Data: []float32{1, 2}}}}
+
+	tests := []struct {
+		name     string
+		output   *qdrant.VectorsOutput
+		versions map[string]string
+		expected map[string]int // model name -> vector length
+	}{
+		{
+			name:     "legacy unnamed vector belongs to the default model",
+			output:   legacy,
+			versions: unchanged,
+			expected: map[string]int{"minilm": 2},
+		},
+		{
+			name:     "model version changed",
+			output:   legacy,
+			versions: map[string]string{"minilm": "1.0", "mpnet": "1.0"},
+			expected: map[string]int{},
+		},
+		{
+			name:     "versions never recorded",
+			output:   legacy,
+			expected: map[string]int{},
+		},
+		{
+			name: "named vectors of configured models with their dimension",
+			output: &qdrant.VectorsOutput{VectorsOptions: &qdrant.VectorsOutput_Vectors{Vectors: &qdrant.NamedVectorsOutput{
+				Vectors: map[string]*qdrant.VectorOutput{
+					"minilm":  {Data: []float32{1, 2}},
+					"mpnet":   {Data: []float32{1, 2}}, // stored before its dimension changed
+					"removed": {Data: []float32{1, 2, 3}},
+				},
+			}}},
+			versions: unchanged,
+			expected: map[string]int{"minilm": 2},
+		},
+		{
+			name:     "legacy vector of another dimension",
+			output:   &qdrant.VectorsOutput{VectorsOptions: &qdrant.VectorsOutput_Vector{Vector: &qdrant.VectorOutput{Data: []float32{1, 2, 3}}}},
+			versions: unchanged,
+			expected: map[string]int{},
+		},
+		{name: "no vectors", versions: unchanged, expected: map[string]int{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			vectors := n.storedVectors(tt.output, tt.versions)
+			if len(vectors) != len(tt.expected) {
+				t.Fatalf("storedVectors() = %v, expected %v", vectors, tt.expected)
+			}
+			for name, length := range tt.expected {
+				if got := len(vectors[name].GetData()); got != length {
+					t.Errorf("storedVectors()[%s] has %d values, expected %d", name, got, length)
+				}
+			}
+		})
+	}
+}
+
+func TestStoredVectorsUnpinned(t *testing.T) {
+	n := &Nexus{models: []EmbeddingModel{{Name: "minilm", Dimension: 2}}}
+	output := &qdrant.VectorsOutput{VectorsOptions: &qdrant.VectorsOutput_Vector{Vector: &qdrant.VectorOutput{Data: []float32{1, 2}}}}
+
+	// TorchServe's default version may have changed since, so its vectors are never carried
+	if vectors := n.storedVectors(output, map[string]string{"minilm": ""}); len(vectors) != 0 {
+		t.Errorf("Expected no vectors of an unpinned model, got %v", vectors)
+	}
+}
@@ -0,0 +1,309 @@
+package nexus
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"math/rand/v2"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/dbrun3/nexus-vector/metrics"
+	"github.com/openai/openai-go/v2"
+	"github.com/openai/openai-go/v2/option"
+)
+
+// Retry and circuit breaker defaults
+const (
+	DefaultMaxRetries       = 3
+	DefaultRetryBaseDelay   = 500 * time.Millisecond
+	DefaultRetryMaxDelay    = 30 * time.Second
+	DefaultBreakerThreshold = 5
+	DefaultBreakerCooldown  = 30 * time.Second
+)
+
+// ErrCircuitOpen is returned instead of calling a provider whose circuit breaker is open
+var ErrCircuitOpen = errors.New("LLM circuit breaker is open")
+
+// RetryConfig configures how chat completion requests are retried after rate limiting, server errors and network
+// errors, waiting a jittered exponential backoff or the server's Retry-After
+type RetryConfig struct {
+	MaxRetries int           // defaults to DefaultMaxRetries, negative disabling retries
+	BaseDelay  time.Duration // defaults to DefaultRetryBaseDelay
+	MaxDelay   time.Duration // longest wait, longer Retry-After values failing the request. Defaults to DefaultRetryMaxDelay
+}
+
+// BreakerConfig configures the circuit breaker of each generation role's provider, which stops calling the provider
+// after Threshold consecutive failed requests for Cooldown before letting a single request probe it again
+type BreakerConfig struct {
+	Threshold int           // defaults to DefaultBreakerThreshold, negative disabling the breaker
+	Cooldown  time.Duration // defaults to DefaultBreakerCooldown
+}
+
+// withDefaults returns the retry configuration with unset fields defaulted
+func (c RetryConfig) withDefaults() RetryConfig {
+	switch {
+	case c.MaxRetries == 0:
+		c.MaxRetries = DefaultMaxRetries
+	case c.MaxRetries < 0:
+		c.MaxRetries = 0
+	}
+	if c.BaseDelay <= 0 {
+		c.BaseDelay = DefaultRetryBaseDelay
+	}
+	if c.MaxDelay <= 0 {
+		c.MaxDelay = DefaultRetryMaxDelay
+	}
+	return c
+}
+
+// backoff is the jittered exponential delay before a retry, between half and all of BaseDelay doubled per attempt
+func (c RetryConfig) backoff(attempt int) time.Duration {
+	delay := c.MaxDelay
+	if attempt < 32 {
+		delay = min(c.BaseDelay<<attempt, c.MaxDelay)
+	}
+	return delay/2 + rand.N(delay/2+1)
+}
+
+// Circuit breaker states, also the values of metrics.LLMCircuitState
+const (
+	breakerClosed = iota
+	breakerOpen
+	breakerHalfOpen
+)
+
+// breaker is the circuit breaker of one generation role's provider
+type breaker struct {
+	role      GenerationRole
+	threshold int
+	cooldown  time.Duration
+	now       func() time.Time
+
+	mu       sync.Mutex
+	state    int
+	failures int
+	openedAt time.Time
+	probing  bool
+}
+
+func newBreaker(role GenerationRole, config BreakerConfig) *breaker {
+	if config.Threshold == 0 {
+		config.Threshold = DefaultBreakerThreshold
+	}
+	if config.Cooldown <= 0 {
+		config.Cooldown = DefaultBreakerCooldown
+	}
+	b := &breaker{role: role, threshold: config.Threshold, cooldown: config.Cooldown, now: time.Now}
+	metrics.LLMCircuitState.WithLabelValues(string(role)).Set(breakerClosed)
+	return b
+}
+
+// allow reports whether a request may be made, letting a single probe through once an open breaker cooled down
+func (b *breaker) allow() error {
+	if b.threshold < 0 {
+		return nil
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	switch b.state {
+	case breakerOpen:
+		if b.now().Sub(b.openedAt) < b.cooldown {
+			return ErrCircuitOpen
+		}
+		b.setState(breakerHalfOpen)
+	case breakerHalfOpen:
+		if b.probing {
+			return ErrCircuitOpen
+		}
+	}
+	b.probing = b.state == breakerHalfOpen
+	return nil
+}
+
+// done records the outcome of an allowed request. A failed probe opens the breaker again, a successful one closes it
+func (b *breaker) done(failed bool) {
+	if b.threshold < 0 {
+		return
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.probing = false
+	if !failed {
+		b.failures = 0
+		b.setState(breakerClosed)
+		return
+	}
+
+	b.failures++
+	if b.state == breakerHalfOpen || b.failures >= b.threshold {
+		b.openedAt = b.now()
+		b.setState(breakerOpen)
+	}
+}
+
+// cancel gives up an allowed request that wasn't made, a probe letting the next request probe instead
+func (b *breaker) cancel() {
+	if b.threshold < 0 {
+		return
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.probing = false
+}
+
+// open reports whether requests are currently refused
+func (b *breaker) open() bool {
+	if b.threshold < 0 {
+		return false
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.state == breakerOpen && b.now().Sub(b.openedAt) < b.cooldown || b.state == breakerHalfOpen && b.probing
+}
+
+func (b *breaker) setState(state int) {
+	if b.state == state {
+		return
+	}
+	if state == breakerOpen {
+		log.Printf("Background: %s LLM circuit breaker opened after %d failures", b.role, b.failures)
+	} else if state == breakerClosed {
+		log.Printf("Background: %s LLM circuit breaker closed", b.role)
+	}
+	b.state = state
+	metrics.LLMCircuitState.WithLabelValues(string(b.role)).Set(float64(state))
+}
+
+// Reasons a chat completion request is retried
+const (
+	RetryRateLimited = "rate_limited"
+	RetryServerError = "server_error"
+	RetryNetwork     = "network"
+)
+
+// retryReason returns why a failed request may be retried, or "" if it may not. Rate limiting, request timeouts,
+// conflicts, server errors and network errors are transient, other API errors such as invalid requests are not
+func retryReason(ctx context.Context, err error) string {
+	if ctx.Err() != nil {
+		return ""
+	}
+
+	var apiErr *openai.Error
+	if !errors.As(err, &apiErr) {
+		if errors.Is(err, context.Canceled) {
+			return ""
+		}
+		return RetryNetwork
+	}
+	switch code := apiErr.StatusCode; {
+	case code == http.StatusTooManyRequests:
+		return RetryRateLimited
+	case code == http.StatusRequestTimeout, code == http.StatusConflict, code >= http.StatusInternalServerError:
+		return RetryServerError
+	}
+	return ""
+}
+
+// retryAfter returns how long the server asked to wait before retrying, from its retry-after-ms or Retry-After headers
+func retryAfter(err error, now time.Time) (time.Duration, bool) {
+	var apiErr *openai.Error
+	if !errors.As(err, &apiErr) || apiErr.Response == nil {
+		return 0, false
+	}
+	header := apiErr.Response.Header
+
+	if ms, err := strconv.ParseFloat(header.Get("retry-after-ms"), 64); err == nil && ms >= 0 {
+		return time.Duration(ms * float64(time.Millisecond)), true
+	}
+	value := header.Get("Retry-After")
+	if seconds, err := strconv.ParseFloat(value, 64); err == nil && seconds >= 0 {
+		return time.Duration(seconds * float64(time.Second)), true
+	}
+	if at, err := http.ParseTime(value); err == nil {
+		return max(at.Sub(now), 0), true
+	}
+	return 0, false
+}
+
+// chatCompletion makes a chat completion request through the generator's circuit breaker, retrying transient failures
+// after the server's Retry-After or a jittered exponential backoff. reserve is called before every attempt the breaker
+// allows, its error ending the request
+func (g *generator) chatCompletion(ctx context.Context, role GenerationRole, params openai.ChatCompletionNewParams, reserve func(context.Context) error) (*openai.ChatCompletion, error) {
+	return resilientRequest(ctx, g, role, reserve, func(ctx context.Context) (*openai.ChatCompletion, error) {
+		return g.client.Chat.Completions.New(ctx, params, option.WithMaxRetries(0))
+	})
+}
+
+// moderation makes a moderation request the way chatCompletion makes chat completion requests
+func (g *generator) moderation(ctx context.Context, role GenerationRole, params openai.ModerationNewParams, reserve func(context.Context) error) (*openai.ModerationNewResponse, error) {
+	return resilientRequest(ctx, g, role, reserve, func(ctx context.Context) (*openai.ModerationNewResponse, error) {
+		return g.client.Moderations.New(ctx, params, option.WithMaxRetries(0))
+	})
+}
+
+// resilientRequest makes a request through the generator's circuit breaker, retrying transient failures. Retries are
+// made here rather than by the client so they go through the breaker, request must disable the client's own
+func resilientRequest[T any](ctx context.Context, g *generator, role GenerationRole, reserve func(context.Context) error, request func(context.Context) (*T, error)) (*T, error) {
+	for attempt := 0; ; attempt++ {
+		// Attempts refused by an open breaker don't count against rate limits and quotas
+		if err := g.breaker.allow(); err != nil {
+			return nil, err
+		}
+		if err := reserve(ctx); err != nil {
+			g.breaker.cancel()
+			return nil, err
+		}
+
+		response, err := request(ctx)
+		reason := ""
+		if err != nil {
+			reason = retryReason(ctx, err)
+		}
+		g.breaker.done(reason != "")
+		if reason == "" || attempt >= g.retry.MaxRetries {
+			return response, err
+		}
+
+		delay, ok := retryAfter(err, time.Now())
+		if !ok {
+			delay = g.retry.backoff(attempt)
+		} else if delay > g.retry.MaxDelay {
+			return nil, fmt.Errorf("retry after %s exceeds the longest retry delay: %w", delay, err)
+		}
+
+		metrics.LLMRetries.WithLabelValues(string(role), reason).Inc()
+		log.Printf("Background: %s LLM request failed (%s), retrying in %s: %v", role, reason, delay.Round(time.Millisecond), err)
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(delay):
+		}
+	}
+}
+
+// generationUnavailable reports whether a page generation role's circuit breaker is open, new pages not being
+// generated for some requests until it closes
+func (n *Nexus) generationUnavailable() bool {
+	for _, role := range n.pageRoles() {
+		if n.generators[role].breaker.open() {
+			return true
+		}
+	}
+	return false
+}
+
+// generationBlocked reports whether every page generation role's circuit breaker is open, so nothing can be generated
+func (n *Nexus) generationBlocked() bool {
+	for _, role := range n.pageRoles() {
+		if !n.generators[role].breaker.open() {
+			return false
+		}
+	}
+	return true
+}
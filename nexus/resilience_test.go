@@ -0,0 +1,175 @@
+package nexus
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/openai/openai-go/v2"
+)
+
+func TestBreaker(t *testing.T) {
+	now := time.Unix(0, 0)
+	b := newBreaker(TriggerRole, BreakerConfig{Threshold: 2, Cooldown: time.Minute})
+	b.now = func() time.Time { return now }
+
+	// Failures below the threshold keep it closed, a success resets them
+	for _, failed := range []bool{true, false, true} {
+		if err := b.allow(); err != nil {
+			t.Fatalf("allow() error = %v", err)
+		}
+		b.done(failed)
+	}
+	if b.open() {
+		t.Fatal("Expected the breaker to be closed")
+	}
+
+	b.allow()
+	b.done(true)
+	if !b.open() || !errors.Is(b.allow(), ErrCircuitOpen) {
+		t.Fatal("Expected the breaker to open after 2 consecutive failures")
+	}
+
+	// After the cooldown a single probe is let through, its failure opening the breaker again
+	now = now.Add(time.Minute)
+	if err := b.allow(); err != nil {
+		t.Fatalf("Expected a probe after the cooldown, got %v", err)
+	}
+	if !errors.Is(b.allow(), ErrCircuitOpen) {
+		t.Error("Expected a single probe at a time")
+	}
+	b.done(true)
+	if !b.open() {
+		t.Fatal("Expected a failed probe to open the breaker")
+	}
+
+	// A probe given up before its request was made lets the next request probe
+	now = now.Add(time.Minute)
+	b.allow()
+	b.cancel()
+	if err := b.allow(); err != nil {
+		t.Fatalf("Expected another probe after a cancelled one, got %v", err)
+	}
+	b.done(true)
+
+	now = now.Add(time.Minute)
+	b.allow()
+	b.done(false)
+	if b.open() || b.allow() != nil {
+		t.Error("Expected a successful probe to close the breaker")
+	}
+}
+
+func TestRetryAfter(t *testing.T) {
+	now := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name     string
+		header   http.Header
+		expected time.Duration
+		ok       bool
+	}{
+		{name: "seconds", header: http.Header{"Retry-After": {"2"}}, expected: 2 * time.Second, ok: true},
+		{name: "milliseconds take precedence", header: http.Header{"Retry-After": {"2"}, "Retry-After-Ms": {"150"}}, expected: 150 * time.Millisecond, ok: true},
+		{name: "HTTP date", header: http.Header{"Retry-After": {now.Add(5 * time.Second).Format(http.TimeFormat)}}, expected: 5 * time.Second, ok: true},
+		{name: "past date", header: http.Header{"Retry-After": {now.Add(-time.Hour).Format(http.TimeFormat)}}, expected: 0, ok: true},
+		{name: "missing", header: http.Header{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := &openai.Error{StatusCode: http.StatusTooManyRequests, Response: &http.Response{Header: tt.header}}
+			delay, ok := retryAfter(err, now)
+			if ok != tt.ok || delay != tt.expected {
+				t.Errorf("retryAfter() = %v, %v, expected %v, %v", delay, ok, tt.expected, tt.ok)
+			}
+		})
+	}
+}
+
+func TestRetryBackoff(t *testing.T) {
+	retry := RetryConfig{BaseDelay: 100 * time.Millisecond, MaxDelay: time.Second}.withDefaults()
+	for attempt, expected := range []time.Duration{100, 200, 400, 800, 1000, 1000} {
+		expected *= time.Millisecond
+		for range 20 {
+			if delay := retry.backoff(attempt); delay < expected/2 || delay > expected {
+				t.Fatalf("backoff(%d) = %v, expected between %v and %v", attempt, delay, expected/2, expected)
+			}
+		}
+	}
+}
+
+func TestChatCompletion_Retries(t *testing.T) {
+	var statuses []int
+	responses := []int{http.StatusTooManyRequests, http.StatusServiceUnavailable, http.StatusOK, http.StatusBadRequest, http.StatusInternalServerError, http.StatusInternalServerError, http.StatusInternalServerError}
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		status := responses[len(statuses)%len(responses)]
+		statuses = append(statuses, status)
+
+		w.Header().Set("Content-Type", "application/json")
+		if status == http.StatusTooManyRequests {
+			w.Header().Set("Retry-After-Ms", "1")
+		}
+		if status != http.StatusOK {
+			w.WriteHeader(status)
+			json.NewEncoder(w).Encode(map[string]any{"error": map[string]any{"message": http.StatusText(status)}})
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]any{
+			"choices": []any{map[string]any{
+				"finish_reason": "stop",
+				"message":       map[string]any{"role": "assistant", "content": testPageJSON},
+			}},
+		})
+	}))
+	defer server.Close()
+
+	generators, err := newGenerators(&Config{
+		LLM:     ProviderConfig{BaseURL: server.URL, APIKey: "test"},
+		Retry:   RetryConfig{MaxRetries: 3, BaseDelay: time.Millisecond, MaxDelay: 10 * time.Millisecond},
+		Breaker: BreakerConfig{Threshold: 3, Cooldown: time.Hour},
+	})
+	if err != nil {
+		t.Fatalf("newGenerators() error = %v", err)
+	}
+	g := generators[TriggerRole]
+	params := openai.ChatCompletionNewParams{Model: g.model, Messages: []openai.ChatCompletionMessageParamUnion{openai.UserMessage("prompt")}}
+
+	// Rate limiting and server errors are retried
+	if _, err := g.chatCompletion(context.Background(), TriggerRole, params, noReserve); err != nil {
+		t.Fatalf("chatCompletion() error = %v", err)
+	}
+	if len(statuses) != 3 {
+		t.Errorf("Expected 3 requests, got %v", statuses)
+	}
+
+	// Invalid requests are not
+	if _, err := g.chatCompletion(context.Background(), TriggerRole, params, noReserve); err == nil || len(statuses) != 4 {
+		t.Errorf("Expected a single failed request, got %v and %v", err, statuses)
+	}
+
+	// Consecutive server errors open the breaker, stopping the retries and later requests
+	if _, err := g.chatCompletion(context.Background(), TriggerRole, params, noReserve); !errors.Is(err, ErrCircuitOpen) {
+		t.Errorf("Expected ErrCircuitOpen, got %v", err)
+	}
+	reserved := 0
+	reserve := func(context.Context) error {
+		reserved++
+		return nil
+	}
+	if _, err := g.chatCompletion(context.Background(), TriggerRole, params, reserve); !errors.Is(err, ErrCircuitOpen) || len(statuses) != 7 {
+		t.Errorf("Expected no request while the breaker is open, got %v and %v", err, statuses)
+	}
+	if reserved != 0 {
+		t.Errorf("Expected requests refused by the breaker not to be reserved, got %d", reserved)
+	}
+}
+
+// noReserve admits every chat completion request
+func noReserve(context.Context) error {
+	return nil
+}
@@ -3,46 +3,73 @@ package nexus
 import (
 	"context"
 	"fmt"
+	"log"
 	"time"
 
 	"github.com/dbrun3/nexus-vector/dao"
 	"github.com/dbrun3/nexus-vector/model"
-	"github.com/dbrun3/nexus-vector/util"
 	"github.com/qdrant/go-client/qdrant"
 )
 
-// queryQdrant queries the db for embeddings for pages where the current day exists within their eligible time range
-func (n *Nexus) queryQdrant(ctx context.Context, embedding []float32) ([]*qdrant.ScoredPoint, error) {
+const QueryLimit = 4
+
+// queryQdrant queries the db for embeddings for a tenant's pages in any of the given locales where the current day
+// exists within their eligible time range, searching the vector space of the given embedding model. Pages must also
+// match any extra conditions
+func (n *Nexus) queryQdrant(ctx context.Context, tenant, embeddingModel string, locales []string, embedding []float32, conditions ...*qdrant.Condition) ([]*qdrant.ScoredPoint, error) {
+	vector, err := n.collectionVector(ctx, tenant, embeddingModel)
+	if err != nil {
+		return nil, err
+	}
+	return n.qdClient.Query(ctx, n.pageQuery(tenant, vector, locales, embedding, conditions...))
+}
+
+// pageQuery builds the query of queryQdrant, searching the named vector given, or the unnamed vector when it is empty
+func (n *Nexus) pageQuery(tenant, vector string, locales []string, embedding []float32, conditions ...*qdrant.Condition) *qdrant.QueryPoints {
 	now := float64(time.Now().Unix())
-	return n.qdClient.Query(ctx, &qdrant.QueryPoints{
-		CollectionName: PageCollection,
+	var using *string
+	if vector != "" {
+		using = qdrant.PtrOf(vector)
+	}
+	return &qdrant.QueryPoints{
+		CollectionName: n.pageCollection(tenant),
 		Query:          qdrant.NewQuery(embedding...),
+		Using:          using,
 		WithPayload:    qdrant.NewWithPayload(true),
 		Filter: &qdrant.Filter{
-			Must: []*qdrant.Condition{
+			Must: append([]*qdrant.Condition{
+				tenantCondition(tenant),
+				localeCondition(locales),
 				qdrant.NewRange("from", &qdrant.Range{
 					Lte: &now,
 				}),
 				qdrant.NewRange("until", &qdrant.Range{
 					Gte: &now,
 				}),
-			},
+			}, conditions...),
 		},
-		Limit: qdrant.PtrOf(uint64(4)),
-	})
+		Limit: qdrant.PtrOf(uint64(QueryLimit * len(locales))), // room for every fallback locale
+	}
 }
 
-func (n *Nexus) getAsyncResults(ctx context.Context, userId string) ([]*qdrant.ScoredPoint, []float32, error) {
-	redisEmbedding, err := n.rdClient.Get(ctx, userId).Result()
+func (n *Nexus) getAsyncResults(ctx context.Context, tenant, userId, embeddingModel string, locales []string) ([]*qdrant.ScoredPoint, []float32, error) {
+	userEmbedding, err := n.loadUserEmbedding(ctx, tenant, userId, embeddingModel)
 	if err != nil {
-		return nil, nil, fmt.Errorf("failed to get embedding: %w", err)
+		return nil, nil, err
 	}
-	userEmbedding, err := dao.EmbeddingFromRedis(redisEmbedding)
-	if err != nil {
-		return nil, nil, fmt.Errorf("failed to convert embedding: %w", err)
+
+	// Users represented by several vectors are also queried with each facet, the profile vector alone being blended
+	// with the trigger
+	vectors := [][]float32{userEmbedding}
+	if n.userVectors.MultiVector {
+		facets, err := n.loadUserFacets(ctx, tenant, userId, embeddingModel)
+		if err != nil {
+			return nil, nil, err
+		}
+		vectors = append(vectors, facets...)
 	}
 
-	userResults, err := n.queryQdrant(ctx, userEmbedding)
+	userResults, err := n.queryUserVectors(ctx, tenant, embeddingModel, locales, vectors)
 	if err != nil {
 		return nil, nil, fmt.Errorf("failed to get pages: %w", err)
 	}
@@ -50,26 +77,46 @@ func (n *Nexus) getAsyncResults(ctx context.Context, userId string) ([]*qdrant.S
 	return userResults, userEmbedding, nil
 }
 
-func (n *Nexus) getSyncResults(ctx context.Context, trigger model.Trigger) ([]*qdrant.ScoredPoint, []float32, error) {
+func (n *Nexus) getSyncResults(ctx context.Context, tenant string, trigger model.Trigger, embeddingModel string, locales []string) ([]*qdrant.ScoredPoint, []float32, error) {
+	triggerEmbedding, err := n.embedTrigger(ctx, embeddingModel, trigger)
+	if err != nil {
+		return nil, nil, err
+	}
+	n.drift.sample(embeddingModel, string(trigger.TriggerType), triggerEmbedding)
+
+	triggerResults, err := n.queryQdrant(ctx, tenant, embeddingModel, locales, triggerEmbedding)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to get pages: %w", err)
+	}
+	return triggerResults, triggerEmbedding, nil
+}
+
+// embedTrigger returns the validated, cached embedding of a trigger for an embedding model
+func (n *Nexus) embedTrigger(ctx context.Context, embeddingModel string, trigger model.Trigger) ([]float32, error) {
 	// Clean trigger for better embedding generation
-	cleanText, err := util.CleanTriggerForEmbedding(trigger)
+	cleanText, err := n.serializer.TriggerText(trigger)
 	if err != nil {
-		return nil, nil, fmt.Errorf("failed to clean trigger: %w", err)
+		return nil, fmt.Errorf("failed to clean trigger: %w", err)
 	}
-	triggerEmbeddings, err := n.tsClient.TextToEmbeddings(ctx, cleanText)
+	triggerEmbedding, err := n.triggerEmbedding(ctx, embeddingModel, cleanText)
 	if err != nil {
-		return nil, nil, fmt.Errorf("failed to create trigger embedding: %w", err)
+		return nil, err
 	}
-	if len(triggerEmbeddings) != 1 {
-		return nil, nil, fmt.Errorf("invalid number of embeddings returned")
+	return triggerEmbedding, nil
+}
+
+// getContextResults queries contextual pages with the blend of a request's trigger and user embeddings
+func (n *Nexus) getContextResults(ctx context.Context, tenant, embeddingModel string, locales []string, syncEmbedding, asyncEmbedding []float32) ([]*qdrant.ScoredPoint, error) {
+	blended := blendEmbeddings(syncEmbedding, asyncEmbedding, n.contextual.triggerWeight())
+	if blended == nil {
+		return nil, fmt.Errorf("trigger and user embeddings have different dimensions")
 	}
 
-	triggerEmbedding := triggerEmbeddings[0]
-	triggerResults, err := n.queryQdrant(ctx, triggerEmbedding)
+	contextResults, err := n.queryQdrant(ctx, tenant, embeddingModel, locales, blended, qdrant.NewMatchKeyword("source.kind", string(dao.ContextSource)))
 	if err != nil {
-		return nil, nil, fmt.Errorf("failed to get pages: %w", err)
+		return nil, fmt.Errorf("failed to get pages: %w", err)
 	}
-	return triggerResults, triggerEmbedding, nil
+	return contextResults, nil
 }
 
 func convertResultsToRelevantPages(searchResults []*qdrant.ScoredPoint, minScore float32) []model.Page {
@@ -131,6 +178,25 @@ func convertResultsToRelevantPages(searchResults []*qdrant.ScoredPoint, minScore
 					}
 				}
 
+				// Pages stored before pages carried a locale are in DefaultLocale
+				page.Locale = DefaultLocale
+				if localeVal, exists := fields["locale"]; exists {
+					if stringVal := localeVal.GetStringValue(); stringVal != "" {
+						page.Locale = stringVal
+					}
+				}
+
+				if versionVal, exists := fields["schemaVersion"]; exists {
+					page.SchemaVersion = int(versionVal.GetIntegerValue())
+				}
+
+				content, err := dao.ContentFromPayload(fields)
+				if err != nil {
+					log.Printf("Skipping page %s: %v", page.Id, err)
+					continue
+				}
+				page.Content = content
+
 				pages = append(pages, page)
 			}
 		}
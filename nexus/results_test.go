@@ -2,8 +2,10 @@ package nexus
 
 import (
 	"encoding/json"
+	"reflect"
 	"testing"
 
+	"github.com/dbrun3/nexus-vector/dao"
 	"github.com/dbrun3/nexus-vector/model"
 	"github.com/qdrant/go-client/qdrant"
 )
@@ -189,3 +191,31 @@ func TestConvertResultsToRelevantPages_InvalidPayload(t *testing.T) {
 		t.Errorf("Expected 0 pages for invalid payload, got %d", len(pages))
 	}
 }
+
+func TestConvertResultsToRelevantPages_Content(t *testing.T) {
+	page := model.Page{
+		Id:            "test-page-2",
+		Layout:        "carousel",
+		Type:          "offer",
+		Category:      "groceries",
+		Title:         []string{"Fresh Picks"},
+		Locale:        "es",
+		SchemaVersion: model.PageSchemaVersion,
+		Content: &model.PageContent{
+			CallToAction: &model.CallToAction{Text: "Comprar", DeepLink: "app://offers/42"},
+			Offer:        &model.Offer{Value: 15, Unit: "percent", ExpiresAt: "2026-12-31"},
+			Items:        []model.CarouselItem{{Title: "Avocados"}, {Title: "Almond Milk", ImageRef: "milk.png"}},
+		},
+	}
+
+	payload := dao.NewQdrantPagePayload(page, dao.PageSource{}, DefaultTenant, 0, 0)
+	results := []*qdrant.ScoredPoint{{Score: 1.0, Payload: qdrant.NewValueMap(payload.ToMap())}}
+
+	pages := convertResultsToRelevantPages(results, 0.5)
+	if len(pages) != 1 {
+		t.Fatalf("Expected 1 page, got %d", len(pages))
+	}
+	if !reflect.DeepEqual(pages[0], page) {
+		t.Errorf("Page did not survive the payload round trip:\n got %+v\nwant %+v", pages[0], page)
+	}
+}
@@ -0,0 +1,358 @@
+package nexus
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"regexp"
+	"slices"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/dbrun3/nexus-vector/metrics"
+	"github.com/dbrun3/nexus-vector/model"
+	"github.com/openai/openai-go/v2"
+)
+
+// SafetyAction is what happens to a generated page whose copy breaks a safety rule
+type SafetyAction string
+
+const (
+	// RejectAction drops the page
+	RejectAction SafetyAction = "reject"
+	// RedactAction replaces the offending text with RedactionMask
+	RedactAction SafetyAction = "redact"
+)
+
+// RedactionMask replaces redacted text
+const RedactionMask = "***"
+
+// Rules of the safety decisions that are not configured
+const (
+	TenantBlocklistRule = "tenant_blocklist"
+	ModerationRule      = "moderation"
+)
+
+// SafetyRule is a local content policy matched case insensitively against every piece of a page's copy
+type SafetyRule struct {
+	Name     string       `json:"name"`
+	Terms    []string     `json:"terms,omitempty"`    // words or phrases matched whole
+	Patterns []string     `json:"patterns,omitempty"` // regular expressions
+	Action   SafetyAction `json:"action,omitempty"`   // defaults to RejectAction
+}
+
+// DefaultSafetyRules are the local content policies used when SafetyConfig.Rules is empty
+var DefaultSafetyRules = []SafetyRule{
+	{
+		Name:   "profanity",
+		Terms:  []string{"damn", "shit", "fuck", "fucking", "bitch", "bastard", "asshole", "crap", "piss"},
+		Action: RedactAction,
+	},
+	{
+		Name: "medical_claim",
+		Patterns: []string{
+			`\bcures?\b`,
+			`\bclinically proven\b`,
+			`\bdoctor[- ]recommended\b`,
+			`\bfda[- ]approved\b`,
+			`\b(prevents?|treats?|heals?)\s+(cancer|diabetes|depression|anxiety|disease|illness|infections?)\b`,
+			`\blose \d+\s*(lbs?|pounds|kg)\b`,
+		},
+	},
+	{
+		Name: "financial_claim",
+		Patterns: []string{
+			`\bguaranteed\s+(returns?|income|profits?|approval|winnings?)\b`,
+			`\brisk[- ]free\b`,
+			`\bget rich\b`,
+			`\bdouble your money\b`,
+			`\bno credit check\b`,
+		},
+	},
+}
+
+// SafetyConfig configures the content safety checks generated pages pass before they are stored
+type SafetyConfig struct {
+	// Rules replace DefaultSafetyRules when set, tenants adding their own blocked terms
+	Rules []SafetyRule
+
+	// Moderation enables a moderation API call on every page's copy, rejecting flagged pages. Its API key defaults to
+	// Config.OpenAIKey and its model to omni-moderation-latest
+	Moderation *ProviderConfig
+}
+
+// safetyRule is a compiled SafetyRule
+type safetyRule struct {
+	name    string
+	pattern *regexp.Regexp
+	action  SafetyAction
+}
+
+// moderator applies the safety rules and the optional moderation API to generated pages
+type moderator struct {
+	rules []safetyRule
+
+	// Moderation API provider, nil when moderation is disabled
+	generator *generator
+}
+
+// safetyDecision is what a safety check did to a page
+type safetyDecision struct {
+	rule   string
+	action SafetyAction
+	match  string
+}
+
+func newModerator(config *Config) (*moderator, error) {
+	rules := config.Safety.Rules
+	if len(rules) == 0 {
+		rules = DefaultSafetyRules
+	}
+
+	m := &moderator{}
+	for _, rule := range rules {
+		compiled, err := compileSafetyRule(rule)
+		if err != nil {
+			return nil, err
+		}
+		if compiled.pattern != nil {
+			m.rules = append(m.rules, compiled)
+		}
+	}
+
+	if config.Safety.Moderation != nil {
+		provider := ProviderConfig{APIKey: config.OpenAIKey, Model: openai.ModerationModelOmniModerationLatest}.merge(*config.Safety.Moderation)
+		g, err := newGenerator(provider)
+		if err != nil {
+			return nil, fmt.Errorf("invalid moderation provider: %w", err)
+		}
+		g.retry = config.Retry.withDefaults()
+		g.breaker = newBreaker(ModerationRole, config.Breaker)
+		m.generator = g
+	}
+	return m, nil
+}
+
+// compileSafetyRule combines a rule's terms and patterns into one case insensitive pattern, nil for a rule without any
+func compileSafetyRule(rule SafetyRule) (safetyRule, error) {
+	action := rule.Action
+	if action == "" {
+		action = RejectAction
+	}
+	if action != RejectAction && action != RedactAction {
+		return safetyRule{}, fmt.Errorf("safety rule %q has unknown action %q", rule.Name, action)
+	}
+
+	alternatives := make([]string, 0, len(rule.Terms)+len(rule.Patterns))
+	for _, term := range rule.Terms {
+		if term = strings.TrimSpace(term); term != "" {
+			alternatives = append(alternatives, termPattern(term))
+		}
+	}
+	for _, pattern := range rule.Patterns {
+		if _, err := regexp.Compile(pattern); err != nil {
+			return safetyRule{}, fmt.Errorf("safety rule %q has invalid pattern: %w", rule.Name, err)
+		}
+		alternatives = append(alternatives, "(?:"+pattern+")")
+	}
+	if len(alternatives) == 0 {
+		return safetyRule{name: rule.Name, action: action}, nil
+	}
+
+	pattern, err := regexp.Compile("(?i)" + strings.Join(alternatives, "|"))
+	if err != nil {
+		return safetyRule{}, fmt.Errorf("safety rule %q: %w", rule.Name, err)
+	}
+	return safetyRule{name: rule.Name, pattern: pattern, action: action}, nil
+}
+
+// termPattern matches a term as a whole word or phrase, e.g. "Target" but not "targeted"
+func termPattern(term string) string {
+	pattern := regexp.QuoteMeta(term)
+	if first, _ := utf8.DecodeRuneInString(term); isWordRune(first) {
+		pattern = `\b` + pattern
+	}
+	if last, _ := utf8.DecodeLastRuneInString(term); isWordRune(last) {
+		pattern += `\b`
+	}
+	return pattern
+}
+
+func isWordRune(r rune) bool {
+	return r == '_' || unicode.IsLetter(r) || unicode.IsDigit(r)
+}
+
+// blocklistRule is the rule rejecting pages that mention any of a tenant's blocked terms, e.g. competitor names
+func blocklistRule(terms []string) *safetyRule {
+	rule, err := compileSafetyRule(SafetyRule{Name: TenantBlocklistRule, Terms: terms})
+	if err != nil || rule.pattern == nil {
+		return nil
+	}
+	return &rule
+}
+
+// pageTexts returns pointers to every piece of copy a page shows its user
+func pageTexts(page *model.Page) []*string {
+	var texts []*string
+	for i := range page.Title {
+		texts = append(texts, &page.Title[i])
+	}
+	for i := range page.SubTitle {
+		texts = append(texts, &page.SubTitle[i])
+	}
+	if content := page.Content; content != nil {
+		if content.CallToAction != nil {
+			texts = append(texts, &content.CallToAction.Text)
+		}
+		for i := range content.Items {
+			texts = append(texts, &content.Items[i].Title, &content.Items[i].SubTitle)
+		}
+		for i := range content.Questions {
+			texts = append(texts, &content.Questions[i].Prompt)
+			for j := range content.Questions[i].Options {
+				texts = append(texts, &content.Questions[i].Options[j])
+			}
+		}
+	}
+	return texts
+}
+
+// clonePage deep copies a page, so redacting the copy's text leaves the page untouched
+func clonePage(page model.Page) model.Page {
+	page.Title = slices.Clone(page.Title)
+	page.SubTitle = slices.Clone(page.SubTitle)
+	if page.Content == nil {
+		return page
+	}
+
+	content := *page.Content
+	if content.CallToAction != nil {
+		callToAction := *content.CallToAction
+		content.CallToAction = &callToAction
+	}
+	if content.Offer != nil {
+		offer := *content.Offer
+		content.Offer = &offer
+	}
+	content.Items = slices.Clone(content.Items)
+	content.Questions = slices.Clone(content.Questions)
+	for i := range content.Questions {
+		content.Questions[i].Options = slices.Clone(content.Questions[i].Options)
+	}
+	page.Content = &content
+	return page
+}
+
+// applyRules applies safety rules to a page's copy, redacting it in place. It returns every decision made, stopping at
+// the first rejection
+func applyRules(page *model.Page, rules []safetyRule) []safetyDecision {
+	var decisions []safetyDecision
+	for _, text := range pageTexts(page) {
+		for _, rule := range rules {
+			match := rule.pattern.FindString(*text)
+			if match == "" {
+				continue
+			}
+			decisions = append(decisions, safetyDecision{rule: rule.name, action: rule.action, match: match})
+			if rule.action == RejectAction {
+				return decisions
+			}
+			*text = rule.pattern.ReplaceAllString(*text, RedactionMask)
+		}
+	}
+	return decisions
+}
+
+// moderate asks the moderation API whether a page's copy is flagged, returning the flagged categories. Requests go
+// through the moderation provider's circuit breaker and retries, count against the rate limits of a tenant's user and
+// are recorded in its usage
+func (n *Nexus) moderate(ctx context.Context, tenant, userId string, page model.Page) ([]string, error) {
+	var texts []string
+	for _, text := range pageTexts(&page) {
+		if *text != "" {
+			texts = append(texts, *text)
+		}
+	}
+	if len(texts) == 0 {
+		return nil, nil
+	}
+
+	g := n.moderator.generator
+	params := openai.ModerationNewParams{
+		Input: openai.ModerationNewParamsInputUnion{OfStringArray: texts},
+		Model: g.model,
+	}
+	response, err := g.moderation(ctx, ModerationRole, params, func(ctx context.Context) error {
+		return n.reserveRequest(ctx, tenant, userId)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("moderation API error: %w", err)
+	}
+	// Moderation is free on the OpenAI API, so only the request is counted unless a price is configured
+	if err := n.recordUsage(ctx, tenant, ModerationRole, g, openai.CompletionUsage{}); err != nil {
+		log.Printf("Background: %v", err)
+	}
+
+	var flagged []string
+	for _, result := range response.Results {
+		if !result.Flagged {
+			continue
+		}
+		var categories map[string]bool
+		if err := json.Unmarshal([]byte(result.Categories.RawJSON()), &categories); err != nil {
+			return nil, fmt.Errorf("failed to decode moderation categories: %w", err)
+		}
+		for category, ok := range categories {
+			if ok && !slices.Contains(flagged, category) {
+				flagged = append(flagged, category)
+			}
+		}
+		if len(flagged) == 0 {
+			flagged = append(flagged, "flagged")
+		}
+	}
+	slices.Sort(flagged)
+	return flagged, nil
+}
+
+// moderatePages applies the safety rules, the tenant's blocklist and the moderation API to a tenant's generated pages,
+// returning copies of the pages that may be stored with offending copy redacted. Pages the moderation API fails to
+// check are rejected
+func (n *Nexus) moderatePages(ctx context.Context, tenant, userId string, role GenerationRole, settings tenantSettings, pages []model.Page) []model.Page {
+	rules := n.moderator.rules
+	if settings.blocklist != nil {
+		rules = append(slices.Clone(rules), *settings.blocklist)
+	}
+
+	allowed := make([]model.Page, 0, len(pages))
+	for _, page := range pages {
+		text := pageCopy(page)
+		page = clonePage(page)
+		decisions := applyRules(&page, rules)
+
+		rejected := len(decisions) > 0 && decisions[len(decisions)-1].action == RejectAction
+		if !rejected && n.moderator.generator != nil {
+			categories, err := n.moderate(ctx, tenant, userId, page)
+			if err != nil {
+				metrics.SafetyDecisions.WithLabelValues(string(role), ModerationRule, "error").Inc()
+				log.Printf("Background: Safety reject of %s page %q, moderation failed: %v", role, text, err)
+				continue
+			}
+			if len(categories) > 0 {
+				decisions = append(decisions, safetyDecision{rule: ModerationRule, action: RejectAction, match: strings.Join(categories, ",")})
+				rejected = true
+			}
+		}
+
+		for _, decision := range decisions {
+			metrics.SafetyDecisions.WithLabelValues(string(role), decision.rule, string(decision.action)).Inc()
+			log.Printf("Background: Safety %s of %s page %q, %s matched %q", decision.action, role, text, decision.rule, decision.match)
+		}
+		if !rejected {
+			allowed = append(allowed, page)
+		}
+	}
+	return allowed
+}
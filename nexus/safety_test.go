@@ -0,0 +1,169 @@
+package nexus
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dbrun3/nexus-vector/model"
+)
+
+func TestApplyRules(t *testing.T) {
+	m, err := newModerator(&Config{})
+	if err != nil {
+		t.Fatalf("newModerator() error = %v", err)
+	}
+	rules := append(m.rules, *blocklistRule([]string{"Target", "AT&T"}))
+
+	tests := []struct {
+		name     string
+		page     model.Page
+		rejected string
+		title    string
+	}{
+		{
+			name:  "clean copy is kept",
+			page:  model.Page{Title: []string{"Fresh picks for your targeted savings"}},
+			title: "Fresh picks for your targeted savings",
+		},
+		{
+			name:  "profanity is redacted",
+			page:  model.Page{Title: []string{"Damn good coffee deals"}},
+			title: "*** good coffee deals",
+		},
+		{
+			name:     "medical claims are rejected",
+			page:     model.Page{Title: []string{"Vitamins"}, SubTitle: []string{"Clinically proven to boost immunity"}},
+			rejected: "medical_claim",
+		},
+		{
+			name: "financial claims in content are rejected",
+			page: model.Page{Title: []string{"Invest"}, Content: &model.PageContent{
+				CallToAction: &model.CallToAction{Text: "Get guaranteed returns", DeepLink: "app://invest"},
+			}},
+			rejected: "financial_claim",
+		},
+		{
+			name:     "tenant blocked terms are rejected",
+			page:     model.Page{Title: []string{"Better than AT&T"}},
+			rejected: TenantBlocklistRule,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			decisions := applyRules(&tt.page, rules)
+
+			if tt.rejected != "" {
+				last := decisions[len(decisions)-1]
+				if last.rule != tt.rejected || last.action != RejectAction {
+					t.Errorf("Expected rejection by %s, got %+v", tt.rejected, decisions)
+				}
+				return
+			}
+			for _, decision := range decisions {
+				if decision.action == RejectAction {
+					t.Errorf("Unexpected rejection %+v", decision)
+				}
+			}
+			if tt.page.Title[0] != tt.title {
+				t.Errorf("Expected title %q, got %q", tt.title, tt.page.Title[0])
+			}
+		})
+	}
+}
+
+func TestCompileSafetyRule_Invalid(t *testing.T) {
+	if _, err := compileSafetyRule(SafetyRule{Name: "broken", Patterns: []string{"("}}); err == nil {
+		t.Error("Expected an invalid pattern error")
+	}
+	if _, err := compileSafetyRule(SafetyRule{Name: "unknown", Terms: []string{"x"}, Action: "hide"}); err == nil {
+		t.Error("Expected an unknown action error")
+	}
+}
+
+func TestModeratePages(t *testing.T) {
+	var inputs [][]string
+
+	// The moderation server flags copy mentioning violence
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var request struct {
+			Input []string `json:"input"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+			t.Errorf("Failed to decode request: %v", err)
+		}
+		inputs = append(inputs, request.Input)
+
+		results := make([]any, len(request.Input))
+		for i, input := range request.Input {
+			violent := strings.Contains(strings.ToLower(input), "fight")
+			results[i] = map[string]any{
+				"flagged":    violent,
+				"categories": map[string]bool{"violence": violent, "hate": false},
+			}
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]any{"id": "modr-test", "model": "omni-moderation-latest", "results": results})
+	}))
+	defer server.Close()
+
+	m, err := newModerator(&Config{Safety: SafetyConfig{Moderation: &ProviderConfig{BaseURL: server.URL, APIKey: "test"}}})
+	if err != nil {
+		t.Fatalf("newModerator() error = %v", err)
+	}
+	_, rdClient := newFakeRedis(t)
+	n := &Nexus{moderator: m, rdClient: rdClient, limits: GenerationLimits{UserRPM: 10}}
+	settings := newTenantSettings(TenantConfig{BlockedTerms: []string{"Walmart"}}, nil)
+	ctx := context.Background()
+
+	pages := []model.Page{
+		{Title: []string{"Crap deals this week"}},
+		{Title: []string{"Fight night snacks"}},
+		{Title: []string{"Cheaper than Walmart"}},
+	}
+	allowed := n.moderatePages(ctx, DefaultTenant, "u1", TriggerRole, settings, pages)
+
+	if len(allowed) != 1 || allowed[0].Title[0] != "*** deals this week" {
+		t.Fatalf("Expected only the redacted page, got %+v", allowed)
+	}
+	if pages[0].Title[0] != "Crap deals this week" {
+		t.Errorf("Expected the generated page to be left unredacted, got %q", pages[0].Title[0])
+	}
+	// Pages rejected by a local rule are not sent for moderation, redacted copy is sent redacted
+	if len(inputs) != 2 || inputs[0][0] != "*** deals this week" || inputs[1][0] != "Fight night snacks" {
+		t.Errorf("Unexpected moderation inputs %v", inputs)
+	}
+
+	// Moderation requests are recorded in the usage and count against the user's rate limit
+	requests, _ := rdClient.HGet(ctx, usageKey(DefaultTenant, usageDay(time.Now())), string(ModerationRole)+":requests").Result()
+	rate, _ := rdClient.Get(ctx, n.rateWindows(DefaultTenant, "u1")[0].key).Result()
+	if requests != "2" || rate != "2" {
+		t.Errorf("Expected 2 moderation requests recorded and rate limited, got %q and %q", requests, rate)
+	}
+}
+
+func TestClonePage(t *testing.T) {
+	page := model.Page{
+		Title: []string{"Title"},
+		Content: &model.PageContent{
+			CallToAction: &model.CallToAction{Text: "Shop"},
+			Items:        []model.CarouselItem{{Title: "Item"}},
+			Questions:    []model.SurveyQuestion{{Prompt: "Prompt", Options: []string{"Option"}}},
+		},
+	}
+
+	clone := clonePage(page)
+	for _, text := range pageTexts(&clone) {
+		*text = RedactionMask
+	}
+	for _, text := range pageTexts(&page) {
+		if *text == RedactionMask {
+			t.Fatalf("Expected the page to be left untouched, got %+v", page)
+		}
+	}
+}
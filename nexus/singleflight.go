@@ -0,0 +1,115 @@
+package nexus
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/dbrun3/nexus-vector/metrics"
+	"github.com/dbrun3/nexus-vector/model"
+	"github.com/redis/go-redis/v9"
+)
+
+// DefaultGenerationCacheWindow is how long a generated page is reused for identical input unless configured otherwise
+const DefaultGenerationCacheWindow = 10 * time.Minute
+
+// GenerationLockTTL bounds how long a replica may hold the lock on generating one input before others may take over
+const GenerationLockTTL = 2 * time.Minute
+
+// releaseLock deletes a lock only if it is still held with the given token
+var releaseLock = redis.NewScript(`
+if redis.call("GET", KEYS[1]) == ARGV[1] then
+	return redis.call("DEL", KEYS[1])
+end
+return 0
+`)
+
+// generationKey hashes everything a generation's output depends on: its role, prompt (version and locale) and cleaned
+// input text
+func generationKey(role GenerationRole, prompt, input string) string {
+	h := sha256.New()
+	h.Write([]byte(role))
+	h.Write([]byte{0})
+	h.Write([]byte(prompt))
+	h.Write([]byte{0})
+	h.Write([]byte(input))
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// generateOnce runs generate for a tenant's input and store on the pages it generated unless the same input was
+// generated within the cache window or is being generated by another request on any replica. Those requests share that
+// generation, whose pages are stored by the request that made it.
+func (n *Nexus) generateOnce(ctx context.Context, tenant string, role GenerationRole, prompt, input string, generate func(context.Context) ([]model.Page, error), store func(context.Context, []model.Page) error) error {
+	hash := generationKey(role, prompt, input)
+
+	// Requests in this replica join an in-flight generation without going through Redis. Do reports the result as
+	// shared to the request that made it too once others joined, so the request running the generation is tracked
+	leader := false
+	_, err, _ := n.inflight.Do(tenant+":"+hash, func() (any, error) {
+		leader = true
+		return nil, n.generateLocked(ctx, tenant, role, hash, generate, store)
+	})
+	if !leader {
+		metrics.GenerationsShared.WithLabelValues(string(role), "in_flight").Inc()
+		return nil
+	}
+	return err
+}
+
+// generateLocked generates and stores pages under a Redis lock on their input hash, marking the input generated for the
+// cache window once they are stored so a failed generation can be retried. It skips the input when it was generated
+// within the window or another replica holds the lock, the pages being stored by the request that generated them
+func (n *Nexus) generateLocked(ctx context.Context, tenant string, role GenerationRole, hash string, generate func(context.Context) ([]model.Page, error), store func(context.Context, []model.Page) error) error {
+	cacheKey := tenantKey(tenant, "generated:"+hash)
+	lockKey := tenantKey(tenant, "generating:"+hash)
+
+	if n.generationWindow > 0 {
+		cached, err := n.rdClient.Exists(ctx, cacheKey).Result()
+		if err != nil {
+			return fmt.Errorf("failed to check generation cache: %w", err)
+		}
+		if cached > 0 {
+			metrics.GenerationsShared.WithLabelValues(string(role), "cached").Inc()
+			return nil
+		}
+	}
+
+	token := rand.Text()
+	locked, err := n.rdClient.SetNX(ctx, lockKey, token, GenerationLockTTL).Result()
+	if err != nil {
+		return fmt.Errorf("failed to lock generation: %w", err)
+	}
+	if !locked {
+		metrics.GenerationsShared.WithLabelValues(string(role), "in_flight").Inc()
+		return nil
+	}
+	defer func() {
+		// Release even when ctx is cancelled so a failed generation can be retried straight away
+		if err := releaseLock.Run(context.Background(), n.rdClient, []string{lockKey}, token).Err(); err != nil && !errors.Is(err, redis.Nil) {
+			log.Printf("Background: failed to release generation lock: %v", err)
+		}
+	}()
+
+	pages, err := generate(ctx)
+	if err != nil {
+		return err
+	}
+	if len(pages) > 0 {
+		if err := store(ctx, pages); err != nil {
+			return err
+		}
+	}
+
+	if n.generationWindow > 0 {
+		if err := n.rdClient.Set(ctx, cacheKey, 1, n.generationWindow).Err(); err != nil {
+			log.Printf("Background: failed to mark pages generated: %v", err)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,133 @@
+package nexus
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/dbrun3/nexus-vector/model"
+)
+
+func TestGenerateOnceConcurrent(t *testing.T) {
+	_, rdClient := newFakeRedis(t)
+	n := &Nexus{rdClient: rdClient, generationWindow: time.Minute}
+
+	var calls atomic.Int32
+	started := make(chan struct{})
+	release := make(chan struct{})
+	generate := func(context.Context) ([]model.Page, error) {
+		if calls.Add(1) == 1 {
+			close(started)
+		}
+		<-release
+		return []model.Page{{Title: []string{"Fresh Picks"}}}, nil
+	}
+
+	var stored atomic.Int32
+	store := func(_ context.Context, pages []model.Page) error {
+		stored.Add(int32(len(pages)))
+		return nil
+	}
+
+	const requests = 5
+	var wg sync.WaitGroup
+	request := func() {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := n.generateOnce(context.Background(), DefaultTenant, TriggerRole, "v1/en", "snap at Target", generate, store); err != nil {
+				t.Errorf("generateOnce() error = %v", err)
+			}
+		}()
+	}
+
+	// The other requests start while the first one is generating, joining its generation or, once it is done, finding
+	// the input generated
+	request()
+	<-started
+	for range requests - 1 {
+		request()
+	}
+	close(release)
+	wg.Wait()
+
+	if calls.Load() != 1 || stored.Load() != 1 {
+		t.Errorf("Expected one generation stored once, got %d calls and %d pages stored", calls.Load(), stored.Load())
+	}
+}
+
+func TestGenerateLockedWindow(t *testing.T) {
+	fake, rdClient := newFakeRedis(t)
+	n := &Nexus{rdClient: rdClient, generationWindow: time.Minute}
+	ctx := context.Background()
+
+	var calls atomic.Int32
+	generate := func(context.Context) ([]model.Page, error) {
+		calls.Add(1)
+		return []model.Page{{Title: []string{"Fresh Picks"}}}, nil
+	}
+	var stored atomic.Int32
+	store := func(_ context.Context, pages []model.Page) error {
+		stored.Add(int32(len(pages)))
+		return nil
+	}
+
+	hash := generationKey(TriggerRole, "v1/en", "snap at Target")
+	if err := n.generateLocked(ctx, "acme", TriggerRole, hash, generate, store); err != nil || stored.Load() != 1 {
+		t.Fatalf("generateLocked() error = %v, %d pages stored", err, stored.Load())
+	}
+	if value, _ := fake.Get(tenantKey("acme", "generated:"+hash)); value != "1" {
+		t.Errorf("Expected the input marked generated, got %q", value)
+	}
+	if fake.Exists(tenantKey("acme", "generating:"+hash)) {
+		t.Error("Expected the generation lock released")
+	}
+
+	// A repeat within the window is skipped, while other tenants and inputs are generated
+	if err := n.generateLocked(ctx, "acme", TriggerRole, hash, generate, store); err != nil || stored.Load() != 1 {
+		t.Fatalf("Expected a repeat to be skipped, got %v, %d pages stored", err, stored.Load())
+	}
+	if err := n.generateLocked(ctx, DefaultTenant, TriggerRole, hash, generate, store); err != nil {
+		t.Fatalf("generateLocked() error = %v", err)
+	}
+	if err := n.generateLocked(ctx, "acme", TriggerRole, generationKey(TriggerRole, "v1/en", "scan at Costco"), generate, store); err != nil {
+		t.Fatalf("generateLocked() error = %v", err)
+	}
+	if calls.Load() != 3 || stored.Load() != 3 {
+		t.Errorf("Expected 3 generations stored, got %d and %d pages stored", calls.Load(), stored.Load())
+	}
+
+	// Another replica holding the lock also skips the generation
+	other := generationKey(TriggerRole, "v1/en", "order at Walmart")
+	fake.Set(tenantKey("acme", "generating:"+other), "token")
+	if err := n.generateLocked(ctx, "acme", TriggerRole, other, generate, store); err != nil || calls.Load() != 3 {
+		t.Errorf("Expected a locked generation to be skipped, got %v", err)
+	}
+}
+
+func TestGenerateLockedStoreFailure(t *testing.T) {
+	fake, rdClient := newFakeRedis(t)
+	n := &Nexus{rdClient: rdClient, generationWindow: time.Minute}
+	ctx := context.Background()
+
+	generate := func(context.Context) ([]model.Page, error) {
+		return []model.Page{{Title: []string{"Fresh Picks"}}}, nil
+	}
+	failed := errors.New("qdrant unavailable")
+	store := func(context.Context, []model.Page) error { return failed }
+
+	// Pages that were never stored don't mark the input generated, so the next request generates it again
+	hash := generationKey(TriggerRole, "v1/en", "snap at Target")
+	if err := n.generateLocked(ctx, "acme", TriggerRole, hash, generate, store); !errors.Is(err, failed) {
+		t.Fatalf("Expected the store error, got %v", err)
+	}
+	if fake.Exists(tenantKey("acme", "generated:"+hash)) {
+		t.Error("Expected the input not marked generated")
+	}
+	if fake.Exists(tenantKey("acme", "generating:"+hash)) {
+		t.Error("Expected the generation lock released")
+	}
+}
@@ -0,0 +1,168 @@
+package nexus
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/qdrant/go-client/qdrant"
+)
+
+// DefaultTenant serves requests that name no tenant and owns all data stored before tenants existed
+const DefaultTenant = "default"
+
+var ErrUnknownTenant = errors.New("unknown tenant")
+
+// ErrInvalidUserId is returned for user IDs that can't be used in storage keys
+var ErrInvalidUserId = errors.New("invalid user ID")
+
+// Tenant names are used in collection names and storage keys
+var tenantPattern = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]{0,62}$`)
+
+// tenantKeyPrefix starts every Redis key of a tenant other than DefaultTenant, followed by the tenant name in braces.
+// No unprefixed key starts with it, so tenants' keys never collide with DefaultTenant's or global keys
+const tenantKeyPrefix = "t:"
+
+// tenantSettings are a tenant's effective settings once its overrides are applied
+type tenantSettings struct {
+	minScore             float32
+	generateChance       float32
+	promptVersions       map[GenerationRole]string
+	blocklist            *safetyRule
+	dailyGenerationLimit int
+}
+
+func newTenantSettings(config TenantConfig, promptVersions map[GenerationRole]string) tenantSettings {
+	settings := tenantSettings{
+		minScore:             MinScore,
+		generateChance:       NewGenerateChance,
+		promptVersions:       make(map[GenerationRole]string, len(llmRoles)),
+		blocklist:            blocklistRule(config.BlockedTerms),
+		dailyGenerationLimit: config.DailyGenerationLimit,
+	}
+	if config.MinScore != nil {
+		settings.minScore = *config.MinScore
+	}
+	if config.GenerateChance != nil {
+		settings.generateChance = *config.GenerateChance
+	}
+	for _, role := range llmRoles {
+		settings.promptVersions[role] = DefaultPromptVersion
+		if version := promptVersions[role]; version != "" {
+			settings.promptVersions[role] = version
+		}
+		if version := config.PromptVersions[role]; version != "" {
+			settings.promptVersions[role] = version
+		}
+	}
+	return settings
+}
+
+// newTenants validates the configured tenants and resolves their settings, always including DefaultTenant.
+// promptVersions are the global prompt versions tenants inherit
+func newTenants(configs map[string]TenantConfig, promptVersions map[GenerationRole]string) (map[string]tenantSettings, error) {
+	tenants := map[string]tenantSettings{
+		DefaultTenant: newTenantSettings(configs[DefaultTenant], promptVersions),
+	}
+	for name, config := range configs {
+		if !tenantPattern.MatchString(name) {
+			return nil, fmt.Errorf("invalid tenant name %q", name)
+		}
+		tenants[name] = newTenantSettings(config, promptVersions)
+	}
+	return tenants, nil
+}
+
+// tenant returns the settings of a configured tenant
+func (n *Nexus) tenant(tenant string) (tenantSettings, error) {
+	settings, ok := n.tenants[tenant]
+	if !ok {
+		return tenantSettings{}, fmt.Errorf("%w: %s", ErrUnknownTenant, tenant)
+	}
+	return settings, nil
+}
+
+// pageCollection returns the collection alias a tenant's pages are stored in
+func (n *Nexus) pageCollection(tenant string) string {
+	if n.isolation != CollectionIsolation || tenant == DefaultTenant {
+		return PageCollection
+	}
+	return PageCollection + "_" + tenant
+}
+
+// pageCollections returns every collection alias pages are stored in
+func (n *Nexus) pageCollections() []string {
+	if n.isolation != CollectionIsolation {
+		return []string{PageCollection}
+	}
+	collections := make([]string, 0, len(n.tenants))
+	for tenant := range n.tenants {
+		collections = append(collections, n.pageCollection(tenant))
+	}
+	return collections
+}
+
+// tenantCondition restricts a query to a tenant's pages, pages stored without a tenant belonging to DefaultTenant
+func tenantCondition(tenant string) *qdrant.Condition {
+	if tenant != DefaultTenant {
+		return qdrant.NewMatchKeyword("tenant", tenant)
+	}
+	return qdrant.NewFilterAsCondition(&qdrant.Filter{
+		Should: []*qdrant.Condition{
+			qdrant.NewMatchKeyword("tenant", tenant),
+			qdrant.NewIsEmpty("tenant"),
+		},
+	})
+}
+
+// validateUserId rejects user IDs containing the Redis key separator, which could otherwise make the legacy bare-ID
+// key of a DefaultTenant user embedding name any other key
+func validateUserId(userId string) error {
+	if strings.Contains(userId, ":") {
+		return fmt.Errorf("%w: %q contains ':'", ErrInvalidUserId, userId)
+	}
+	return nil
+}
+
+// tenantKey prefixes a Redis key with its tenant as t:{tenant}:, DefaultTenant keeping unprefixed keys. The braces also
+// keep a tenant's keys in one Redis Cluster hash slot
+func tenantKey(tenant, key string) string {
+	if tenant == DefaultTenant {
+		return key
+	}
+	return tenantKeyPrefix + "{" + tenant + "}:" + key
+}
+
+// storageTenant is the tenant name used by MongoDB, empty for DefaultTenant so it keeps the unprefixed collection
+func storageTenant(tenant string) string {
+	if tenant == DefaultTenant {
+		return ""
+	}
+	return tenant
+}
+
+// allowGeneration counts a background generation against the tenant's daily limit, reporting whether it is allowed.
+// Refused generations aren't counted
+func (n *Nexus) allowGeneration(ctx context.Context, tenant string, settings tenantSettings) (bool, error) {
+	if settings.dailyGenerationLimit <= 0 {
+		return true, nil
+	}
+
+	key := tenantKey(tenant, "generations:"+time.Now().UTC().Format(time.DateOnly))
+	count, err := n.rdClient.Incr(ctx, key).Result()
+	if err != nil {
+		return false, fmt.Errorf("failed to count generation: %w", err)
+	}
+	if count == 1 {
+		n.rdClient.Expire(ctx, key, 48*time.Hour)
+	}
+	if count > int64(settings.dailyGenerationLimit) {
+		n.rdClient.Decr(ctx, key)
+		return false, nil
+	}
+
+	return true, nil
+}
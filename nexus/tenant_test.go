@@ -0,0 +1,122 @@
+package nexus
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/qdrant/go-client/qdrant"
+	"google.golang.org/protobuf/proto"
+)
+
+func TestTenantKey(t *testing.T) {
+	tests := []struct {
+		tenant, key string
+		want        string
+	}{
+		{DefaultTenant, "embedding:minilm:u1", "embedding:minilm:u1"},
+		{"acme", "embedding:minilm:u1", "t:{acme}:embedding:minilm:u1"},
+		{"acme", "generations:2025-01-01", "t:{acme}:generations:2025-01-01"},
+		{"embedding", "embedding:minilm:u1", "t:{embedding}:embedding:minilm:u1"},
+	}
+	for _, tt := range tests {
+		if got := tenantKey(tt.tenant, tt.key); got != tt.want {
+			t.Errorf("tenantKey(%q, %q) = %q, want %q", tt.tenant, tt.key, got, tt.want)
+		}
+	}
+}
+
+func TestValidateUserId(t *testing.T) {
+	tests := []struct {
+		userId  string
+		invalid bool
+	}{
+		{"u1", false},
+		{"", false},
+		{"acme:u1", true},
+		{"u1:", true},
+	}
+	for _, tt := range tests {
+		err := validateUserId(tt.userId)
+		if invalid := errors.Is(err, ErrInvalidUserId); invalid != tt.invalid {
+			t.Errorf("validateUserId(%q) = %v, want invalid %v", tt.userId, err, tt.invalid)
+		}
+	}
+}
+
+func TestTenantCondition(t *testing.T) {
+	tests := []struct {
+		tenant string
+		want   *qdrant.Condition
+	}{
+		{"acme", qdrant.NewMatchKeyword("tenant", "acme")},
+		{DefaultTenant, qdrant.NewFilterAsCondition(&qdrant.Filter{
+			Should: []*qdrant.Condition{
+				qdrant.NewMatchKeyword("tenant", DefaultTenant),
+				qdrant.NewIsEmpty("tenant"),
+			},
+		})},
+	}
+	for _, tt := range tests {
+		if got := tenantCondition(tt.tenant); !proto.Equal(got, tt.want) {
+			t.Errorf("tenantCondition(%q) = %v, want %v", tt.tenant, got, tt.want)
+		}
+	}
+}
+
+func TestPageCollection(t *testing.T) {
+	tests := []struct {
+		isolation TenantIsolation
+		tenant    string
+		want      string
+	}{
+		{FilterIsolation, DefaultTenant, PageCollection},
+		{FilterIsolation, "acme", PageCollection},
+		{CollectionIsolation, DefaultTenant, PageCollection},
+		{CollectionIsolation, "acme", PageCollection + "_acme"},
+	}
+	for _, tt := range tests {
+		n := &Nexus{isolation: tt.isolation}
+		if got := n.pageCollection(tt.tenant); got != tt.want {
+			t.Errorf("pageCollection(%q) with %s isolation = %q, want %q", tt.tenant, tt.isolation, got, tt.want)
+		}
+	}
+}
+
+func TestNewTenants(t *testing.T) {
+	minScore := float32(0.9)
+	tests := []struct {
+		name    string
+		configs map[string]TenantConfig
+		want    []string
+		wantErr bool
+	}{
+		{name: "default tenant always included", want: []string{DefaultTenant}},
+		{name: "configured tenants", configs: map[string]TenantConfig{"acme": {MinScore: &minScore}, "globex-2": {}}, want: []string{DefaultTenant, "acme", "globex-2"}},
+		{name: "uppercase", configs: map[string]TenantConfig{"Acme": {}}, wantErr: true},
+		{name: "separator", configs: map[string]TenantConfig{"acme:eu": {}}, wantErr: true},
+		{name: "leading underscore", configs: map[string]TenantConfig{"_acme": {}}, wantErr: true},
+		{name: "empty", configs: map[string]TenantConfig{"": {}}, wantErr: true},
+		{name: "named after a Redis key", configs: map[string]TenantConfig{"embedding": {}}, want: []string{DefaultTenant, "embedding"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tenants, err := newTenants(tt.configs, nil)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("newTenants() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if len(tenants) != len(tt.want) {
+				t.Fatalf("newTenants() = %v, want tenants %v", tenants, tt.want)
+			}
+			for _, name := range tt.want {
+				if _, ok := tenants[name]; !ok {
+					t.Errorf("newTenants() is missing tenant %q", name)
+				}
+			}
+		})
+	}
+
+	tenants, _ := newTenants(map[string]TenantConfig{"acme": {MinScore: &minScore}}, nil)
+	if tenants["acme"].minScore != minScore || tenants[DefaultTenant].minScore != MinScore {
+		t.Errorf("Unexpected min scores %v and %v", tenants["acme"].minScore, tenants[DefaultTenant].minScore)
+	}
+}
@@ -0,0 +1,198 @@
+package nexus
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"github.com/dbrun3/nexus-vector/dao"
+	"github.com/dbrun3/nexus-vector/metrics"
+	"github.com/redis/go-redis/v9"
+)
+
+// Trigger embedding cache defaults
+const (
+	DefaultTriggerCacheSize = 10000
+	DefaultTriggerCacheTTL  = 24 * time.Hour
+)
+
+// triggerGenerationKey counts the invalidations of the trigger embedding cache, each replica rereading it every
+// triggerGenerationRefresh so entries cached before a reindex elsewhere are no longer served
+const (
+	triggerGenerationKey     = "trigger_embedding_generation"
+	triggerGenerationRefresh = 30 * time.Second
+)
+
+// Results of a trigger embedding cache lookup
+const (
+	TriggerCacheMemoryHit = "memory_hit"
+	TriggerCacheRedisHit  = "redis_hit"
+	TriggerCacheMiss      = "miss"
+)
+
+// TriggerCacheConfig configures the two-tier cache of trigger embeddings, an in-process LRU in front of Redis shared by
+// every replica, so recurring triggers (same retailer, same redemption) skip TorchServe
+type TriggerCacheConfig struct {
+	Size int           // in-process entries, defaults to DefaultTriggerCacheSize, negative disabling the tier
+	TTL  time.Duration // of Redis entries, defaults to DefaultTriggerCacheTTL, negative disabling the tier
+}
+
+// triggerCache caches trigger embeddings by a hash of their embedding model, its pinned version, the cache generation and
+// cleaned text. Embeddings only depend on the model and text, so entries are shared by every tenant
+type triggerCache struct {
+	memory *lru[string, []float32] // nil when disabled
+	ttl    time.Duration           // 0 when Redis is disabled
+
+	// generation is bumped by every reindex, read from Redis at refreshed (unix nanoseconds)
+	generation atomic.Int64
+	refreshed  atomic.Int64
+}
+
+func newTriggerCache(config TriggerCacheConfig) *triggerCache {
+	c := &triggerCache{}
+	switch {
+	case config.Size == 0:
+		c.memory = newLRU[string, []float32](DefaultTriggerCacheSize)
+	case config.Size > 0:
+		c.memory = newLRU[string, []float32](config.Size)
+	}
+	switch {
+	case config.TTL == 0:
+		c.ttl = DefaultTriggerCacheTTL
+	case config.TTL > 0:
+		c.ttl = config.TTL
+	}
+	return c
+}
+
+// triggerCacheKey hashes an embedding model, its version, the cache generation and a cleaned trigger text
+func triggerCacheKey(embeddingModel, version string, generation int64, text string) string {
+	h := sha256.New()
+	h.Write([]byte(embeddingModel))
+	h.Write([]byte{0})
+	h.Write([]byte(version))
+	h.Write([]byte{0})
+	h.Write([]byte(strconv.FormatInt(generation, 10)))
+	h.Write([]byte{0})
+	h.Write([]byte(text))
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// triggerCacheGeneration returns the current generation of the trigger embedding cache, rereading it from Redis once
+// triggerGenerationRefresh has passed. Redis failures are logged and keep the known generation
+func (n *Nexus) triggerCacheGeneration(ctx context.Context) int64 {
+	cache := n.triggerCache
+	now := time.Now().UnixNano()
+	refreshed := cache.refreshed.Load()
+	if cache.ttl <= 0 || now-refreshed < int64(triggerGenerationRefresh) || !cache.refreshed.CompareAndSwap(refreshed, now) {
+		return cache.generation.Load()
+	}
+
+	value, err := n.rdClient.Get(ctx, triggerGenerationKey).Result()
+	switch {
+	case err == nil:
+		if generation, err := strconv.ParseInt(value, 10, 64); err == nil {
+			cache.generation.Store(generation)
+		}
+	case !errors.Is(err, redis.Nil):
+		log.Printf("Failed to read trigger embedding cache generation: %v", err)
+	}
+	return cache.generation.Load()
+}
+
+// invalidateTriggerCache bumps the generation of the trigger embedding cache so every replica stops serving the
+// embeddings it cached, e.g. once a reindex moved pages to another model version, and clears this replica's entries
+func (n *Nexus) invalidateTriggerCache(ctx context.Context) error {
+	cache := n.triggerCache
+	if cache.memory != nil {
+		cache.memory.clear()
+	}
+	if cache.ttl <= 0 {
+		cache.generation.Add(1)
+		return nil
+	}
+
+	generation, err := n.rdClient.Incr(ctx, triggerGenerationKey).Result()
+	if err != nil {
+		return fmt.Errorf("failed to invalidate trigger embedding cache: %w", err)
+	}
+	cache.generation.Store(generation)
+	cache.refreshed.Store(time.Now().UnixNano())
+	return nil
+}
+
+// modelVersion returns the version an embedding model is pinned to, empty for TorchServe's default version
+func (n *Nexus) modelVersion(embeddingModel string) string {
+	for _, m := range n.models {
+		if m.Name == embeddingModel {
+			return m.Version.Version
+		}
+	}
+	return ""
+}
+
+// triggerEmbedding returns the embedding of a cleaned trigger text for one embedding model, from the in-process cache,
+// then Redis and then TorchServe. Redis failures are logged and treated as misses. The returned embedding is shared and
+// must not be modified
+func (n *Nexus) triggerEmbedding(ctx context.Context, embeddingModel, text string) ([]float32, error) {
+	key := triggerCacheKey(embeddingModel, n.modelVersion(embeddingModel), n.triggerCacheGeneration(ctx), text)
+	cache := n.triggerCache
+
+	if cache.memory != nil {
+		if embedding, ok := cache.memory.get(key); ok {
+			metrics.TriggerEmbeddingCache.WithLabelValues(embeddingModel, TriggerCacheMemoryHit).Inc()
+			return embedding, nil
+		}
+	}
+
+	redisKey := "trigger_embedding:" + key
+	if cache.ttl > 0 {
+		value, err := n.rdClient.Get(ctx, redisKey).Result()
+		if err == nil {
+			embedding, err := dao.EmbeddingFromRedis(value)
+			if err == nil {
+				embedding, err = n.validateEmbedding(embeddingModel, EmbeddingFromRedis, embedding)
+			}
+			if err == nil {
+				metrics.TriggerEmbeddingCache.WithLabelValues(embeddingModel, TriggerCacheRedisHit).Inc()
+				if cache.memory != nil {
+					cache.memory.add(key, embedding)
+				}
+				return embedding, nil
+			}
+			log.Printf("Invalid cached trigger embedding %s: %v", redisKey, err)
+		} else if !errors.Is(err, redis.Nil) {
+			log.Printf("Failed to read cached trigger embedding: %v", err)
+		}
+	}
+
+	metrics.TriggerEmbeddingCache.WithLabelValues(embeddingModel, TriggerCacheMiss).Inc()
+	embeddings, err := n.embedTexts(ctx, embeddingModel, text)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create trigger embedding: %w", err)
+	}
+	embedding := embeddings[0]
+
+	if cache.memory != nil {
+		cache.memory.add(key, embedding)
+	}
+	if cache.ttl > 0 {
+		// Stored in the background so the request doesn't wait for Redis
+		go func() {
+			value, err := dao.EmbeddingToRedis(embedding, n.encoding)
+			if err == nil {
+				err = n.rdClient.Set(context.Background(), redisKey, value, cache.ttl).Err()
+			}
+			if err != nil {
+				log.Printf("Failed to cache trigger embedding: %v", err)
+			}
+		}()
+	}
+	return embedding, nil
+}
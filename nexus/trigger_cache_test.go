@@ -0,0 +1,100 @@
+package nexus
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/dbrun3/nexus-vector/dao"
+)
+
+func TestTriggerEmbedding(t *testing.T) {
+	ctx := context.Background()
+	n, fake, embedded := newFakeNexus(t)
+
+	redisKey := func(text string) string {
+		return "trigger_embedding:" + triggerCacheKey("minilm", "", n.triggerCache.generation.Load(), text)
+	}
+	// Entries are stored in Redis in the background
+	waitStored := func(text string) string {
+		t.Helper()
+		for range 100 {
+			if value, err := fake.Get(redisKey(text)); err == nil {
+				return value
+			}
+			time.Sleep(5 * time.Millisecond)
+		}
+		t.Fatalf("Embedding of %q was not cached in Redis", text)
+		return ""
+	}
+
+	// Miss, then memory hit
+	embedding, err := n.triggerEmbedding(ctx, "minilm", "snap")
+	if err != nil || embedding[0] != 4 || embedded.Load() != 1 {
+		t.Fatalf("triggerEmbedding() = %v, %v after %d predictions", embedding, err, embedded.Load())
+	}
+	waitStored("snap")
+	if _, err := n.triggerEmbedding(ctx, "minilm", "snap"); err != nil || embedded.Load() != 1 {
+		t.Fatalf("Expected a memory hit, got %v after %d predictions", err, embedded.Load())
+	}
+
+	// Redis hit once the memory tier lost it, e.g. on another replica
+	n.triggerCache.memory.clear()
+	if embedding, err := n.triggerEmbedding(ctx, "minilm", "snap"); err != nil || embedding[0] != 4 || embedded.Load() != 1 {
+		t.Fatalf("Expected a Redis hit, got %v, %v after %d predictions", embedding, err, embedded.Load())
+	}
+
+	// Invalid cached values are recomputed and replaced
+	invalid, _ := dao.EmbeddingToRedis([]float32{1, 2}, dao.Float32Encoding)
+	fake.Set(redisKey("redeem"), invalid)
+	embedding, err = n.triggerEmbedding(ctx, "minilm", "redeem")
+	if err != nil || len(embedding) != 3 || embedding[0] != 6 || embedded.Load() != 2 {
+		t.Fatalf("Expected the invalid entry recomputed, got %v, %v after %d predictions", embedding, err, embedded.Load())
+	}
+	for range 100 {
+		if value, _ := fake.Get(redisKey("redeem")); value != invalid {
+			break
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	if value, _ := fake.Get(redisKey("redeem")); value == invalid {
+		t.Error("Expected the invalid entry replaced in Redis")
+	}
+}
+
+func TestInvalidateTriggerCache(t *testing.T) {
+	ctx := context.Background()
+	n, _, embedded := newFakeNexus(t)
+
+	if _, err := n.triggerEmbedding(ctx, "minilm", "snap"); err != nil {
+		t.Fatalf("triggerEmbedding() error = %v", err)
+	}
+	if err := n.invalidateTriggerCache(ctx); err != nil {
+		t.Fatalf("invalidateTriggerCache() error = %v", err)
+	}
+	if _, err := n.triggerEmbedding(ctx, "minilm", "snap"); err != nil || embedded.Load() != 2 {
+		t.Fatalf("Expected the embedding recomputed after invalidation, got %v after %d predictions", err, embedded.Load())
+	}
+
+	// Another replica picks the new generation up from Redis once it refreshes it
+	other, _, _ := newFakeNexus(t)
+	other.rdClient = n.rdClient
+	other.triggerCache.refreshed.Store(time.Now().Add(-triggerGenerationRefresh).UnixNano())
+	if generation := other.triggerCacheGeneration(ctx); generation != 1 {
+		t.Errorf("Expected generation 1 read from Redis, got %d", generation)
+	}
+}
+
+func TestTriggerEmbeddingVersionedKey(t *testing.T) {
+	ctx := context.Background()
+	n, _, embedded := newFakeNexus(t)
+
+	if _, err := n.triggerEmbedding(ctx, "minilm", "snap"); err != nil {
+		t.Fatalf("triggerEmbedding() error = %v", err)
+	}
+	// Pinning another version doesn't serve embeddings of the previous one
+	n.models[0].Version.Version = "2.0"
+	if _, err := n.triggerEmbedding(ctx, "minilm", "snap"); err != nil || embedded.Load() != 2 {
+		t.Fatalf("Expected a miss for the new version, got %v after %d predictions", err, embedded.Load())
+	}
+}
@@ -0,0 +1,320 @@
+package nexus
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strconv"
+	"time"
+
+	"github.com/dbrun3/nexus-vector/metrics"
+	"github.com/openai/openai-go/v2"
+	"github.com/redis/go-redis/v9"
+)
+
+// UsageRetention is how long daily LLM usage is kept in Redis
+const UsageRetention = 35 * 24 * time.Hour
+
+// GenerationLimits bound background generation, zero values being unlimited. Rates count chat completion requests
+// (retries included) per minute across every replica, budgets count every tenant's usage per UTC day
+type GenerationLimits struct {
+	GlobalRPM        int
+	UserRPM          int
+	DailyTokenBudget int64
+	DailyCostBudget  float64 // USD
+}
+
+// Reasons a background generation is skipped
+const (
+	SkipTenantLimit     = "tenant_limit"
+	SkipGlobalRateLimit = "global_rate_limit"
+	SkipUserRateLimit   = "user_rate_limit"
+	SkipBudget          = "budget"
+	SkipCircuitOpen     = "circuit_open"
+)
+
+// ErrRateLimited is returned for chat completion requests over a rate limit
+var ErrRateLimited = errors.New("LLM rate limit reached")
+
+// ErrBudgetExceeded is returned for chat completion requests made once the daily budget is spent
+var ErrBudgetExceeded = errors.New("LLM budget spent")
+
+// Usage is a day's LLM usage of one tenant and generation role
+type Usage struct {
+	Tenant           string         `json:"tenant"`
+	Role             GenerationRole `json:"role"`
+	Requests         int64          `json:"requests"`
+	PromptTokens     int64          `json:"prompt_tokens"`
+	CompletionTokens int64          `json:"completion_tokens"`
+	CostUSD          float64        `json:"cost_usd"`
+}
+
+// GenerationStatus reports a day's LLM usage against the generation budget
+type GenerationStatus struct {
+	Day            string  `json:"day"`
+	Paused         bool    `json:"paused"`
+	PauseReason    string  `json:"pause_reason,omitempty"`
+	TokensUsed     int64   `json:"tokens_used"`
+	TokenBudget    int64   `json:"token_budget,omitempty"`
+	CostUsedUSD    float64 `json:"cost_used_usd"`
+	CostBudgetUSD  float64 `json:"cost_budget_usd,omitempty"`
+	GlobalRPMLimit int     `json:"global_rpm_limit,omitempty"`
+	UserRPMLimit   int     `json:"user_rpm_limit,omitempty"`
+	Usage          []Usage `json:"usage"`
+}
+
+func usageDay(t time.Time) string {
+	return t.UTC().Format(time.DateOnly)
+}
+
+// usageKey is the Redis hash of a tenant's LLM usage on a day, with one field per generation role and measure
+func usageKey(tenant, day string) string {
+	return tenantKey(tenant, "llm_usage:"+day)
+}
+
+// budgetKey is the Redis hash of every tenant's LLM usage on a day, counted against the daily budget
+func budgetKey(day string) string {
+	return "llm_budget:" + day
+}
+
+// recordUsage records the token usage and estimated cost of a chat completion
+func (n *Nexus) recordUsage(ctx context.Context, tenant string, role GenerationRole, g *generator, usage openai.CompletionUsage) error {
+	cost := float64(usage.PromptTokens)*g.inputCost + float64(usage.CompletionTokens)*g.outputCost
+	costMicros := int64(cost * 1e6)
+
+	metrics.LLMRequests.WithLabelValues(tenant, string(role)).Inc()
+	metrics.LLMTokens.WithLabelValues(tenant, string(role), "prompt").Add(float64(usage.PromptTokens))
+	metrics.LLMTokens.WithLabelValues(tenant, string(role), "completion").Add(float64(usage.CompletionTokens))
+	metrics.LLMCost.WithLabelValues(tenant, string(role)).Add(cost)
+
+	day := usageDay(time.Now())
+	prefix := string(role) + ":"
+	_, err := n.rdClient.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		key := usageKey(tenant, day)
+		pipe.HIncrBy(ctx, key, prefix+"requests", 1)
+		pipe.HIncrBy(ctx, key, prefix+"prompt_tokens", usage.PromptTokens)
+		pipe.HIncrBy(ctx, key, prefix+"completion_tokens", usage.CompletionTokens)
+		pipe.HIncrBy(ctx, key, prefix+"cost_micros", costMicros)
+		pipe.Expire(ctx, key, UsageRetention)
+
+		pipe.HIncrBy(ctx, budgetKey(day), "tokens", usage.TotalTokens)
+		pipe.HIncrBy(ctx, budgetKey(day), "cost_micros", costMicros)
+		pipe.Expire(ctx, budgetKey(day), UsageRetention)
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("failed to record LLM usage: %w", err)
+	}
+	return nil
+}
+
+// budgetExceeded reports why the day's generation budget is spent, or "" while generation may continue
+func (n *Nexus) budgetExceeded(tokens int64, costMicros int64) string {
+	if n.limits.DailyTokenBudget > 0 && tokens >= n.limits.DailyTokenBudget {
+		return fmt.Sprintf("daily token budget of %d spent", n.limits.DailyTokenBudget)
+	}
+	if n.limits.DailyCostBudget > 0 && float64(costMicros)/1e6 >= n.limits.DailyCostBudget {
+		return fmt.Sprintf("daily cost budget of $%.2f spent", n.limits.DailyCostBudget)
+	}
+	return ""
+}
+
+// budgetUsed reads every tenant's token and cost usage on a day
+func (n *Nexus) budgetUsed(ctx context.Context, day string) (int64, int64, error) {
+	values, err := n.rdClient.HMGet(ctx, budgetKey(day), "tokens", "cost_micros").Result()
+	if err != nil {
+		return 0, 0, fmt.Errorf("failed to read LLM budget: %w", err)
+	}
+	return hashInt(values[0]), hashInt(values[1]), nil
+}
+
+// spentBudget reports why today's generation budget is spent, or "" while generation may continue, pausing
+// generation accordingly
+func (n *Nexus) spentBudget(ctx context.Context) (string, error) {
+	if n.limits.DailyTokenBudget <= 0 && n.limits.DailyCostBudget <= 0 {
+		return "", nil
+	}
+	tokens, costMicros, err := n.budgetUsed(ctx, usageDay(time.Now()))
+	if err != nil {
+		return "", err
+	}
+	reason := n.budgetExceeded(tokens, costMicros)
+	n.setPaused(reason)
+	return reason, nil
+}
+
+// reserveGeneration checks the circuit breakers, budget, rate limits and tenant's daily limit before a background
+// generation, returning the reason it must be skipped or "" if it may go ahead. Only an allowed generation is counted
+// against the tenant's daily limit, its chat completion requests being counted by reserveRequest as they are made
+func (n *Nexus) reserveGeneration(ctx context.Context, tenant, userId string, settings tenantSettings) (string, error) {
+	if n.generationBlocked() {
+		return SkipCircuitOpen, nil
+	}
+
+	if reason, err := n.spentBudget(ctx); err != nil || reason != "" {
+		return SkipBudget, err
+	}
+
+	// Skip generations whose first request would already be rate limited
+	for _, window := range n.rateWindows(tenant, userId) {
+		count, err := n.rdClient.Get(ctx, window.key).Int64()
+		if err != nil && !errors.Is(err, redis.Nil) {
+			return "", fmt.Errorf("failed to read LLM requests: %w", err)
+		}
+		if count >= int64(window.limit) {
+			return window.skip, nil
+		}
+	}
+
+	allowed, err := n.allowGeneration(ctx, tenant, settings)
+	if err != nil {
+		return "", err
+	}
+	if !allowed {
+		return SkipTenantLimit, nil
+	}
+
+	return "", nil
+}
+
+// rateWindow is the current one minute window of a rate limit
+type rateWindow struct {
+	key   string
+	limit int
+	skip  string
+}
+
+// rateWindows returns the current windows of the configured rate limits, userId's only when it is set
+func (n *Nexus) rateWindows(tenant, userId string) []rateWindow {
+	minute := strconv.FormatInt(time.Now().Unix()/60, 10)
+	var windows []rateWindow
+	if n.limits.GlobalRPM > 0 {
+		windows = append(windows, rateWindow{"llm_rate:" + minute, n.limits.GlobalRPM, SkipGlobalRateLimit})
+	}
+	if n.limits.UserRPM > 0 && userId != "" {
+		windows = append(windows, rateWindow{tenantKey(tenant, "llm_rate:"+userId+":"+minute), n.limits.UserRPM, SkipUserRateLimit})
+	}
+	return windows
+}
+
+// reserveRequest counts a chat completion request made for a tenant's user against the rate limits, returning
+// ErrBudgetExceeded once today's budget is spent, or ErrRateLimited without counting it in any window when one is full
+func (n *Nexus) reserveRequest(ctx context.Context, tenant, userId string) error {
+	reason, err := n.spentBudget(ctx)
+	if err != nil {
+		return err
+	}
+	if reason != "" {
+		return fmt.Errorf("%w: %s", ErrBudgetExceeded, reason)
+	}
+
+	windows := n.rateWindows(tenant, userId)
+	for i, window := range windows {
+		ok, err := n.countRate(ctx, window.key, window.limit)
+		if err == nil && ok {
+			continue
+		}
+		for _, counted := range windows[:i] {
+			n.rdClient.Decr(ctx, counted.key)
+		}
+		if err != nil {
+			return err
+		}
+		return fmt.Errorf("%w: %s", ErrRateLimited, window.skip)
+	}
+	return nil
+}
+
+// countRate counts a request in a one minute window, reporting whether it fits within limit. Requests that don't fit
+// aren't counted
+func (n *Nexus) countRate(ctx context.Context, key string, limit int) (bool, error) {
+	count, err := n.rdClient.Incr(ctx, key).Result()
+	if err != nil {
+		return false, fmt.Errorf("failed to count LLM requests: %w", err)
+	}
+	if count == 1 {
+		n.rdClient.Expire(ctx, key, 2*time.Minute)
+	}
+	if count > int64(limit) {
+		n.rdClient.Decr(ctx, key)
+		return false, nil
+	}
+	return true, nil
+}
+
+// GenerationStatus returns the LLM usage of every tenant and generation role on a day (YYYY-MM-DD, today when empty)
+// and whether generation is paused
+func (n *Nexus) GenerationStatus(ctx context.Context, day string) (*GenerationStatus, error) {
+	if day == "" {
+		day = usageDay(time.Now())
+	}
+	if _, err := time.Parse(time.DateOnly, day); err != nil {
+		return nil, fmt.Errorf("invalid day %q, expected YYYY-MM-DD", day)
+	}
+
+	tokens, costMicros, err := n.budgetUsed(ctx, day)
+	if err != nil {
+		return nil, err
+	}
+	status := &GenerationStatus{
+		Day:            day,
+		PauseReason:    n.budgetExceeded(tokens, costMicros),
+		TokensUsed:     tokens,
+		TokenBudget:    n.limits.DailyTokenBudget,
+		CostUsedUSD:    float64(costMicros) / 1e6,
+		CostBudgetUSD:  n.limits.DailyCostBudget,
+		GlobalRPMLimit: n.limits.GlobalRPM,
+		UserRPMLimit:   n.limits.UserRPM,
+		Usage:          []Usage{},
+	}
+	status.Paused = status.PauseReason != ""
+	if day == usageDay(time.Now()) {
+		n.setPaused(status.PauseReason)
+	}
+
+	for tenant := range n.tenants {
+		fields, err := n.rdClient.HGetAll(ctx, usageKey(tenant, day)).Result()
+		if err != nil {
+			return nil, fmt.Errorf("failed to read LLM usage: %w", err)
+		}
+		for _, role := range usageRoles {
+			prefix := string(role) + ":"
+			usage := Usage{
+				Tenant:           tenant,
+				Role:             role,
+				Requests:         hashInt(fields[prefix+"requests"]),
+				PromptTokens:     hashInt(fields[prefix+"prompt_tokens"]),
+				CompletionTokens: hashInt(fields[prefix+"completion_tokens"]),
+				CostUSD:          float64(hashInt(fields[prefix+"cost_micros"])) / 1e6,
+			}
+			if usage.Requests > 0 {
+				status.Usage = append(status.Usage, usage)
+			}
+		}
+	}
+
+	return status, nil
+}
+
+// setPaused records whether generation is paused for the given reason ("" when it is not), logging changes
+func (n *Nexus) setPaused(reason string) {
+	paused := reason != ""
+	if n.paused.Swap(paused) == paused {
+		return
+	}
+	if paused {
+		metrics.GenerationPaused.Set(1)
+		log.Printf("Background: Generation paused, %s", reason)
+	} else {
+		metrics.GenerationPaused.Set(0)
+		log.Printf("Background: Generation resumed")
+	}
+}
+
+// hashInt parses an integer Redis hash value, missing values being 0
+func hashInt(value any) int64 {
+	s, _ := value.(string)
+	i, _ := strconv.ParseInt(s, 10, 64)
+	return i
+}
@@ -0,0 +1,104 @@
+package nexus
+
+import (
+	"context"
+	"errors"
+	"github.com/alicebob/miniredis/v2"
+	"testing"
+	"time"
+)
+
+// newUsageNexus returns a Nexus with the given limits and a fake Redis
+func newUsageNexus(t *testing.T, limits GenerationLimits) (*Nexus, *miniredis.Miniredis) {
+	t.Helper()
+	generators, err := newGenerators(&Config{LLM: ProviderConfig{BaseURL: "http://127.0.0.1:1", APIKey: "test"}})
+	if err != nil {
+		t.Fatalf("newGenerators() error = %v", err)
+	}
+	fake, rdClient := newFakeRedis(t)
+	return &Nexus{generators: generators, rdClient: rdClient, limits: limits}, fake
+}
+
+func TestReserveRequestRateLimits(t *testing.T) {
+	n, fake := newUsageNexus(t, GenerationLimits{GlobalRPM: 3, UserRPM: 2})
+	ctx := context.Background()
+
+	for range 2 {
+		if err := n.reserveRequest(ctx, "acme", "u1"); err != nil {
+			t.Fatalf("reserveRequest() error = %v", err)
+		}
+	}
+	// u1's window is full, and the request isn't counted in the global one either
+	if err := n.reserveRequest(ctx, "acme", "u1"); !errors.Is(err, ErrRateLimited) {
+		t.Fatalf("Expected u1 to be rate limited, got %v", err)
+	}
+	windows := n.rateWindows("acme", "u1")
+	if count, _ := fake.Get(windows[0].key); count != "2" {
+		t.Errorf("Expected 2 requests in the global window, got %s", count)
+	}
+
+	if err := n.reserveRequest(ctx, "acme", "u2"); err != nil {
+		t.Fatalf("reserveRequest() error = %v", err)
+	}
+	err := n.reserveRequest(ctx, "acme", "u2")
+	if !errors.Is(err, ErrRateLimited) {
+		t.Fatalf("Expected the global rate limit, got %v", err)
+	}
+	if count, _ := fake.Get(n.rateWindows("acme", "u2")[1].key); count != "1" {
+		t.Errorf("Expected 1 request in u2's window, got %s", count)
+	}
+
+	// A full window skips a generation without counting anything
+	skip, err := n.reserveGeneration(ctx, "acme", "u3", tenantSettings{dailyGenerationLimit: 5})
+	if err != nil || skip != SkipGlobalRateLimit {
+		t.Fatalf("reserveGeneration() = %q, %v, expected %q", skip, err, SkipGlobalRateLimit)
+	}
+	if fake.Exists(tenantKey("acme", "generations:"+usageDay(time.Now()))) {
+		t.Error("Expected a skipped generation not to count against the tenant's daily limit")
+	}
+}
+
+func TestReserveGenerationBudget(t *testing.T) {
+	n, fake := newUsageNexus(t, GenerationLimits{DailyTokenBudget: 1000})
+	ctx := context.Background()
+
+	if skip, err := n.reserveGeneration(ctx, DefaultTenant, "u1", tenantSettings{}); err != nil || skip != "" {
+		t.Fatalf("reserveGeneration() = %q, %v, expected no skip", skip, err)
+	}
+
+	fake.HSet(budgetKey(usageDay(time.Now())), "tokens", "1000")
+	if skip, err := n.reserveGeneration(ctx, DefaultTenant, "u1", tenantSettings{}); err != nil || skip != SkipBudget {
+		t.Fatalf("reserveGeneration() = %q, %v, expected %q", skip, err, SkipBudget)
+	}
+	if !n.paused.Load() {
+		t.Error("Expected generation to be paused once the budget is spent")
+	}
+
+	// Requests of generations already running stop too
+	if err := n.reserveRequest(ctx, DefaultTenant, "u1"); !errors.Is(err, ErrBudgetExceeded) {
+		t.Errorf("Expected ErrBudgetExceeded, got %v", err)
+	}
+}
+
+func TestReserveGenerationTenantLimit(t *testing.T) {
+	n, fake := newUsageNexus(t, GenerationLimits{})
+	ctx := context.Background()
+	settings := tenantSettings{dailyGenerationLimit: 2}
+
+	for range 2 {
+		if skip, err := n.reserveGeneration(ctx, "acme", "u1", settings); err != nil || skip != "" {
+			t.Fatalf("reserveGeneration() = %q, %v, expected no skip", skip, err)
+		}
+	}
+	if skip, err := n.reserveGeneration(ctx, "acme", "u1", settings); err != nil || skip != SkipTenantLimit {
+		t.Fatalf("reserveGeneration() = %q, %v, expected %q", skip, err, SkipTenantLimit)
+	}
+	if count, _ := fake.Get(tenantKey("acme", "generations:"+usageDay(time.Now()))); count != "2" {
+		t.Errorf("Expected 2 generations counted, got %s", count)
+	}
+
+	// Other tenants have their own limit
+	if skip, err := n.reserveGeneration(ctx, DefaultTenant, "u1", settings); err != nil || skip != "" {
+		t.Fatalf("reserveGeneration() = %q, %v, expected no skip", skip, err)
+	}
+}
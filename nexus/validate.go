@@ -0,0 +1,129 @@
+package nexus
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+
+	"github.com/dbrun3/nexus-vector/metrics"
+)
+
+// Kinds of invalid embeddings
+const (
+	InvalidDimension = "dimension" // not the embedding model's dimension
+	InvalidNaN       = "nan"
+	InvalidInf       = "inf"
+	InvalidZero      = "zero" // all zeros, which has no direction to normalize
+)
+
+// Origins of validated embeddings
+const (
+	EmbeddingFromTorchServe = "torchserve"
+	EmbeddingFromRedis      = "redis"
+)
+
+// ErrInvalidEmbedding is matched by every *EmbeddingError
+var ErrInvalidEmbedding = errors.New("invalid embedding")
+
+// EmbeddingError reports an embedding rejected before it could be stored or queried, e.g. from a bad model deploy
+type EmbeddingError struct {
+	Model  string
+	Origin string // EmbeddingFromTorchServe or EmbeddingFromRedis
+	Kind   string // InvalidDimension, InvalidNaN, InvalidInf or InvalidZero
+	Index  int    // of the offending value, or the embedding's dimension for InvalidDimension
+}
+
+func (e *EmbeddingError) Error() string {
+	if e.Kind == InvalidDimension {
+		return fmt.Sprintf("invalid embedding from %s for model %s: %d dimensions", e.Origin, e.Model, e.Index)
+	}
+	return fmt.Sprintf("invalid embedding from %s for model %s: %s at index %d", e.Origin, e.Model, e.Kind, e.Index)
+}
+
+func (e *EmbeddingError) Is(target error) bool {
+	return target == ErrInvalidEmbedding
+}
+
+// validateEmbedding checks an embedding has its model's dimension and only finite values, counting rejections by kind.
+// With normalization enabled, a unit length copy is returned
+func (n *Nexus) validateEmbedding(embeddingModel, origin string, embedding []float32) ([]float32, error) {
+	err := checkEmbedding(embedding, n.dimension(embeddingModel), n.normalize)
+	if err != nil {
+		err.Model = embeddingModel
+		err.Origin = origin
+		metrics.InvalidEmbeddings.WithLabelValues(embeddingModel, origin, err.Kind).Inc()
+		return nil, err
+	}
+
+	if n.normalize {
+		return normalizeEmbedding(embedding), nil
+	}
+	return embedding, nil
+}
+
+// checkEmbedding checks an embedding's dimension and values, rejecting all zeros when it is to be normalized
+func checkEmbedding(embedding []float32, dimension uint64, normalize bool) *EmbeddingError {
+	if uint64(len(embedding)) != dimension {
+		return &EmbeddingError{Kind: InvalidDimension, Index: len(embedding)}
+	}
+
+	zero := true
+	for i, v := range embedding {
+		switch {
+		case math.IsNaN(float64(v)):
+			return &EmbeddingError{Kind: InvalidNaN, Index: i}
+		case math.IsInf(float64(v), 0):
+			return &EmbeddingError{Kind: InvalidInf, Index: i}
+		case v != 0:
+			zero = false
+		}
+	}
+	if normalize && zero {
+		return &EmbeddingError{Kind: InvalidZero}
+	}
+	return nil
+}
+
+// normalizeEmbedding returns a unit length copy of a non-zero embedding
+func normalizeEmbedding(embedding []float32) []float32 {
+	var norm float64
+	for _, v := range embedding {
+		norm += float64(v) * float64(v)
+	}
+	norm = math.Sqrt(norm)
+
+	normalized := make([]float32, len(embedding))
+	for i, v := range embedding {
+		normalized[i] = float32(float64(v) / norm)
+	}
+	return normalized
+}
+
+// dimension returns the dimension of a configured embedding model
+func (n *Nexus) dimension(embeddingModel string) uint64 {
+	for _, m := range n.models {
+		if m.Name == embeddingModel {
+			return m.Dimension
+		}
+	}
+	return 0
+}
+
+// embedTexts embeds texts with one embedding model, validating every embedding TorchServe returns
+func (n *Nexus) embedTexts(ctx context.Context, embeddingModel string, texts ...string) ([][]float32, error) {
+	embeddings, err := n.embedders[embeddingModel].TextToEmbeddings(ctx, texts...)
+	if err != nil {
+		return nil, err
+	}
+	if len(embeddings) != len(texts) {
+		return nil, fmt.Errorf("invalid number of embeddings returned: expected %d, got %d", len(texts), len(embeddings))
+	}
+
+	for i := range embeddings {
+		if embeddings[i], err = n.validateEmbedding(embeddingModel, EmbeddingFromTorchServe, embeddings[i]); err != nil {
+			return nil, err
+		}
+	}
+	return embeddings, nil
+}
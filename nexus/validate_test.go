@@ -0,0 +1,58 @@
+package nexus
+
+import (
+	"errors"
+	"math"
+	"testing"
+)
+
+func TestValidateEmbedding(t *testing.T) {
+	nan := float32(math.NaN())
+	inf := float32(math.Inf(1))
+
+	tests := []struct {
+		name      string
+		embedding []float32
+		normalize bool
+		kind      string // of the expected EmbeddingError, none when empty
+		index     int
+		expected  []float32
+	}{
+		{name: "valid", embedding: []float32{3, 4, 0}, expected: []float32{3, 4, 0}},
+		{name: "normalized", embedding: []float32{3, 4, 0}, normalize: true, expected: []float32{0.6, 0.8, 0}},
+		{name: "too short", embedding: []float32{1, 0}, kind: InvalidDimension, index: 2},
+		{name: "too long", embedding: []float32{1, 0, 0, 0}, kind: InvalidDimension, index: 4},
+		{name: "NaN", embedding: []float32{1, nan, 0}, kind: InvalidNaN, index: 1},
+		{name: "Inf", embedding: []float32{1, 0, -inf}, kind: InvalidInf, index: 2},
+		{name: "zeros kept without normalization", embedding: []float32{0, 0, 0}, expected: []float32{0, 0, 0}},
+		{name: "zeros rejected with normalization", embedding: []float32{0, 0, 0}, normalize: true, kind: InvalidZero},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			n := &Nexus{models: []EmbeddingModel{{Name: "minilm", Dimension: 3}}, normalize: tt.normalize}
+			embedding, err := n.validateEmbedding("minilm", EmbeddingFromTorchServe, tt.embedding)
+
+			if tt.kind != "" {
+				var embeddingErr *EmbeddingError
+				if !errors.As(err, &embeddingErr) || !errors.Is(err, ErrInvalidEmbedding) {
+					t.Fatalf("validateEmbedding() error = %v, expected an EmbeddingError", err)
+				}
+				if embeddingErr.Kind != tt.kind || embeddingErr.Index != tt.index || embeddingErr.Model != "minilm" {
+					t.Errorf("validateEmbedding() error = %+v, expected kind %s at %d", embeddingErr, tt.kind, tt.index)
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("validateEmbedding() error = %v", err)
+			}
+			for i := range tt.expected {
+				if math.Abs(float64(embedding[i]-tt.expected[i])) > 1e-6 {
+					t.Errorf("validateEmbedding() = %v, expected %v", embedding, tt.expected)
+					break
+				}
+			}
+		})
+	}
+}
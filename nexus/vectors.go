@@ -0,0 +1,110 @@
+package nexus
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/dbrun3/nexus-vector/qdrant_util"
+	"github.com/qdrant/go-client/qdrant"
+)
+
+// VectorSchemaRefresh is how long the vectors a page collection stores are reused before being read again, so a reindex
+// run by another replica is picked up
+const VectorSchemaRefresh = time.Minute
+
+// ErrModelNotIndexed is returned for requests naming an embedding model a page collection has no vectors for yet
+var ErrModelNotIndexed = errors.New("embedding model not indexed")
+
+// vectorSchemas caches the named vectors (name -> size) of every page collection alias, empty for a legacy collection
+// of unnamed vectors
+type vectorSchemas struct {
+	mu      sync.RWMutex
+	schemas map[string]vectorSchema
+}
+
+type vectorSchema struct {
+	names  map[string]uint64
+	readAt time.Time
+}
+
+// vectorSchema returns the named vectors of a page collection alias, reading them from Qdrant when not read recently
+func (n *Nexus) vectorSchema(ctx context.Context, collection string) (map[string]uint64, error) {
+	n.vectors.mu.RLock()
+	schema, ok := n.vectors.schemas[collection]
+	n.vectors.mu.RUnlock()
+	if ok && time.Since(schema.readAt) < VectorSchemaRefresh {
+		return schema.names, nil
+	}
+
+	names, err := qdrant_util.VectorNames(ctx, n.qdClient, collection)
+	if err != nil {
+		// A stale schema still serves while Qdrant can't be asked
+		if ok {
+			return schema.names, nil
+		}
+		return nil, err
+	}
+	n.setVectorSchema(collection, names)
+	return names, nil
+}
+
+// setVectorSchema records the named vectors of a page collection alias
+func (n *Nexus) setVectorSchema(collection string, names map[string]uint64) {
+	n.vectors.mu.Lock()
+	defer n.vectors.mu.Unlock()
+	if n.vectors.schemas == nil {
+		n.vectors.schemas = make(map[string]vectorSchema)
+	}
+	n.vectors.schemas[collection] = vectorSchema{names: names, readAt: time.Now()}
+}
+
+// vectorName returns the vector an embedding model is stored under in a collection with the given named vectors, ""
+// being the unnamed vector of a legacy collection, which holds the default model's embeddings. ok is false when the
+// collection has no vector for the model
+func (n *Nexus) vectorName(names map[string]uint64, embeddingModel string) (string, bool) {
+	if len(names) == 0 {
+		return "", embeddingModel == n.models[0].Name
+	}
+	_, ok := names[embeddingModel]
+	return embeddingModel, ok
+}
+
+// collectionVector returns the vector an embedding model is queried with in a tenant's page collection
+func (n *Nexus) collectionVector(ctx context.Context, tenant, embeddingModel string) (string, error) {
+	collection := n.pageCollection(tenant)
+	names, err := n.vectorSchema(ctx, collection)
+	if err != nil {
+		return "", err
+	}
+	vector, ok := n.vectorName(names, embeddingModel)
+	if !ok {
+		return "", fmt.Errorf("%w: %s has no vectors for %s, run POST /admin/reindex", ErrModelNotIndexed, collection, embeddingModel)
+	}
+	return vector, nil
+}
+
+// pointVectors returns the vectors of a page stored in a collection with the given named vectors, keeping only the
+// embeddings the collection has a vector for
+func (n *Nexus) pointVectors(names map[string]uint64, embeddings map[string][]float32) (*qdrant.Vectors, error) {
+	if len(names) == 0 {
+		embedding, ok := embeddings[n.models[0].Name]
+		if !ok {
+			return nil, fmt.Errorf("%w: no %s embedding for a collection of unnamed vectors", ErrModelNotIndexed, n.models[0].Name)
+		}
+		return qdrant.NewVectors(embedding...), nil
+	}
+
+	vectors := make(map[string]*qdrant.Vector, len(embeddings))
+	for name, embedding := range embeddings {
+		if _, ok := names[name]; ok {
+			vectors[name] = qdrant.NewVector(embedding...)
+		}
+	}
+	if len(vectors) == 0 {
+		return nil, fmt.Errorf("%w: the collection has no vector for any of the page's embeddings", ErrModelNotIndexed)
+	}
+	return qdrant.NewVectorsMap(vectors), nil
+}
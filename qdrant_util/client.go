@@ -3,17 +3,15 @@ package qdrant_util
 import (
 	"context"
 	"fmt"
+	"time"
 
 	"github.com/qdrant/go-client/qdrant"
 )
 
 func NewClient(ctx context.Context, host string, collection string, vectorSize uint64) (*qdrant.Client, error) {
-	// setup qdrant
-	qdClient, err := qdrant.NewClient(&qdrant.Config{
-		Host: host,
-	})
+	qdClient, err := connect(ctx, host)
 	if err != nil {
-		return nil, fmt.Errorf("failed to create Qdrant client: %w", err)
+		return nil, err
 	}
 
 	// check/init qdrant collection
@@ -22,18 +20,82 @@ func NewClient(ctx context.Context, host string, collection string, vectorSize u
 		return nil, fmt.Errorf("failed to get Qdrant collection: %w", err)
 	}
 	if !exists {
-		if qdClient.CreateCollection(context.Background(), &qdrant.CreateCollection{
-			CollectionName: collection,
-			VectorsConfig: qdrant.NewVectorsConfig(&qdrant.VectorParams{
-				Size:     vectorSize,
-				Distance: qdrant.Distance_Cosine,
-			}),
-		}) != nil {
-			return nil, fmt.Errorf("failed to create Qdrant collection: %w", err)
-
+		if err := CreateCollection(ctx, qdClient, collection, vectorSize); err != nil {
+			return nil, err
 		}
 	}
 
+	return qdClient, nil
+}
+
+// NewAliasedClient is like NewClient but serves a collection of named vectors (name -> size) through an alias so it
+// can later be swapped by a reindex. A collection already stored under the alias name is left in place.
+func NewAliasedClient(ctx context.Context, host string, alias string, vectors map[string]uint64) (*qdrant.Client, error) {
+	qdClient, err := connect(ctx, host)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := EnsureAlias(ctx, qdClient, alias, vectors); err != nil {
+		return nil, err
+	}
+
+	return qdClient, nil
+}
+
+// EnsureAlias creates a collection of named vectors (name -> size) behind alias unless the alias, or a collection
+// stored under its name, already exists
+func EnsureAlias(ctx context.Context, client *qdrant.Client, alias string, vectors map[string]uint64) error {
+	current, err := ResolveAlias(ctx, client, alias)
+	if err != nil {
+		return err
+	}
+	if current != "" {
+		return nil
+	}
+
+	legacy, err := collectionExists(ctx, client, alias)
+	if err != nil {
+		return err
+	}
+	if legacy {
+		return nil
+	}
+
+	collection := VersionedName(alias)
+	if err := CreateNamedCollection(ctx, client, collection, vectors); err != nil {
+		return err
+	}
+	if err := client.CreateAlias(ctx, alias, collection); err != nil {
+		return fmt.Errorf("failed to create Qdrant alias: %w", err)
+	}
+
+	return nil
+}
+
+// EnsureKeywordIndex indexes a keyword payload field used for filtering, doing nothing if the index already exists
+func EnsureKeywordIndex(ctx context.Context, client *qdrant.Client, collection, field string) error {
+	_, err := client.CreateFieldIndex(ctx, &qdrant.CreateFieldIndexCollection{
+		CollectionName: collection,
+		FieldName:      field,
+		FieldType:      qdrant.FieldType_FieldTypeKeyword.Enum(),
+		Wait:           qdrant.PtrOf(true),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to index Qdrant field %s: %w", field, err)
+	}
+	return nil
+}
+
+func connect(ctx context.Context, host string) (*qdrant.Client, error) {
+	// setup qdrant
+	qdClient, err := qdrant.NewClient(&qdrant.Config{
+		Host: host,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create Qdrant client: %w", err)
+	}
+
 	_, err = qdClient.HealthCheck(ctx)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get Qdrant healthcheck: %w", err)
@@ -41,3 +103,218 @@ func NewClient(ctx context.Context, host string, collection string, vectorSize u
 
 	return qdClient, nil
 }
+
+// CreateCollection creates a cosine similarity collection for vectors of the given size
+func CreateCollection(ctx context.Context, client *qdrant.Client, collection string, vectorSize uint64) error {
+	err := client.CreateCollection(ctx, &qdrant.CreateCollection{
+		CollectionName: collection,
+		VectorsConfig: qdrant.NewVectorsConfig(&qdrant.VectorParams{
+			Size:     vectorSize,
+			Distance: qdrant.Distance_Cosine,
+		}),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to create Qdrant collection: %w", err)
+	}
+	return nil
+}
+
+// CreateNamedCollection creates a cosine similarity collection with one named vector per entry of vectors (name -> size)
+func CreateNamedCollection(ctx context.Context, client *qdrant.Client, collection string, vectors map[string]uint64) error {
+	params := make(map[string]*qdrant.VectorParams, len(vectors))
+	for name, size := range vectors {
+		params[name] = &qdrant.VectorParams{
+			Size:     size,
+			Distance: qdrant.Distance_Cosine,
+		}
+	}
+
+	err := client.CreateCollection(ctx, &qdrant.CreateCollection{
+		CollectionName: collection,
+		VectorsConfig:  qdrant.NewVectorsConfigMap(params),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to create Qdrant collection: %w", err)
+	}
+	return nil
+}
+
+// VectorNames returns the named vectors of a collection (or alias) with their sizes, empty for an unnamed-vector collection
+func VectorNames(ctx context.Context, client *qdrant.Client, collection string) (map[string]uint64, error) {
+	info, err := client.GetCollectionInfo(ctx, collection)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get Qdrant collection info: %w", err)
+	}
+
+	names := make(map[string]uint64)
+	for name, params := range info.GetConfig().GetParams().GetVectorsConfig().GetParamsMap().GetMap() {
+		names[name] = params.GetSize()
+	}
+	return names, nil
+}
+
+// VersionedName returns a new, unique physical collection name for an alias, distinct even for names created within
+// the same second
+func VersionedName(alias string) string {
+	return fmt.Sprintf("%s_%d", alias, time.Now().UnixNano())
+}
+
+// ResolveAlias returns the collection an alias points at, or "" if the alias does not exist
+func ResolveAlias(ctx context.Context, client *qdrant.Client, alias string) (string, error) {
+	aliases, err := client.ListAliases(ctx)
+	if err != nil {
+		return "", fmt.Errorf("failed to list Qdrant aliases: %w", err)
+	}
+	for _, a := range aliases {
+		if a.GetAliasName() == alias {
+			return a.GetCollectionName(), nil
+		}
+	}
+	return "", nil
+}
+
+// SwapAlias points alias at collection and returns the collection it previously pointed at.
+// The swap is atomic when alias already exists. A legacy collection stored under the alias name is first copied into a
+// versioned collection, returned as the previous collection for rollback, and only then dropped to free the name for the
+// alias; should the alias then fail to be created, it is pointed at the copy instead so pages are still served.
+func SwapAlias(ctx context.Context, client *qdrant.Client, alias, collection string) (string, error) {
+	previous, err := ResolveAlias(ctx, client, alias)
+	if err != nil {
+		return "", err
+	}
+
+	if previous == "" {
+		legacy, err := collectionExists(ctx, client, alias)
+		if err != nil {
+			return "", err
+		}
+		if legacy {
+			previous = VersionedName(alias) + "_legacy"
+			if err := CopyCollection(ctx, client, alias, previous); err != nil {
+				return "", fmt.Errorf("failed to copy legacy Qdrant collection: %w", err)
+			}
+			if err := client.DeleteCollection(ctx, alias); err != nil {
+				return "", fmt.Errorf("failed to delete legacy Qdrant collection, its pages are copied in %s: %w", previous, err)
+			}
+		}
+		if err := client.CreateAlias(ctx, alias, collection); err != nil {
+			if previous != "" {
+				if rollbackErr := client.CreateAlias(ctx, alias, previous); rollbackErr != nil {
+					return "", fmt.Errorf("failed to create Qdrant alias (%w) or point it at the legacy pages in %s: %w", err, previous, rollbackErr)
+				}
+			}
+			return "", fmt.Errorf("failed to create Qdrant alias: %w", err)
+		}
+		return previous, nil
+	}
+
+	err = client.UpdateAliases(ctx, []*qdrant.AliasOperations{
+		qdrant.NewAliasDelete(alias),
+		qdrant.NewAliasCreate(alias, collection),
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to swap Qdrant alias: %w", err)
+	}
+
+	return previous, nil
+}
+
+// CopyCollection creates collection to with the vectors config of collection from and copies every point into it with
+// its vectors and payload, failing unless every point was copied
+func CopyCollection(ctx context.Context, client *qdrant.Client, from, to string) error {
+	info, err := client.GetCollectionInfo(ctx, from)
+	if err != nil {
+		return fmt.Errorf("failed to get Qdrant collection info: %w", err)
+	}
+	err = client.CreateCollection(ctx, &qdrant.CreateCollection{
+		CollectionName: to,
+		VectorsConfig:  info.GetConfig().GetParams().GetVectorsConfig(),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to create Qdrant collection: %w", err)
+	}
+
+	var copied uint64
+	var offset *qdrant.PointId
+	for {
+		points, next, err := client.ScrollAndOffset(ctx, &qdrant.ScrollPoints{
+			CollectionName: from,
+			Offset:         offset,
+			Limit:          qdrant.PtrOf(uint32(256)),
+			WithPayload:    qdrant.NewWithPayload(true),
+			WithVectors:    qdrant.NewWithVectors(true),
+		})
+		if err != nil {
+			return fmt.Errorf("failed to scroll %s: %w", from, err)
+		}
+
+		if len(points) > 0 {
+			upserts := make([]*qdrant.PointStruct, len(points))
+			for i, point := range points {
+				upserts[i] = &qdrant.PointStruct{
+					Id:      point.Id,
+					Vectors: VectorsFromOutput(point.GetVectors()),
+					Payload: point.Payload,
+				}
+			}
+			_, err = client.Upsert(ctx, &qdrant.UpsertPoints{
+				CollectionName: to,
+				Points:         upserts,
+				Wait:           qdrant.PtrOf(true),
+			})
+			if err != nil {
+				return fmt.Errorf("failed to copy points into %s: %w", to, err)
+			}
+			copied += uint64(len(points))
+		}
+
+		if next == nil {
+			break
+		}
+		offset = next
+	}
+
+	count, err := client.Count(ctx, &qdrant.CountPoints{CollectionName: to, Exact: qdrant.PtrOf(true)})
+	if err != nil {
+		return fmt.Errorf("failed to count points of %s: %w", to, err)
+	}
+	if count != copied {
+		return fmt.Errorf("copied %d points into %s but it holds %d", copied, to, count)
+	}
+
+	return nil
+}
+
+// VectorsFromOutput converts the dense vectors of a retrieved point into vectors to upsert, named or not
+func VectorsFromOutput(output *qdrant.VectorsOutput) *qdrant.Vectors {
+	if named := output.GetVectors(); named != nil {
+		vectors := make(map[string]*qdrant.Vector, len(named.GetVectors()))
+		for name, vector := range named.GetVectors() {
+			vectors[name] = qdrant.NewVector(DenseData(vector)...)
+		}
+		return qdrant.NewVectorsMap(vectors)
+	}
+	return qdrant.NewVectors(DenseData(output.GetVector())...)
+}
+
+// DenseData returns the values of a retrieved dense vector, whichever field the server filled in
+func DenseData(vector *qdrant.VectorOutput) []float32 {
+	if dense := vector.GetDense(); dense != nil {
+		return dense.GetData()
+	}
+	return vector.GetData()
+}
+
+// collectionExists reports whether a physical collection (not an alias) with the given name exists
+func collectionExists(ctx context.Context, client *qdrant.Client, collection string) (bool, error) {
+	collections, err := client.ListCollections(ctx)
+	if err != nil {
+		return false, fmt.Errorf("failed to list Qdrant collections: %w", err)
+	}
+	for _, c := range collections {
+		if c == collection {
+			return true, nil
+		}
+	}
+	return false, nil
+}
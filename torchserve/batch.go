@@ -0,0 +1,200 @@
+package torchserve
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/dbrun3/nexus-vector/metrics"
+)
+
+// DefaultBatchMaxSize is the default number of texts per batched prediction
+const DefaultBatchMaxSize = 32
+
+// BatchConfig configures micro-batching, which coalesces concurrent TextToEmbeddings calls of a model into a single
+// prediction. A batch is sent Window after its first call or as soon as it holds MaxSize texts
+type BatchConfig struct {
+	Window  time.Duration // batching is disabled when 0
+	MaxSize int           // defaults to DefaultBatchMaxSize
+}
+
+// batchCall is one TextToEmbeddings call waiting in a batch
+type batchCall struct {
+	ctx    context.Context
+	texts  []string
+	result chan batchResult
+}
+
+type batchResult struct {
+	embeddings [][]float32
+	err        error
+}
+
+// batcher collects the calls of one model into batches and sends each with predict
+type batcher struct {
+	model   string
+	window  time.Duration
+	maxSize int
+	predict func(ctx context.Context, texts []string) ([][]float32, error)
+
+	calls     chan *batchCall
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+func newBatcher(model string, config BatchConfig, predict func(ctx context.Context, texts []string) ([][]float32, error)) *batcher {
+	if config.MaxSize <= 0 {
+		config.MaxSize = DefaultBatchMaxSize
+	}
+	b := &batcher{
+		model:   model,
+		window:  config.Window,
+		maxSize: config.MaxSize,
+		predict: predict,
+		calls:   make(chan *batchCall),
+		done:    make(chan struct{}),
+	}
+	go b.run()
+	return b
+}
+
+// embed adds texts to the next batch and waits for their embeddings, giving up when ctx is done. Calls with at least
+// MaxSize texts are a batch of their own and are sent straight away
+func (b *batcher) embed(ctx context.Context, texts []string) ([][]float32, error) {
+	if len(texts) >= b.maxSize {
+		b.observe(len(texts), 1)
+		return b.predict(ctx, texts)
+	}
+
+	call := &batchCall{ctx: ctx, texts: texts, result: make(chan batchResult, 1)}
+	select {
+	case b.calls <- call:
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case <-b.done:
+		return nil, fmt.Errorf("TorchServe client is closed")
+	}
+
+	select {
+	case result := <-call.result:
+		return result.embeddings, result.err
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// run collects calls until the window elapses or the batch is full, sending each batch while collecting the next
+func (b *batcher) run() {
+	for {
+		var batch []*batchCall
+		select {
+		case call := <-b.calls:
+			batch = append(batch, call)
+		case <-b.done:
+			return
+		}
+
+		size := len(batch[0].texts)
+		timer := time.NewTimer(b.window)
+	collect:
+		for size < b.maxSize {
+			select {
+			case call := <-b.calls:
+				batch = append(batch, call)
+				size += len(call.texts)
+			case <-timer.C:
+				break collect
+			case <-b.done:
+				timer.Stop()
+				b.fail(batch, fmt.Errorf("TorchServe client is closed"))
+				return
+			}
+		}
+		timer.Stop()
+
+		go b.send(batch)
+	}
+}
+
+// send makes one prediction for every call of a batch still waiting and fans the embeddings back out. The prediction
+// has the earliest deadline of the calls, and is cancelled once every call's context is done
+func (b *batcher) send(batch []*batchCall) {
+	waiting := batch[:0]
+	for _, call := range batch {
+		if err := call.ctx.Err(); err != nil {
+			call.result <- batchResult{err: err}
+			continue
+		}
+		waiting = append(waiting, call)
+	}
+	if len(waiting) == 0 {
+		return
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	if deadline, ok := earliestDeadline(waiting); ok {
+		var cancelDeadline context.CancelFunc
+		ctx, cancelDeadline = context.WithDeadline(ctx, deadline)
+		defer cancelDeadline()
+	}
+	var remaining atomic.Int32
+	remaining.Store(int32(len(waiting)))
+	for _, call := range waiting {
+		stop := context.AfterFunc(call.ctx, func() {
+			if remaining.Add(-1) == 0 {
+				cancel()
+			}
+		})
+		defer stop()
+	}
+
+	var texts []string
+	for _, call := range waiting {
+		texts = append(texts, call.texts...)
+	}
+	b.observe(len(texts), len(waiting))
+
+	embeddings, err := b.predict(ctx, texts)
+	if err == nil && len(embeddings) != len(texts) {
+		err = fmt.Errorf("invalid number of embeddings returned: expected %d, got %d", len(texts), len(embeddings))
+	}
+	if err != nil {
+		b.fail(waiting, err)
+		return
+	}
+
+	offset := 0
+	for _, call := range waiting {
+		call.result <- batchResult{embeddings: embeddings[offset : offset+len(call.texts) : offset+len(call.texts)]}
+		offset += len(call.texts)
+	}
+}
+
+// earliestDeadline returns the earliest deadline of the calls, ok being false when none has one
+func earliestDeadline(calls []*batchCall) (deadline time.Time, ok bool) {
+	for _, call := range calls {
+		if d, has := call.ctx.Deadline(); has && (!ok || d.Before(deadline)) {
+			deadline, ok = d, true
+		}
+	}
+	return deadline, ok
+}
+
+func (b *batcher) fail(batch []*batchCall, err error) {
+	for _, call := range batch {
+		call.result <- batchResult{err: err}
+	}
+}
+
+func (b *batcher) observe(texts, calls int) {
+	metrics.TorchServeBatchTexts.WithLabelValues(b.model).Observe(float64(texts))
+	metrics.TorchServeBatchCalls.WithLabelValues(b.model).Observe(float64(calls))
+}
+
+// close stops collecting batches, failing calls that were not sent
+func (b *batcher) close() {
+	b.closeOnce.Do(func() { close(b.done) })
+}
@@ -0,0 +1,154 @@
+package torchserve
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+)
+
+// echoPredict embeds each text as its length, recording every batch it is sent
+func echoPredict(batches *[][]string, mu *sync.Mutex) func(context.Context, []string) ([][]float32, error) {
+	return func(ctx context.Context, texts []string) ([][]float32, error) {
+		mu.Lock()
+		*batches = append(*batches, texts)
+		mu.Unlock()
+
+		embeddings := make([][]float32, len(texts))
+		for i, text := range texts {
+			embeddings[i] = []float32{float32(len(text))}
+		}
+		return embeddings, nil
+	}
+}
+
+func TestBatcher_Coalesces(t *testing.T) {
+	var mu sync.Mutex
+	var batches [][]string
+	b := newBatcher("test", BatchConfig{Window: 50 * time.Millisecond, MaxSize: 4}, echoPredict(&batches, &mu))
+	defer b.close()
+
+	// Four texts fill a batch, so it is sent before the window elapses
+	calls := [][]string{{"a"}, {"bb", "ccc"}, {"dddd"}}
+	results := make([][][]float32, len(calls))
+	var wg sync.WaitGroup
+	start := time.Now()
+	for i, texts := range calls {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			embeddings, err := b.embed(context.Background(), texts)
+			if err != nil {
+				t.Errorf("embed() error = %v", err)
+			}
+			results[i] = embeddings
+		}()
+	}
+	wg.Wait()
+
+	if elapsed := time.Since(start); elapsed >= 50*time.Millisecond {
+		t.Errorf("Expected a full batch to be sent before the window, took %v", elapsed)
+	}
+	if len(batches) != 1 || len(batches[0]) != 4 {
+		t.Fatalf("Expected a single batch of 4 texts, got %v", batches)
+	}
+	for i, texts := range calls {
+		if len(results[i]) != len(texts) {
+			t.Fatalf("Expected %d embeddings for call %d, got %v", len(texts), i, results[i])
+		}
+		for j, text := range texts {
+			if results[i][j][0] != float32(len(text)) {
+				t.Errorf("Call %d got embedding %v for %q", i, results[i][j], text)
+			}
+		}
+	}
+}
+
+func TestBatcher_Window(t *testing.T) {
+	var mu sync.Mutex
+	var batches [][]string
+	b := newBatcher("test", BatchConfig{Window: 5 * time.Millisecond, MaxSize: 4}, echoPredict(&batches, &mu))
+	defer b.close()
+
+	// A batch that never fills is sent once the window elapses, and large calls bypass batching
+	if embeddings, err := b.embed(context.Background(), []string{"a"}); err != nil || len(embeddings) != 1 {
+		t.Fatalf("embed() = %v, %v", embeddings, err)
+	}
+	if embeddings, err := b.embed(context.Background(), []string{"a", "b", "c", "d", "e"}); err != nil || len(embeddings) != 5 {
+		t.Fatalf("embed() = %v, %v", embeddings, err)
+	}
+	if len(batches) != 2 {
+		t.Errorf("Expected 2 batches, got %v", batches)
+	}
+}
+
+func TestBatcher_Cancellation(t *testing.T) {
+	release := make(chan struct{})
+	predictions := make(chan context.Context, 1)
+	b := newBatcher("test", BatchConfig{Window: time.Millisecond, MaxSize: 4}, func(ctx context.Context, texts []string) ([][]float32, error) {
+		predictions <- ctx
+		<-release
+		return nil, fmt.Errorf("prediction failed")
+	})
+	defer b.close()
+
+	// A cancelled caller returns straight away, and the prediction is cancelled once no caller waits for it
+	ctx, cancel := context.WithCancel(context.Background())
+	errs := make(chan error, 1)
+	go func() {
+		_, err := b.embed(ctx, []string{"a"})
+		errs <- err
+	}()
+	predictCtx := <-predictions
+	cancel()
+
+	if err := <-errs; !errors.Is(err, context.Canceled) {
+		t.Errorf("Expected context.Canceled, got %v", err)
+	}
+	select {
+	case <-predictCtx.Done():
+	case <-time.After(time.Second):
+		t.Error("Expected the prediction to be cancelled")
+	}
+	close(release)
+}
+
+func TestBatcher_Deadline(t *testing.T) {
+	predictions := make(chan context.Context, 1)
+	b := newBatcher("test", BatchConfig{Window: 20 * time.Millisecond, MaxSize: 4}, func(ctx context.Context, texts []string) ([][]float32, error) {
+		predictions <- ctx
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(time.Second):
+			return nil, fmt.Errorf("prediction has no deadline")
+		}
+	})
+	defer b.close()
+
+	// The prediction has the earliest deadline of its calls, and none without one
+	short, cancelShort := context.WithTimeout(context.Background(), 30*time.Millisecond)
+	defer cancelShort()
+	long, cancelLong := context.WithTimeout(context.Background(), time.Hour)
+	defer cancelLong()
+
+	var wg sync.WaitGroup
+	for _, ctx := range []context.Context{context.Background(), long, short} {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := b.embed(ctx, []string{"a"}); err == nil {
+				t.Error("Expected the prediction to fail once the earliest deadline passed")
+			}
+		}()
+	}
+
+	predictCtx := <-predictions
+	want, _ := short.Deadline()
+	if deadline, ok := predictCtx.Deadline(); !ok || !deadline.Equal(want) {
+		t.Errorf("Expected the prediction deadline %v, got %v", want, deadline)
+	}
+	wg.Wait()
+}
@@ -4,25 +4,100 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"log"
+	"math"
+	"math/rand/v2"
 	"strings"
+	"sync"
 	"time"
 
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/credentials/insecure"
 	"google.golang.org/protobuf/types/known/emptypb"
 
+	"github.com/dbrun3/nexus-vector/metrics"
 	"github.com/dbrun3/nexus-vector/torchserve/pb"
 )
 
 // protoc --go_out=. --go-grpc_out=. --proto_path=internal/torchserve/proto --go_opt=Minference.proto=internal/torchserve/pb --go-grpc_opt=Minference.proto=internal/torchserve/pb internal/torchserve/proto/inference.proto
 
+// Protocols of the TorchServe inference API
+const (
+	GRPCProtocol   = "grpc"
+	StreamProtocol = "grpc-stream" // gRPC over long-lived StreamPredictions2 streams
+	RESTProtocol   = "rest"
+)
+
+// transport sends prediction requests to a TorchServe inference API
+type transport interface {
+	predict(ctx context.Context, model, version string, body []byte) ([]byte, error)
+	ping(ctx context.Context) (string, error)
+	close() error
+}
+
 type Client struct {
+	transport transport
+	model     string
+
+	// Model versions predictions run on, the default version when empty. A CanaryFraction of predictions are also
+	// shadowed on the canary version, whose embeddings are only compared and never returned
+	version ModelVersion
+	shadows *sync.WaitGroup
+
+	// Micro-batching of concurrent calls, nil when disabled
+	batch   BatchConfig
+	batcher *batcher
+}
+
+// ModelVersion pins the version of a model predictions run on, optionally shadowing a fraction of them on a canary
+// version. Canary embeddings are never returned, so vectors of both versions never share a vector space
+type ModelVersion struct {
+	Version        string  `json:"version,omitempty"`         // defaults to the version TorchServe serves by default
+	Canary         string  `json:"canary,omitempty"`          // canary version
+	CanaryFraction float64 `json:"canary_fraction,omitempty"` // share of predictions from 0 to 1 shadowed on Canary
+}
+
+// CanaryTimeout bounds a shadow prediction on a canary version
+const CanaryTimeout = 30 * time.Second
+
+// grpcTransport speaks the gRPC inference API, on port 7070 by default
+type grpcTransport struct {
 	conn   *grpc.ClientConn
 	client pb.InferenceAPIsServiceClient
-	model  string
 }
 
 func NewClient(address, modelName string) (*Client, error) {
+	t, err := dialGRPC(address)
+	if err != nil {
+		return nil, err
+	}
+
+	c := &Client{
+		transport: t,
+		model:     modelName,
+		shadows:   &sync.WaitGroup{},
+	}
+	return c, c.waitHealthy()
+}
+
+// NewStreamClient creates a client of the gRPC inference API multiplexing predictions over that many long-lived
+// StreamPredictions2 streams, DefaultStreams when not positive
+func NewStreamClient(address, modelName string, streams int) (*Client, error) {
+	t, err := dialGRPC(address)
+	if err != nil {
+		return nil, err
+	}
+
+	c := &Client{
+		transport: newStreamTransport(t, streams),
+		model:     modelName,
+		shadows:   &sync.WaitGroup{},
+	}
+	return c, c.waitHealthy()
+}
+
+// dialGRPC connects to the gRPC inference API
+func dialGRPC(address string) (*grpcTransport, error) {
 	// Add default port if not specified, assumes using proto
 	if !strings.Contains(address, ":") {
 		address += ":7070"
@@ -34,16 +109,34 @@ func NewClient(address, modelName string) (*Client, error) {
 	if err != nil {
 		return nil, fmt.Errorf("failed to connect to TorchServe: %w", err)
 	}
+	return &grpcTransport{conn: conn, client: pb.NewInferenceAPIsServiceClient(conn)}, nil
+}
 
-	client := pb.NewInferenceAPIsServiceClient(conn)
-
+// NewRESTClient creates a client of the REST inference API, on port 8080 by default, for networks where gRPC is blocked
+func NewRESTClient(address, modelName string) (*Client, error) {
 	c := &Client{
-		conn:   conn,
-		client: client,
-		model:  modelName,
+		transport: newRESTTransport(address),
+		model:     modelName,
+		shadows:   &sync.WaitGroup{},
 	}
+	return c, c.waitHealthy()
+}
 
-	// Verify the server is healthy before returning with retry logic
+// NewProtocolClient creates a client of the inference API speaking protocol, GRPCProtocol when empty
+func NewProtocolClient(protocol, address, modelName string) (*Client, error) {
+	switch protocol {
+	case "", GRPCProtocol:
+		return NewClient(address, modelName)
+	case StreamProtocol:
+		return NewStreamClient(address, modelName, DefaultStreams)
+	case RESTProtocol:
+		return NewRESTClient(address, modelName)
+	}
+	return nil, fmt.Errorf("unknown TorchServe protocol: %s", protocol)
+}
+
+// waitHealthy verifies the server is healthy before returning with retry logic
+func (c *Client) waitHealthy() error {
 	maxRetries := 30
 	retryDelay := 2 * time.Second
 
@@ -58,50 +151,164 @@ func NewClient(address, modelName string) (*Client, error) {
 
 		if attempt == maxRetries-1 {
 			c.Close()
-			return nil, fmt.Errorf("server health check failed after %d attempts: %w", maxRetries, healthErr)
+			return fmt.Errorf("server health check failed after %d attempts: %w", maxRetries, healthErr)
 		}
 
 		fmt.Printf("TorchServe health check failed (attempt %d/%d), retrying in %v: %v\n", attempt+1, maxRetries, retryDelay, healthErr)
 		time.Sleep(retryDelay)
 	}
 
-	return c, nil
+	return nil
+}
+
+// WithModel returns a client for another model served over the same connection (closing either closes both),
+// batching its calls like c
+func (c *Client) WithModel(modelName string) *Client {
+	m := &Client{
+		transport: c.transport,
+		model:     modelName,
+		shadows:   c.shadows,
+	}
+	return m.WithBatching(c.batch)
+}
+
+// WithVersion returns a client for the same model whose predictions run on version, batching its calls like c
+func (c *Client) WithVersion(version ModelVersion) *Client {
+	v := &Client{
+		transport: c.transport,
+		model:     c.model,
+		version:   version,
+		shadows:   c.shadows,
+	}
+	return v.WithBatching(c.batch)
+}
+
+// WithBatching returns a client for the same model whose concurrent TextToEmbeddings calls are coalesced into batched
+// predictions, a zero Window disabling batching
+func (c *Client) WithBatching(config BatchConfig) *Client {
+	b := &Client{
+		transport: c.transport,
+		model:     c.model,
+		version:   c.version,
+		shadows:   c.shadows,
+		batch:     config,
+	}
+	if config.Window > 0 {
+		b.batcher = newBatcher(c.model, config, b.predict)
+	}
+	return b
+}
+
+// Model returns the name of the model used for embeddings
+func (c *Client) Model() string {
+	return c.model
 }
 
 func (c *Client) Close() error {
-	if c.conn != nil {
-		return c.conn.Close()
+	if c.batcher != nil {
+		c.batcher.close()
+	}
+	if c.shadows != nil {
+		c.shadows.Wait()
+	}
+	if c.transport != nil {
+		return c.transport.close()
 	}
 	return nil
 }
 
-// TextToEmbeddings takes a list of sentences and returns an array of resulting vectors
+// TextToEmbeddings takes a list of sentences and returns an array of resulting vectors, batched with concurrent calls
+// when batching is enabled
 // Assumes we are using a torchserver that handles pre-processing like https://github.com/clems4ever/torchserve-all-minilm-l6-v2
 func (c *Client) TextToEmbeddings(ctx context.Context, texts ...string) ([][]float32, error) {
-	// For gRPC, send the texts as individual byte inputs
-	input := make(map[string][]byte)
+	if c.batcher != nil {
+		return c.batcher.embed(ctx, texts)
+	}
+	return c.predict(ctx, texts)
+}
 
+// predict makes a single prediction request for texts
+func (c *Client) predict(ctx context.Context, texts []string) ([][]float32, error) {
 	// Send exact same JSON format as HTTP curl example
 	jsonBytes, err := json.Marshal(map[string][]string{"input": texts})
 	if err != nil {
 		return nil, fmt.Errorf("failed to marshal input: %w", err)
 	}
 
-	input["body"] = jsonBytes
+	prediction, err := c.transport.predict(ctx, c.model, c.version.Version, jsonBytes)
+	if err != nil {
+		return nil, fmt.Errorf("prediction failed: %w", err)
+	}
+
+	embeddings, err := parseEmbeddings(prediction)
+	if err != nil {
+		return nil, err
+	}
 
-	req := &pb.PredictionsRequest{
-		ModelName: c.model,
-		Input:     input,
+	if canary := c.version.pick(); canary != "" {
+		c.shadows.Add(1)
+		go func() {
+			defer c.shadows.Done()
+			c.shadow(context.WithoutCancel(ctx), canary, jsonBytes, embeddings)
+		}()
 	}
 
-	resp, err := c.client.Predictions(ctx, req)
+	return embeddings, nil
+}
+
+// pick returns the canary version a prediction is shadowed on, empty when it isn't
+func (v ModelVersion) pick() string {
+	if v.Canary != "" && rand.Float64() < v.CanaryFraction {
+		return v.Canary
+	}
+	return ""
+}
+
+// shadow repeats a prediction on a canary version and records how similar its embeddings are to the served ones
+func (c *Client) shadow(ctx context.Context, canary string, body []byte, served [][]float32) {
+	ctx, cancel := context.WithTimeout(ctx, CanaryTimeout)
+	defer cancel()
+
+	prediction, err := c.transport.predict(ctx, c.model, canary, body)
+	var embeddings [][]float32
+	if err == nil {
+		embeddings, err = parseEmbeddings(prediction)
+	}
+	if err == nil && len(embeddings) != len(served) {
+		err = fmt.Errorf("expected %d embeddings, got %d", len(served), len(embeddings))
+	}
 	if err != nil {
-		return nil, fmt.Errorf("prediction failed: %w", err)
+		metrics.TorchServeCanaryErrors.WithLabelValues(c.model, canary).Inc()
+		log.Printf("Shadow prediction of %s on canary version %s failed: %v", c.model, canary, err)
+		return
 	}
 
-	// Parse the response as embeddings
+	for i := range embeddings {
+		metrics.TorchServeCanarySimilarity.WithLabelValues(c.model, canary).Observe(cosineSimilarity(served[i], embeddings[i]))
+	}
+}
+
+// cosineSimilarity returns the cosine similarity of two embeddings, 0 when their dimensions differ or either is zero
+func cosineSimilarity(a, b []float32) float64 {
+	if len(a) != len(b) {
+		return 0
+	}
+	var dot, normA, normB float64
+	for i := range a {
+		dot += float64(a[i]) * float64(b[i])
+		normA += float64(a[i]) * float64(a[i])
+		normB += float64(b[i]) * float64(b[i])
+	}
+	if normA == 0 || normB == 0 {
+		return 0
+	}
+	return dot / (math.Sqrt(normA) * math.Sqrt(normB))
+}
+
+// parseEmbeddings parses a prediction as embeddings
+func parseEmbeddings(prediction []byte) ([][]float32, error) {
 	var embeddings64 [][]float64
-	if err := json.Unmarshal(resp.Prediction, &embeddings64); err != nil {
+	if err := json.Unmarshal(prediction, &embeddings64); err != nil {
 		return nil, fmt.Errorf("failed to parse embeddings: %w", err)
 	}
 
@@ -118,10 +325,40 @@ func (c *Client) TextToEmbeddings(ctx context.Context, texts ...string) ([][]flo
 }
 
 func (c *Client) Health(ctx context.Context) (string, error) {
-	resp, err := c.client.Ping(ctx, &emptypb.Empty{})
+	health, err := c.transport.ping(ctx)
 	if err != nil {
 		return "", fmt.Errorf("health check failed: %w", err)
 	}
 
+	return health, nil
+}
+
+func (t *grpcTransport) predict(ctx context.Context, model, version string, body []byte) ([]byte, error) {
+	// For gRPC, send the texts as individual byte inputs
+	req := &pb.PredictionsRequest{
+		ModelName:    model,
+		ModelVersion: version,
+		Input:        map[string][]byte{"body": body},
+	}
+
+	resp, err := t.client.Predictions(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	return resp.Prediction, nil
+}
+
+func (t *grpcTransport) ping(ctx context.Context) (string, error) {
+	resp, err := t.client.Ping(ctx, &emptypb.Empty{})
+	if err != nil {
+		return "", err
+	}
 	return resp.Health, nil
 }
+
+func (t *grpcTransport) close() error {
+	if t.conn != nil {
+		return t.conn.Close()
+	}
+	return nil
+}
@@ -0,0 +1,39 @@
+package torchserve
+
+import "testing"
+
+func TestModelVersionPick(t *testing.T) {
+	tests := []struct {
+		name    string
+		version ModelVersion
+		want    string
+	}{
+		{"no canary", ModelVersion{Version: "1.0", CanaryFraction: 1}, ""},
+		{"fraction 0", ModelVersion{Version: "1.0", Canary: "2.0"}, ""},
+		{"fraction 1", ModelVersion{Version: "1.0", Canary: "2.0", CanaryFraction: 1}, "2.0"},
+	}
+	for _, tt := range tests {
+		for range 100 {
+			if got := tt.version.pick(); got != tt.want {
+				t.Fatalf("%s: pick() = %q, want %q", tt.name, got, tt.want)
+			}
+		}
+	}
+}
+
+func TestCosineSimilarity(t *testing.T) {
+	tests := []struct {
+		a, b []float32
+		want float64
+	}{
+		{[]float32{1, 0}, []float32{2, 0}, 1},
+		{[]float32{1, 0}, []float32{0, 1}, 0},
+		{[]float32{1, 0}, []float32{0, 0}, 0},
+		{[]float32{1, 0}, []float32{1}, 0},
+	}
+	for _, tt := range tests {
+		if got := cosineSimilarity(tt.a, tt.b); got != tt.want {
+			t.Errorf("cosineSimilarity(%v, %v) = %v, want %v", tt.a, tt.b, got, tt.want)
+		}
+	}
+}
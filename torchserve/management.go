@@ -0,0 +1,167 @@
+package torchserve
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+// ManagementClient speaks TorchServe's management API, on port 8081 by default
+type ManagementClient struct {
+	baseURL string
+	client  *http.Client
+}
+
+// ModelSummary is a registered model as listed by the management API
+type ModelSummary struct {
+	ModelName string `json:"modelName"`
+	ModelURL  string `json:"modelUrl"`
+}
+
+// ModelDescription describes one version of a registered model and its workers
+type ModelDescription struct {
+	ModelName       string   `json:"modelName"`
+	ModelVersion    string   `json:"modelVersion"`
+	ModelURL        string   `json:"modelUrl"`
+	Runtime         string   `json:"runtime"`
+	MinWorkers      int      `json:"minWorkers"`
+	MaxWorkers      int      `json:"maxWorkers"`
+	BatchSize       int      `json:"batchSize"`
+	MaxBatchDelay   int      `json:"maxBatchDelay"` // milliseconds
+	LoadedAtStartup bool     `json:"loadedAtStartup"`
+	Workers         []Worker `json:"workers"`
+}
+
+// Worker is a worker process serving a model version
+type Worker struct {
+	ID          string `json:"id"`
+	StartTime   string `json:"startTime"`
+	Status      string `json:"status"`
+	MemoryUsage int64  `json:"memoryUsage"`
+	PID         int    `json:"pid"`
+	GPU         bool   `json:"gpu"`
+	GPUUsage    string `json:"gpuUsage"`
+}
+
+// RegisterOptions registers a model archive, unset fields using TorchServe's defaults
+type RegisterOptions struct {
+	URL             string // model archive URL or file name in the model store, required
+	ModelName       string // defaults to the archive's model name
+	InitialWorkers  int
+	Synchronous     bool // wait for the initial workers to start
+	BatchSize       int
+	MaxBatchDelay   time.Duration
+	ResponseTimeout time.Duration
+}
+
+// ScaleOptions sets the number of workers of a model version
+type ScaleOptions struct {
+	MinWorkers  int
+	MaxWorkers  int  // defaults to MinWorkers
+	Synchronous bool // wait for the workers to scale
+}
+
+func NewManagementClient(address string) *ManagementClient {
+	return &ManagementClient{baseURL: baseURL(address, "8081"), client: &http.Client{}}
+}
+
+// managementStatus is the response of management API calls that change a model
+type managementStatus struct {
+	Status string `json:"status"`
+}
+
+// ListModels lists every registered model
+func (m *ManagementClient) ListModels(ctx context.Context) ([]ModelSummary, error) {
+	var models []ModelSummary
+	token := ""
+	for {
+		query := url.Values{"limit": {"100"}}
+		if token != "" {
+			query.Set("next_page_token", token)
+		}
+
+		var page struct {
+			NextPageToken string         `json:"nextPageToken"`
+			Models        []ModelSummary `json:"models"`
+		}
+		if err := doJSON(ctx, m.client, http.MethodGet, m.baseURL+"/models?"+query.Encode(), nil, &page); err != nil {
+			return nil, err
+		}
+		models = append(models, page.Models...)
+
+		if page.NextPageToken == "" {
+			return models, nil
+		}
+		token = page.NextPageToken
+	}
+}
+
+// DescribeModel describes a version of a model, its default version when version is empty or every version when it
+// is "all"
+func (m *ManagementClient) DescribeModel(ctx context.Context, model, version string) ([]ModelDescription, error) {
+	var descriptions []ModelDescription
+	err := doJSON(ctx, m.client, http.MethodGet, m.baseURL+modelPath("/models", model, version), nil, &descriptions)
+	return descriptions, err
+}
+
+// RegisterModel registers a model archive, returning TorchServe's status message
+func (m *ManagementClient) RegisterModel(ctx context.Context, options RegisterOptions) (string, error) {
+	query := url.Values{"url": {options.URL}}
+	if options.ModelName != "" {
+		query.Set("model_name", options.ModelName)
+	}
+	if options.InitialWorkers > 0 {
+		query.Set("initial_workers", strconv.Itoa(options.InitialWorkers))
+	}
+	if options.Synchronous {
+		query.Set("synchronous", "true")
+	}
+	if options.BatchSize > 0 {
+		query.Set("batch_size", strconv.Itoa(options.BatchSize))
+	}
+	if options.MaxBatchDelay > 0 {
+		query.Set("max_batch_delay", strconv.FormatInt(options.MaxBatchDelay.Milliseconds(), 10))
+	}
+	if options.ResponseTimeout > 0 {
+		query.Set("response_timeout", strconv.FormatInt(int64(options.ResponseTimeout.Seconds()), 10))
+	}
+
+	var status managementStatus
+	err := doJSON(ctx, m.client, http.MethodPost, m.baseURL+"/models?"+query.Encode(), nil, &status)
+	return status.Status, err
+}
+
+// UnregisterModel unregisters a version of a model, its default version when version is empty
+func (m *ManagementClient) UnregisterModel(ctx context.Context, model, version string) (string, error) {
+	var status managementStatus
+	err := doJSON(ctx, m.client, http.MethodDelete, m.baseURL+modelPath("/models", model, version), nil, &status)
+	return status.Status, err
+}
+
+// ScaleWorkers sets the number of workers of a version of a model, its default version when version is empty
+func (m *ManagementClient) ScaleWorkers(ctx context.Context, model, version string, options ScaleOptions) (string, error) {
+	maxWorkers := options.MaxWorkers
+	if maxWorkers == 0 {
+		maxWorkers = options.MinWorkers
+	}
+	query := url.Values{
+		"min_worker": {strconv.Itoa(options.MinWorkers)},
+		"max_worker": {strconv.Itoa(maxWorkers)},
+	}
+	if options.Synchronous {
+		query.Set("synchronous", "true")
+	}
+
+	var status managementStatus
+	err := doJSON(ctx, m.client, http.MethodPut, m.baseURL+modelPath("/models", model, version)+"?"+query.Encode(), nil, &status)
+	return status.Status, err
+}
+
+// SetDefaultVersion makes a version of a model the one predictions without a version run on
+func (m *ManagementClient) SetDefaultVersion(ctx context.Context, model, version string) (string, error) {
+	var status managementStatus
+	err := doJSON(ctx, m.client, http.MethodPut, m.baseURL+modelPath("/models", model, version)+"/set-default", nil, &status)
+	return status.Status, err
+}
@@ -0,0 +1,130 @@
+package torchserve
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// APIError is an error response of TorchServe's REST inference or management API
+type APIError struct {
+	StatusCode int    `json:"code"`
+	Type       string `json:"type"`
+	Message    string `json:"message"`
+}
+
+func (e *APIError) Error() string {
+	if e.Type == "" {
+		return fmt.Sprintf("TorchServe API error %d: %s", e.StatusCode, e.Message)
+	}
+	return fmt.Sprintf("TorchServe API error %d %s: %s", e.StatusCode, e.Type, e.Message)
+}
+
+// baseURL turns a TorchServe address into a base URL, adding the http scheme and default port when missing
+func baseURL(address, defaultPort string) string {
+	if !strings.Contains(address, "://") {
+		address = "http://" + address
+	}
+	u, err := url.Parse(address)
+	if err != nil {
+		return strings.TrimSuffix(address, "/")
+	}
+	if u.Port() == "" {
+		u.Host = net.JoinHostPort(u.Hostname(), defaultPort)
+	}
+	return strings.TrimSuffix(u.String(), "/")
+}
+
+// modelPath is the URL path of a model or one of its versions
+func modelPath(prefix, model, version string) string {
+	path := prefix + "/" + url.PathEscape(model)
+	if version != "" {
+		path += "/" + url.PathEscape(version)
+	}
+	return path
+}
+
+// doJSON sends a request and decodes a successful JSON response into out, unless out is nil. Error responses are
+// returned as *APIError
+func doJSON(ctx context.Context, client *http.Client, method, url string, body []byte, out any) error {
+	var reader io.Reader
+	if body != nil {
+		reader = bytes.NewReader(body)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, url, reader)
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return fmt.Errorf("failed to read response: %w", err)
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		apiErr := &APIError{}
+		if json.Unmarshal(data, apiErr) != nil || apiErr.Message == "" {
+			apiErr.Message = strings.TrimSpace(string(data))
+		}
+		apiErr.StatusCode = resp.StatusCode
+		return apiErr
+	}
+
+	switch out := out.(type) {
+	case nil:
+		return nil
+	case *[]byte:
+		*out = data
+		return nil
+	default:
+		if err := json.Unmarshal(data, out); err != nil {
+			return fmt.Errorf("failed to decode response: %w", err)
+		}
+		return nil
+	}
+}
+
+// restTransport speaks the REST inference API, on port 8080 by default
+type restTransport struct {
+	baseURL string
+	client  *http.Client
+}
+
+func newRESTTransport(address string) *restTransport {
+	return &restTransport{baseURL: baseURL(address, "8080"), client: &http.Client{}}
+}
+
+func (t *restTransport) predict(ctx context.Context, model, version string, body []byte) ([]byte, error) {
+	var prediction []byte
+	err := doJSON(ctx, t.client, http.MethodPost, t.baseURL+modelPath("/predictions", model, version), body, &prediction)
+	return prediction, err
+}
+
+func (t *restTransport) ping(ctx context.Context) (string, error) {
+	var health struct {
+		Status string `json:"status"`
+	}
+	if err := doJSON(ctx, t.client, http.MethodGet, t.baseURL+"/ping", nil, &health); err != nil {
+		return "", err
+	}
+	return health.Status, nil
+}
+
+func (t *restTransport) close() error {
+	t.client.CloseIdleConnections()
+	return nil
+}
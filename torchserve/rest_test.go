@@ -0,0 +1,176 @@
+package torchserve
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+)
+
+func TestBaseURL(t *testing.T) {
+	tests := []struct {
+		address string
+		want    string
+	}{
+		{"torchserve", "http://torchserve:8080"},
+		{"torchserve:9000", "http://torchserve:9000"},
+		{"https://torchserve/", "https://torchserve:8080"},
+		{"http://torchserve:9000/", "http://torchserve:9000"},
+	}
+	for _, tt := range tests {
+		if got := baseURL(tt.address, "8080"); got != tt.want {
+			t.Errorf("baseURL(%q) = %q, want %q", tt.address, got, tt.want)
+		}
+	}
+}
+
+func TestRESTClient_Predict(t *testing.T) {
+	var mu sync.Mutex
+	var paths []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.URL.Path == "/ping":
+			w.Write([]byte(`{"status": "Healthy"}`))
+		case r.Method == http.MethodPost:
+			mu.Lock()
+			paths = append(paths, r.URL.Path)
+			mu.Unlock()
+			var body struct {
+				Input []string `json:"input"`
+			}
+			if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+				t.Errorf("Invalid prediction body: %v", err)
+			}
+			embeddings := make([][]float64, len(body.Input))
+			for i, text := range body.Input {
+				embeddings[i] = []float64{float64(len(text))}
+			}
+			json.NewEncoder(w).Encode(embeddings)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	client, err := NewRESTClient(server.URL, "minilm")
+	if err != nil {
+		t.Fatalf("NewRESTClient() error = %v", err)
+	}
+	defer client.Close()
+
+	embeddings, err := client.TextToEmbeddings(context.Background(), "a", "bcd")
+	if err != nil {
+		t.Fatalf("TextToEmbeddings() error = %v", err)
+	}
+	if len(embeddings) != 2 || embeddings[0][0] != 1 || embeddings[1][0] != 3 {
+		t.Errorf("Unexpected embeddings %v", embeddings)
+	}
+
+	// Every prediction of a pinned version runs on it, and a canary only shadows them once they are served
+	client.WithVersion(ModelVersion{Version: "1.0"}).TextToEmbeddings(context.Background(), "a")
+	embeddings, err = client.WithVersion(ModelVersion{Version: "1.0", Canary: "2.0", CanaryFraction: 1}).TextToEmbeddings(context.Background(), "a")
+	if err != nil || len(embeddings) != 1 || embeddings[0][0] != 1 {
+		t.Errorf("Unexpected canary embeddings %v, error = %v", embeddings, err)
+	}
+	client.shadows.Wait()
+
+	mu.Lock()
+	defer mu.Unlock()
+	want := []string{"/predictions/minilm", "/predictions/minilm/1.0", "/predictions/minilm/1.0", "/predictions/minilm/2.0"}
+	if len(paths) != len(want) {
+		t.Fatalf("Expected predictions at %v, got %v", want, paths)
+	}
+	for i := range want {
+		if paths[i] != want[i] {
+			t.Errorf("Expected prediction %d at %s, got %s", i, want[i], paths[i])
+		}
+	}
+}
+
+func TestRESTClient_APIError(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/ping" {
+			w.Write([]byte(`{"status": "Healthy"}`))
+			return
+		}
+		w.WriteHeader(http.StatusNotFound)
+		w.Write([]byte(`{"code": 404, "type": "ModelNotFoundException", "message": "Model not found: missing"}`))
+	}))
+	defer server.Close()
+
+	client, err := NewRESTClient(server.URL, "missing")
+	if err != nil {
+		t.Fatalf("NewRESTClient() error = %v", err)
+	}
+	defer client.Close()
+
+	_, err = client.TextToEmbeddings(context.Background(), "a")
+	var apiErr *APIError
+	if !errors.As(err, &apiErr) {
+		t.Fatalf("Expected an APIError, got %v", err)
+	}
+	if apiErr.StatusCode != http.StatusNotFound || apiErr.Type != "ModelNotFoundException" {
+		t.Errorf("Unexpected APIError %+v", apiErr)
+	}
+}
+
+func TestManagementClient(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.Method == http.MethodGet && r.URL.Path == "/models":
+			// Two pages of models
+			if r.URL.Query().Get("next_page_token") == "" {
+				w.Write([]byte(`{"nextPageToken": "1", "models": [{"modelName": "minilm", "modelUrl": "minilm.mar"}]}`))
+			} else {
+				w.Write([]byte(`{"models": [{"modelName": "mpnet", "modelUrl": "mpnet.mar"}]}`))
+			}
+		case r.Method == http.MethodGet && r.URL.Path == "/models/minilm/all":
+			w.Write([]byte(`[{"modelName": "minilm", "modelVersion": "1.0", "workers": [{"id": "9000", "status": "READY"}]},
+				{"modelName": "minilm", "modelVersion": "2.0", "workers": []}]`))
+		case r.Method == http.MethodPut && r.URL.Path == "/models/minilm/2.0":
+			if r.URL.Query().Get("min_worker") != "2" || r.URL.Query().Get("max_worker") != "2" {
+				t.Errorf("Unexpected scale query %s", r.URL.RawQuery)
+			}
+			w.Write([]byte(`{"status": "Processing worker updates..."}`))
+		case r.Method == http.MethodPut && r.URL.Path == "/models/minilm/2.0/set-default":
+			w.Write([]byte(`{"status": "Default version successfully updated for model \"minilm\" to \"2.0\""}`))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	ctx := context.Background()
+	m := NewManagementClient(server.URL)
+
+	models, err := m.ListModels(ctx)
+	if err != nil {
+		t.Fatalf("ListModels() error = %v", err)
+	}
+	if len(models) != 2 || models[0].ModelName != "minilm" || models[1].ModelName != "mpnet" {
+		t.Errorf("Unexpected models %+v", models)
+	}
+
+	descriptions, err := m.DescribeModel(ctx, "minilm", "all")
+	if err != nil {
+		t.Fatalf("DescribeModel() error = %v", err)
+	}
+	if len(descriptions) != 2 || descriptions[1].ModelVersion != "2.0" || len(descriptions[0].Workers) != 1 {
+		t.Errorf("Unexpected descriptions %+v", descriptions)
+	}
+
+	if _, err := m.ScaleWorkers(ctx, "minilm", "2.0", ScaleOptions{MinWorkers: 2}); err != nil {
+		t.Errorf("ScaleWorkers() error = %v", err)
+	}
+	if _, err := m.SetDefaultVersion(ctx, "minilm", "2.0"); err != nil {
+		t.Errorf("SetDefaultVersion() error = %v", err)
+	}
+
+	var apiErr *APIError
+	if _, err := m.UnregisterModel(ctx, "minilm", ""); !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusNotFound {
+		t.Errorf("Expected a 404 APIError, got %v", err)
+	}
+}
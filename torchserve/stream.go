@@ -0,0 +1,230 @@
+package torchserve
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"sync"
+	"sync/atomic"
+
+	"google.golang.org/grpc"
+	grpcstatus "google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+
+	"github.com/dbrun3/nexus-vector/metrics"
+	"github.com/dbrun3/nexus-vector/torchserve/pb"
+)
+
+// DefaultStreams is the default number of StreamPredictions2 streams predictions are spread over
+const DefaultStreams = 4
+
+// errStreamBroken reports a stream that broke before answering a prediction, which is safe to retry on a new stream
+var errStreamBroken = errors.New("TorchServe prediction stream broken")
+
+// streamTransport multiplexes predictions over long-lived StreamPredictions2 streams, correlating responses with
+// requests by sequence id. A broken stream is reopened by the next prediction sent on it
+type streamTransport struct {
+	grpc    *grpcTransport // the connection streams are opened on, also serving pings
+	streams []*predictionStream
+	next    atomic.Uint64 // sequence ids, also spreading predictions over streams
+}
+
+// predictionStream is one slot of the pool, holding its current stream
+type predictionStream struct {
+	client pb.InferenceAPIsServiceClient
+
+	mu      sync.Mutex
+	current *liveStream // nil until opened and after breaking
+	opened  bool
+	closed  bool
+}
+
+// liveStream is an open stream and the predictions waiting for its responses
+type liveStream struct {
+	stream grpc.BidiStreamingClient[pb.PredictionsRequest, pb.PredictionResponse]
+	cancel context.CancelFunc
+	sendMu sync.Mutex // Send is not safe for concurrent use
+
+	mu      sync.Mutex
+	pending map[string]chan streamResult
+	err     error // why the stream broke, nil while open
+}
+
+type streamResult struct {
+	prediction []byte
+	err        error
+}
+
+func newStreamTransport(t *grpcTransport, streams int) *streamTransport {
+	if streams <= 0 {
+		streams = DefaultStreams
+	}
+	s := &streamTransport{grpc: t, streams: make([]*predictionStream, streams)}
+	for i := range s.streams {
+		s.streams[i] = &predictionStream{client: t.client}
+	}
+	return s
+}
+
+func (t *streamTransport) predict(ctx context.Context, model, version string, body []byte) ([]byte, error) {
+	id := t.next.Add(1)
+	stream := t.streams[id%uint64(len(t.streams))]
+	req := &pb.PredictionsRequest{
+		ModelName:    model,
+		ModelVersion: version,
+		Input:        map[string][]byte{"body": body},
+		SequenceId:   proto.String(strconv.FormatUint(id, 10)),
+	}
+
+	prediction, err := stream.predict(ctx, req)
+	if errors.Is(err, errStreamBroken) && ctx.Err() == nil {
+		// Predictions are idempotent, so one lost with its stream is retried once on a new stream
+		prediction, err = stream.predict(ctx, req)
+	}
+	return prediction, err
+}
+
+func (t *streamTransport) ping(ctx context.Context) (string, error) {
+	return t.grpc.ping(ctx)
+}
+
+func (t *streamTransport) close() error {
+	for _, stream := range t.streams {
+		stream.close()
+	}
+	return t.grpc.close()
+}
+
+// predict sends a request on the current stream, opening one when needed, and waits for its response
+func (s *predictionStream) predict(ctx context.Context, req *pb.PredictionsRequest) ([]byte, error) {
+	live, err := s.live()
+	if err != nil {
+		return nil, err
+	}
+
+	id := req.GetSequenceId()
+	result := make(chan streamResult, 1)
+	if err := live.wait(id, result); err != nil {
+		return nil, err
+	}
+
+	live.sendMu.Lock()
+	err = live.stream.Send(req)
+	live.sendMu.Unlock()
+	if err != nil {
+		// The reason the stream broke is returned by Recv, failing every waiting prediction including this one
+		live.cancel()
+	}
+
+	select {
+	case r := <-result:
+		return r.prediction, r.err
+	case <-ctx.Done():
+		live.forget(id)
+		return nil, ctx.Err()
+	}
+}
+
+// live returns the current stream, opening a new one when there is none
+func (s *predictionStream) live() (*liveStream, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.closed {
+		return nil, fmt.Errorf("TorchServe client is closed")
+	}
+	if s.current != nil {
+		return s.current, nil
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	stream, err := s.client.StreamPredictions2(ctx)
+	if err != nil {
+		cancel()
+		return nil, fmt.Errorf("failed to open prediction stream: %w", err)
+	}
+	if s.opened {
+		metrics.TorchServeStreamReconnects.Inc()
+	}
+	s.opened = true
+
+	s.current = &liveStream{stream: stream, cancel: cancel, pending: make(map[string]chan streamResult)}
+	go s.receive(s.current)
+	return s.current, nil
+}
+
+// receive hands each response to the prediction with its sequence id until the stream breaks
+func (s *predictionStream) receive(live *liveStream) {
+	for {
+		resp, err := live.stream.Recv()
+		if err != nil {
+			s.broken(live, err)
+			return
+		}
+
+		live.mu.Lock()
+		result, ok := live.pending[resp.GetSequenceId()]
+		delete(live.pending, resp.GetSequenceId())
+		live.mu.Unlock()
+		if !ok {
+			// The prediction was given up on
+			continue
+		}
+
+		if st := resp.GetStatus(); st != nil && st.GetCode() != 0 {
+			result <- streamResult{err: grpcstatus.ErrorProto(st)}
+			continue
+		}
+		result <- streamResult{prediction: resp.GetPrediction()}
+	}
+}
+
+// broken drops a stream so the next prediction opens a new one, failing every prediction waiting on it
+func (s *predictionStream) broken(live *liveStream, err error) {
+	s.mu.Lock()
+	if s.current == live {
+		s.current = nil
+	}
+	s.mu.Unlock()
+	live.cancel()
+
+	live.mu.Lock()
+	defer live.mu.Unlock()
+	live.err = fmt.Errorf("%w: %v", errStreamBroken, err)
+	for id, result := range live.pending {
+		result <- streamResult{err: live.err}
+		delete(live.pending, id)
+	}
+}
+
+// close stops the current stream, failing the predictions waiting on it, and any new stream from being opened
+func (s *predictionStream) close() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.closed = true
+	if s.current != nil {
+		s.current.cancel()
+	}
+}
+
+// wait registers a prediction waiting for the response with sequence id, failing when the stream already broke
+func (l *liveStream) wait(id string, result chan streamResult) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.err != nil {
+		return l.err
+	}
+	l.pending[id] = result
+	return nil
+}
+
+// forget stops waiting for the response with sequence id
+func (l *liveStream) forget(id string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	delete(l.pending, id)
+}
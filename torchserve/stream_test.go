@@ -0,0 +1,157 @@
+package torchserve
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"google.golang.org/genproto/googleapis/rpc/status"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	grpcstatus "google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+
+	"github.com/dbrun3/nexus-vector/torchserve/pb"
+)
+
+// streamServer answers StreamPredictions2 requests concurrently and out of order, embedding each text as its length.
+// The first breakStreams streams break on their first request without answering it
+type streamServer struct {
+	pb.UnimplementedInferenceAPIsServiceServer
+	breakStreams int32
+	streams      atomic.Int32
+}
+
+func (s *streamServer) StreamPredictions2(stream grpc.BidiStreamingServer[pb.PredictionsRequest, pb.PredictionResponse]) error {
+	breaks := s.streams.Add(1) <= s.breakStreams
+
+	var sendMu sync.Mutex
+	var wg sync.WaitGroup
+	defer wg.Wait()
+	for {
+		req, err := stream.Recv()
+		if err != nil {
+			return nil
+		}
+		if breaks {
+			return grpcstatus.Error(codes.Unavailable, "worker died")
+		}
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			resp := &pb.PredictionResponse{SequenceId: req.SequenceId}
+
+			var body struct {
+				Input []string `json:"input"`
+			}
+			json.Unmarshal(req.Input["body"], &body)
+			if req.ModelName == "missing" {
+				resp.Status = &status.Status{Code: int32(codes.NotFound), Message: "Model not found"}
+			} else {
+				embeddings := make([][]float64, len(body.Input))
+				for i, text := range body.Input {
+					embeddings[i] = []float64{float64(len(text))}
+				}
+				resp.Prediction, _ = json.Marshal(embeddings)
+				// Longer texts are answered later, so responses arrive out of order
+				time.Sleep(time.Duration(len(body.Input[0])) * time.Millisecond)
+			}
+
+			sendMu.Lock()
+			defer sendMu.Unlock()
+			stream.Send(resp)
+		}()
+	}
+}
+
+// newStreamTestClient serves s in process and returns a streaming client of it
+func newStreamTestClient(t *testing.T, s *streamServer, model string) *Client {
+	listener := bufconn.Listen(1 << 20)
+	server := grpc.NewServer()
+	pb.RegisterInferenceAPIsServiceServer(server, s)
+	go server.Serve(listener)
+	t.Cleanup(server.Stop)
+
+	conn, err := grpc.NewClient("passthrough:///bufconn",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) { return listener.DialContext(ctx) }),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+	)
+	if err != nil {
+		t.Fatalf("Failed to connect: %v", err)
+	}
+
+	c := &Client{
+		transport: newStreamTransport(&grpcTransport{conn: conn, client: pb.NewInferenceAPIsServiceClient(conn)}, 2),
+		model:     model,
+	}
+	t.Cleanup(func() { c.Close() })
+	return c
+}
+
+func TestStreamTransport_Multiplexes(t *testing.T) {
+	s := &streamServer{}
+	c := newStreamTestClient(t, s, "minilm")
+
+	var wg sync.WaitGroup
+	for i := range 20 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			text := fmt.Sprintf("%*d", 20-i, i)
+			embeddings, err := c.TextToEmbeddings(context.Background(), text)
+			if err != nil {
+				t.Errorf("TextToEmbeddings() error = %v", err)
+				return
+			}
+			if len(embeddings) != 1 || embeddings[0][0] != float32(len(text)) {
+				t.Errorf("Expected the embedding of %q, got %v", text, embeddings)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if streams := s.streams.Load(); streams != 2 {
+		t.Errorf("Expected predictions to share 2 streams, %d were opened", streams)
+	}
+}
+
+func TestStreamTransport_Reconnects(t *testing.T) {
+	// The first stream breaks, so the first prediction is retried on a new stream the third prediction reuses
+	s := &streamServer{breakStreams: 1}
+	c := newStreamTestClient(t, s, "minilm")
+
+	for _, text := range []string{"a", "bb", "ccc"} {
+		embeddings, err := c.TextToEmbeddings(context.Background(), text)
+		if err != nil {
+			t.Fatalf("TextToEmbeddings(%q) error = %v", text, err)
+		}
+		if embeddings[0][0] != float32(len(text)) {
+			t.Errorf("Expected the embedding of %q, got %v", text, embeddings)
+		}
+	}
+
+	if streams := s.streams.Load(); streams != 3 {
+		t.Errorf("Expected 3 streams to be opened, got %d", streams)
+	}
+}
+
+func TestStreamTransport_Errors(t *testing.T) {
+	c := newStreamTestClient(t, &streamServer{}, "missing")
+
+	_, err := c.TextToEmbeddings(context.Background(), "a")
+	if grpcstatus.Code(err) != codes.NotFound {
+		t.Errorf("Expected a NotFound error, got %v", err)
+	}
+
+	c.Close()
+	if _, err := c.TextToEmbeddings(context.Background(), "a"); err == nil {
+		t.Error("Expected an error after Close")
+	}
+}
@@ -158,32 +158,41 @@ type SimplifiedPurchaseItem struct {
 	Item string `json:"item"`
 }
 
-// SimplifiedTrigger represents a simplified trigger for embedding generation
+// SimplifiedTrigger represents a simplified trigger for embedding generation, with semantic descriptions instead of
+// raw amounts and item details
 type SimplifiedTrigger struct {
-	TriggerType model.TriggerType        `json:"trigger_type"`
-	Amount      float64                  `json:"amount,omitempty"`
-	Category    string                   `json:"category,omitempty"`
-	Items       []SimplifiedPurchaseItem `json:"items,omitempty"`
-	Retailer    string                   `json:"retailer,omitempty"`
-	Location    string                   `json:"location,omitempty"`
+	TriggerType model.TriggerType `json:"trigger_type"`
+	SpendTier   string            `json:"spend_tier,omitempty"`
+	Category    string            `json:"category,omitempty"`
+
+	// Purchase specific fields
+	BasketSize       string                   `json:"basket_size,omitempty"`
+	DominantCategory string                   `json:"dominant_category,omitempty"`
+	BrandTier        string                   `json:"brand_tier,omitempty"`
+	Items            []SimplifiedPurchaseItem `json:"items,omitempty"`
+	Retailer         string                   `json:"retailer,omitempty"`
+	Location         string                   `json:"location,omitempty"`
 
 	// Redemption specific fields
-	GiftCardBrand   string  `json:"gift_card_brand,omitempty"`
-	GiftCardType    string  `json:"gift_card_type,omitempty"`
-	RedemptionValue float64 `json:"redemption_value,omitempty"`
+	GiftCardBrand string `json:"gift_card_brand,omitempty"`
+	GiftCardType  string `json:"gift_card_type,omitempty"`
+	GiftCardValue string `json:"gift_card_value,omitempty"`
 }
 
 // SimplifyTrigger converts a full Trigger to a SimplifiedTrigger for embedding
 func SimplifyTrigger(trigger model.Trigger) SimplifiedTrigger {
 	simplified := SimplifiedTrigger{
-		TriggerType:     trigger.TriggerType,
-		Amount:          trigger.Amount,
-		Category:        trigger.Category,
-		Retailer:        trigger.Retailer,
-		Location:        trigger.Location,
-		GiftCardBrand:   trigger.GiftCardBrand,
-		GiftCardType:    trigger.GiftCardType,
-		RedemptionValue: trigger.RedemptionValue,
+		TriggerType:      trigger.TriggerType,
+		SpendTier:        amountToSemantic(trigger.Amount),
+		Category:         trigger.Category,
+		BasketSize:       basketToSemantic(trigger.Items),
+		DominantCategory: dominantCategory(trigger.Items),
+		BrandTier:        brandTier(trigger.Items),
+		Retailer:         trigger.Retailer,
+		Location:         trigger.Location,
+		GiftCardBrand:    trigger.GiftCardBrand,
+		GiftCardType:     trigger.GiftCardType,
+		GiftCardValue:    giftCardValueToSemantic(trigger.RedemptionValue),
 	}
 
 	// Simplify purchase items - combine brand and name, drop other fields
@@ -203,3 +212,119 @@ func SimplifyTrigger(trigger model.Trigger) SimplifiedTrigger {
 
 	return simplified
 }
+
+// amountToSemantic converts a purchase amount in dollars to a spend tier, empty without an amount
+func amountToSemantic(amount float64) string {
+	switch {
+	case amount <= 0:
+		return ""
+	case amount <= 20:
+		return "small purchase"
+	case amount <= 75:
+		return "moderate purchase"
+	case amount <= 200:
+		return "large purchase"
+	default:
+		return "major purchase"
+	}
+}
+
+// basketToSemantic converts the number of units bought to a basket size, empty without items
+func basketToSemantic(items []model.PurchaseItem) string {
+	units := 0
+	for _, item := range items {
+		units += max(item.Quantity, 1)
+	}
+
+	switch {
+	case units == 0:
+		return ""
+	case units == 1:
+		return "single item"
+	case units <= 5:
+		return "small basket"
+	case units <= 15:
+		return "medium basket"
+	default:
+		return "large basket"
+	}
+}
+
+// dominantCategory returns the item category most was spent on, by units bought when items have no prices, the first
+// such category on ties
+func dominantCategory(items []model.PurchaseItem) string {
+	var categories []string
+	spend := make(map[string]float64)
+	units := make(map[string]int)
+	for _, item := range items {
+		if item.Category == "" {
+			continue
+		}
+		if _, ok := units[item.Category]; !ok {
+			categories = append(categories, item.Category)
+		}
+		quantity := max(item.Quantity, 1)
+		spend[item.Category] += item.Price * float64(quantity)
+		units[item.Category] += quantity
+	}
+
+	dominant := ""
+	for _, category := range categories {
+		if dominant == "" || spend[category] > spend[dominant] ||
+			(spend[category] == spend[dominant] && units[category] > units[dominant]) {
+			dominant = category
+		}
+	}
+	return dominant
+}
+
+// premiumBrands and valueBrands are well known brands of each tier, lowercased
+var (
+	premiumBrands = map[string]bool{
+		"apple": true, "samsung": true, "sony": true, "bose": true, "dyson": true, "google": true, "microsoft": true,
+		"nike": true, "adidas": true, "lululemon": true, "the north face": true, "patagonia": true,
+		"starbucks": true, "godiva": true, "whole foods": true, "estee lauder": true, "clinique": true,
+	}
+	valueBrands = map[string]bool{
+		"great value": true, "equate": true, "mainstays": true, "kirkland": true, "kirkland signature": true,
+		"member's mark": true, "up & up": true, "up&up": true, "market pantry": true, "good & gather": true,
+		"amazon basics": true, "amazonbasics": true, "store brand": true, "generic": true, "365": true,
+	}
+)
+
+// brandTier describes the items' brands as premium, value or mixed, empty when none is a known brand
+func brandTier(items []model.PurchaseItem) string {
+	premium, value := false, false
+	for _, item := range items {
+		brand := strings.ToLower(strings.TrimSpace(item.Brand))
+		premium = premium || premiumBrands[brand]
+		value = value || valueBrands[brand]
+	}
+
+	switch {
+	case premium && value:
+		return "mixed"
+	case premium:
+		return "premium"
+	case value:
+		return "value"
+	default:
+		return ""
+	}
+}
+
+// giftCardValueToSemantic converts a gift card's value in dollars to a value tier, empty without a value
+func giftCardValueToSemantic(value float64) string {
+	switch {
+	case value <= 0:
+		return ""
+	case value <= 10:
+		return "low value"
+	case value <= 25:
+		return "medium value"
+	case value <= 50:
+		return "high value"
+	default:
+		return "premium value"
+	}
+}
@@ -0,0 +1,85 @@
+package util
+
+import (
+	"reflect"
+	"slices"
+	"strings"
+)
+
+// SchemaOptions refine a generated JSON schema, fields being addressed by their dotted JSON path, e.g. "content.offer.unit"
+type SchemaOptions struct {
+	Enums map[string][]string
+	Omit  []string
+}
+
+// JSONSchema generates a strict JSON schema for the JSON encoding of v's type, as accepted by structured output APIs:
+// every property is required, pointers are nullable and objects allow no additional properties
+func JSONSchema(v any, opts SchemaOptions) map[string]any {
+	return typeSchema(reflect.TypeOf(v), "", opts)
+}
+
+func typeSchema(t reflect.Type, path string, opts SchemaOptions) map[string]any {
+	switch t.Kind() {
+	case reflect.Pointer:
+		return map[string]any{
+			"anyOf": []any{typeSchema(t.Elem(), path, opts), map[string]any{"type": "null"}},
+		}
+	case reflect.Slice, reflect.Array:
+		return map[string]any{
+			"type":  "array",
+			"items": typeSchema(t.Elem(), path, opts),
+		}
+	case reflect.Struct:
+		return structSchema(t, path, opts)
+	case reflect.Bool:
+		return map[string]any{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return map[string]any{"type": "integer"}
+	case reflect.Float32, reflect.Float64:
+		return map[string]any{"type": "number"}
+	default:
+		schema := map[string]any{"type": "string"}
+		if enum, ok := opts.Enums[path]; ok {
+			schema["enum"] = enum
+		}
+		return schema
+	}
+}
+
+func structSchema(t reflect.Type, path string, opts SchemaOptions) map[string]any {
+	properties := make(map[string]any)
+	required := make([]string, 0, t.NumField())
+
+	for i := range t.NumField() {
+		field := t.Field(i)
+		if !field.IsExported() {
+			continue
+		}
+		name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+		if name == "-" {
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+
+		fieldPath := name
+		if path != "" {
+			fieldPath = path + "." + name
+		}
+		if slices.Contains(opts.Omit, fieldPath) {
+			continue
+		}
+
+		properties[name] = typeSchema(field.Type, fieldPath, opts)
+		required = append(required, name)
+	}
+
+	return map[string]any{
+		"type":                 "object",
+		"properties":           properties,
+		"required":             required,
+		"additionalProperties": false,
+	}
+}
@@ -0,0 +1,259 @@
+package util
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/dbrun3/nexus-vector/model"
+)
+
+// TextFormat names a way of serializing users and triggers into the text they are embedded from
+type TextFormat string
+
+const (
+	CleanedJSONFormat TextFormat = "json"      // marshalled JSON stripped of punctuation, e.g. "trigger_type snap amount 42.1"
+	KeyValueFormat    TextFormat = "key_value" // one "key: value" line per field, e.g. "trigger type: snap"
+	SentenceFormat    TextFormat = "sentence"  // natural language sentences per trigger type and for profiles
+
+	DefaultTextFormat = CleanedJSONFormat
+)
+
+// Serializer turns users and triggers into the text they are embedded from
+type Serializer interface {
+	UserText(snapshot model.UserSnapshot) (string, error)
+	TriggerText(trigger model.Trigger) (string, error)
+}
+
+// NewSerializer returns the serializer of a text format, DefaultTextFormat when empty
+func NewSerializer(format TextFormat) (Serializer, error) {
+	switch format {
+	case "", CleanedJSONFormat:
+		return CleanedJSONSerializer{}, nil
+	case KeyValueFormat:
+		return KeyValueSerializer{}, nil
+	case SentenceFormat:
+		return SentenceSerializer{}, nil
+	}
+	return nil, fmt.Errorf("unknown text format: %s", format)
+}
+
+// CleanedJSONSerializer strips the punctuation of users and triggers marshalled as JSON
+type CleanedJSONSerializer struct{}
+
+func (CleanedJSONSerializer) UserText(snapshot model.UserSnapshot) (string, error) {
+	return CleanUserSnapshotForEmbedding(snapshot)
+}
+
+func (CleanedJSONSerializer) TriggerText(trigger model.Trigger) (string, error) {
+	return CleanTriggerForEmbedding(trigger)
+}
+
+// KeyValueSerializer writes a "key: value" line per field set, lists being comma separated
+type KeyValueSerializer struct{}
+
+func (KeyValueSerializer) UserText(snapshot model.UserSnapshot) (string, error) {
+	s := convertUserSnapshotToSemantic(snapshot)
+
+	var lines keyValues
+	lines.add("id", s.ID)
+	lines.add("gender", s.Gender)
+	lines.add("age group", s.AgeGroup)
+	lines.add("location", s.Location)
+	lines.add("rewards level", s.RewardsLevel)
+	lines.add("spending level", s.SpendingLevel)
+	lines.add("last purchase category", s.LastPurchaseCategory)
+	lines.add("favorite categories", strings.Join(s.FavoriteCategories, ", "))
+	lines.add("engagement level", s.EngagementLevel)
+	lines.add("app usage frequency", s.AppUsageFrequency)
+	lines.add("preferred offer type", s.PreferredOfferType)
+	lines.add("seasonal preference", s.SeasonalPreference)
+	lines.add("shopping time preference", s.ShoppingTimePref)
+	lines.add("price sensitivity", s.Pricesensitivity)
+	lines.add("brand loyalty", s.BrandLoyalty)
+	return lines.String(), nil
+}
+
+func (KeyValueSerializer) TriggerText(trigger model.Trigger) (string, error) {
+	t := SimplifyTrigger(trigger)
+
+	var lines keyValues
+	lines.add("trigger type", string(t.TriggerType))
+	lines.add("spend tier", t.SpendTier)
+	lines.add("category", t.Category)
+	lines.add("basket size", t.BasketSize)
+	lines.add("dominant category", t.DominantCategory)
+	lines.add("brand tier", t.BrandTier)
+	lines.add("items", strings.Join(itemNames(t.Items), ", "))
+	lines.add("retailer", t.Retailer)
+	lines.add("location", t.Location)
+	lines.add("gift card brand", t.GiftCardBrand)
+	lines.add("gift card type", t.GiftCardType)
+	lines.add("gift card value", t.GiftCardValue)
+	return lines.String(), nil
+}
+
+// keyValues collects "key: value" lines, skipping empty values
+type keyValues []string
+
+func (kv *keyValues) add(key, value string) {
+	if value != "" {
+		*kv = append(*kv, key+": "+value)
+	}
+}
+
+func (kv keyValues) String() string {
+	return strings.Join(kv, "\n")
+}
+
+// SentenceSerializer describes users and triggers in natural language, with a template per trigger type
+type SentenceSerializer struct{}
+
+func (SentenceSerializer) UserText(snapshot model.UserSnapshot) (string, error) {
+	s := convertUserSnapshotToSemantic(snapshot)
+	var sentences []string
+
+	// e.g. "A young adult female shopper in an urban area."
+	shopper := joinWords(ageGroupOrEmpty(snapshot.Age, s.AgeGroup), s.Gender, "shopper")
+	shopper = strings.ToUpper(article(shopper)[:1]) + article(shopper)[1:] + " " + shopper
+	if s.Location != "" {
+		shopper += " in " + article(s.Location) + " " + s.Location + " area"
+	}
+	sentences = append(sentences, shopper+".")
+
+	if snapshot.TotalSpend > 0 {
+		sentences = appendSentence(sentences, "They are a %s and have %s.", s.SpendingLevel, s.RewardsLevel)
+	} else {
+		sentences = appendSentence(sentences, "They have no spending and %s.", s.RewardsLevel)
+	}
+	sentences = appendSentence(sentences, "Their last purchase was in %s.", s.LastPurchaseCategory)
+	if len(s.FavoriteCategories) == 1 {
+		sentences = appendSentence(sentences, "Their favorite category is %s.", s.FavoriteCategories[0])
+	} else {
+		sentences = appendSentence(sentences, "Their favorite categories are %s.", joinList(s.FavoriteCategories))
+	}
+	sentences = appendSentence(sentences, "They have %s engagement and use the app %s.", s.EngagementLevel, s.AppUsageFrequency)
+	sentences = appendSentence(sentences, "They prefer %s offers.", s.PreferredOfferType)
+	sentences = appendSentence(sentences, "They like to shop in the %s, especially in %s.", s.ShoppingTimePref, s.SeasonalPreference)
+	sentences = appendSentence(sentences, "They have %s price sensitivity and %s brand loyalty.", s.Pricesensitivity, s.BrandLoyalty)
+
+	return strings.Join(sentences, " "), nil
+}
+
+func (SentenceSerializer) TriggerText(trigger model.Trigger) (string, error) {
+	t := SimplifyTrigger(trigger)
+	var sentences []string
+
+	switch t.TriggerType {
+	case model.PostRedemption:
+		// e.g. "Redeemed a medium value digital Amazon gift card."
+		card := joinWords(t.GiftCardValue, t.GiftCardType, t.GiftCardBrand, "gift card")
+		sentences = append(sentences, "Redeemed "+article(card)+" "+card+".")
+		sentences = appendSentence(sentences, "It was for %s.", t.Category)
+
+	default:
+		// e.g. "Snapped a receipt from Target in Chicago, IL. It was a moderate purchase of electronics."
+		verb := "Snapped a receipt"
+		if t.TriggerType == model.PostEreceiptTrigger {
+			verb = "Received an e-receipt"
+		} else if t.TriggerType != model.PostSnapTrigger {
+			verb = "Made a " + string(t.TriggerType) + " purchase"
+		}
+		if t.Retailer != "" {
+			verb += " from " + t.Retailer
+		}
+		if t.Location != "" {
+			verb += " in " + t.Location
+		}
+		sentences = append(sentences, verb+".")
+
+		category := t.Category
+		if category == "" {
+			category = t.DominantCategory
+		}
+		if t.SpendTier != "" {
+			purchase := "It was " + article(t.SpendTier) + " " + t.SpendTier
+			if category != "" {
+				purchase += " of " + category
+			}
+			sentences = append(sentences, purchase+".")
+		} else {
+			sentences = appendSentence(sentences, "It was a purchase of %s.", category)
+		}
+
+		// e.g. "They bought a small basket of mostly premium brands: Apple iPhone 15 and Bread."
+		if len(t.Items) > 0 {
+			bought := "They bought " + article(t.BasketSize) + " " + t.BasketSize
+			switch t.BrandTier {
+			case "mixed":
+				bought += " of premium and value brands"
+			case "":
+			default:
+				bought += " of mostly " + t.BrandTier + " brands"
+			}
+			sentences = append(sentences, bought+": "+joinList(itemNames(t.Items))+".")
+		}
+	}
+
+	return strings.Join(sentences, " "), nil
+}
+
+// appendSentence appends a sentence formatted with values unless any is empty
+func appendSentence(sentences []string, format string, values ...string) []string {
+	for _, v := range values {
+		if v == "" {
+			return sentences
+		}
+	}
+	args := make([]any, len(values))
+	for i, v := range values {
+		args[i] = v
+	}
+	return append(sentences, fmt.Sprintf(format, args...))
+}
+
+// ageGroupOrEmpty drops the age group of users without an age
+func ageGroupOrEmpty(age int, group string) string {
+	if age == 0 {
+		return ""
+	}
+	return group
+}
+
+// joinWords joins the non-empty words with spaces
+func joinWords(words ...string) string {
+	var kept []string
+	for _, w := range words {
+		if w != "" {
+			kept = append(kept, w)
+		}
+	}
+	return strings.Join(kept, " ")
+}
+
+// joinList joins items as an English list, e.g. "a, b and c"
+func joinList(items []string) string {
+	switch len(items) {
+	case 0:
+		return ""
+	case 1:
+		return items[0]
+	}
+	return strings.Join(items[:len(items)-1], ", ") + " and " + items[len(items)-1]
+}
+
+// article returns the indefinite article of a word
+func article(word string) string {
+	if word != "" && strings.ContainsRune("aeiouAEIOU", rune(word[0])) {
+		return "an"
+	}
+	return "a"
+}
+
+// itemNames returns the names of simplified purchase items
+func itemNames(items []SimplifiedPurchaseItem) []string {
+	names := make([]string, len(items))
+	for i, item := range items {
+		names[i] = item.Item
+	}
+	return names
+}
@@ -0,0 +1,157 @@
+package util
+
+import (
+	"flag"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/dbrun3/nexus-vector/model"
+)
+
+var update = flag.Bool("update", false, "rewrite the golden files of serializers")
+
+// serializeUsers and serializeTriggers cover every trigger type and a complete and sparse profile
+var (
+	serializeUsers = map[string]model.UserSnapshot{
+		"user_full": {
+			ID:                   "user-1",
+			Gender:               "female",
+			Age:                  29,
+			Location:             "urban",
+			RewardsBalance:       1200,
+			TotalSpend:           3400.5,
+			LastPurchaseCategory: "electronics",
+			FavoriteCategories:   []string{"electronics", "books", "sports"},
+			EngagementLevel:      "high",
+			AppUsageFrequency:    "daily",
+			PreferredOfferType:   "cashback",
+			SeasonalPreference:   "winter",
+			ShoppingTimePref:     "evening",
+			Pricesensitivity:     "medium",
+			BrandLoyalty:         "low",
+		},
+		"user_sparse": {
+			Location:           "rural",
+			FavoriteCategories: []string{"groceries"},
+		},
+	}
+
+	serializeTriggers = map[string]model.Trigger{
+		"trigger_snap": {
+			TriggerType: model.PostSnapTrigger,
+			Amount:      42.1,
+			Category:    "electronics",
+			Items: []model.PurchaseItem{
+				{Name: "iPhone 15", Brand: "Apple", Category: "electronics", Price: 40, Quantity: 1},
+				{Name: "Bread", Category: "groceries", Price: 2.1, Quantity: 1},
+			},
+			Retailer: "Target",
+			Location: "Chicago, IL",
+		},
+		"trigger_ereceipt": {
+			TriggerType: model.PostEreceiptTrigger,
+			Amount:      15,
+			Category:    "groceries",
+			Items:       []model.PurchaseItem{{Name: "Organic Bananas", Category: "groceries", Price: 15, Quantity: 3}},
+			Retailer:    "Amazon",
+		},
+		"trigger_redeem": {
+			TriggerType:     model.PostRedemption,
+			GiftCardBrand:   "Amazon",
+			GiftCardType:    "digital",
+			RedemptionValue: 25,
+		},
+	}
+)
+
+func TestSerializers_Golden(t *testing.T) {
+	for _, format := range []TextFormat{CleanedJSONFormat, KeyValueFormat, SentenceFormat} {
+		serializer, err := NewSerializer(format)
+		if err != nil {
+			t.Fatalf("NewSerializer(%s) error = %v", format, err)
+		}
+
+		texts := make(map[string]string)
+		for name, snapshot := range serializeUsers {
+			if texts[name], err = serializer.UserText(snapshot); err != nil {
+				t.Fatalf("%s UserText(%s) error = %v", format, name, err)
+			}
+		}
+		for name, trigger := range serializeTriggers {
+			if texts[name], err = serializer.TriggerText(trigger); err != nil {
+				t.Fatalf("%s TriggerText(%s) error = %v", format, name, err)
+			}
+		}
+
+		for name, text := range texts {
+			t.Run(string(format)+"/"+name, func(t *testing.T) {
+				path := filepath.Join("testdata", "serialize", string(format), name+".golden")
+				if *update {
+					if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+						t.Fatal(err)
+					}
+					if err := os.WriteFile(path, []byte(text+"\n"), 0o644); err != nil {
+						t.Fatal(err)
+					}
+				}
+
+				golden, err := os.ReadFile(path)
+				if err != nil {
+					t.Fatalf("Failed to read golden file, run with -update to create it: %v", err)
+				}
+				if string(golden) != text+"\n" {
+					t.Errorf("Text differs from %s:\ngot:\n%s\nexpected:\n%s", path, text, golden)
+				}
+			})
+		}
+	}
+}
+
+func TestNewSerializer_Unknown(t *testing.T) {
+	if _, err := NewSerializer("yaml"); err == nil {
+		t.Error("Expected an error for an unknown text format")
+	}
+}
+
+func TestSimplifyTrigger_Buckets(t *testing.T) {
+	tests := []struct {
+		name     string
+		trigger  model.Trigger
+		expected SimplifiedTrigger
+	}{
+		{
+			name: "dominant category by spend",
+			trigger: model.Trigger{TriggerType: model.PostSnapTrigger, Amount: 250, Items: []model.PurchaseItem{
+				{Name: "Bread", Category: "groceries", Price: 3, Quantity: 4},
+				{Name: "Headphones", Brand: "Bose", Category: "electronics", Price: 200, Quantity: 1},
+				{Name: "Milk", Brand: "Great Value", Category: "groceries", Price: 4, Quantity: 2},
+			}},
+			expected: SimplifiedTrigger{SpendTier: "major purchase", BasketSize: "medium basket", DominantCategory: "electronics", BrandTier: "mixed"},
+		},
+		{
+			name: "dominant category by units without prices",
+			trigger: model.Trigger{TriggerType: model.PostEreceiptTrigger, Items: []model.PurchaseItem{
+				{Name: "Shampoo", Category: "beauty", Quantity: 1},
+				{Name: "Pasta", Brand: "Great Value", Category: "groceries", Quantity: 20},
+			}},
+			expected: SimplifiedTrigger{BasketSize: "large basket", DominantCategory: "groceries", BrandTier: "value"},
+		},
+		{
+			name:     "gift card value",
+			trigger:  model.Trigger{TriggerType: model.PostRedemption, RedemptionValue: 5},
+			expected: SimplifiedTrigger{GiftCardValue: "low value"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := SimplifyTrigger(tt.trigger)
+			if got.SpendTier != tt.expected.SpendTier || got.BasketSize != tt.expected.BasketSize ||
+				got.DominantCategory != tt.expected.DominantCategory || got.BrandTier != tt.expected.BrandTier ||
+				got.GiftCardValue != tt.expected.GiftCardValue {
+				t.Errorf("SimplifyTrigger() = %+v, expected %+v", got, tt.expected)
+			}
+		})
+	}
+}